@@ -0,0 +1,461 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OpenForAppend opens an existing MPQ archive for in-place modification.
+// Files are added, replaced and removed as with OpenForModify, but Close
+// does not rewrite the archive: new file data is written into free gaps or
+// after the last block, the blocks of replaced and removed files are marked
+// free for later reuse, and only (listfile), (attributes), the hash and block
+// tables and the header are written again. FreeSpace reports the space
+// left unused and Compact reclaims it.
+//
+// A file replaces the version with the same path and locale. The hash table
+// keeps its size, so adding more files than it can hold fails; Compact can
+// grow it. A weak or strong signature is dropped since it would no longer
+// match, and (patch_metadata) is kept with a new PatchMD5. Changes are
+// written in place, so an interrupted Close can leave the archive damaged.
+// Closing an archive without changes leaves the file as it was.
+func OpenForAppend(path string) (*Archive, error) {
+	archive, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	archive.file.Close()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	archive.file = file
+	archive.mode = "a"
+	archive.removedFiles = make(map[string]bool)
+	if archive.header.FormatVersion >= formatVersion2 {
+		archive.formatVersion = FormatV2
+	}
+
+	// Keep writing file times if the archive already stores them
+	if attrs, err := archive.readAttributes(); err == nil && attrs != nil && attrs.fileTime != nil {
+		archive.timestamps = TimestampsSource
+	}
+
+	// Keep the patch metadata; its PatchMD5 is recomputed on Close
+	if meta, err := archive.readPatchMetadata(); err == nil {
+		archive.patchMetadata = meta
+	}
+
+	return archive, nil
+}
+
+// appendSpecialFiles are regenerated or dropped by an in-place Close.
+var appendSpecialFiles = []string{"(listfile)", "(attributes)", "(patch_metadata)", "(signature)"}
+
+// blockWrite is block data placed by appendArchive, written once all
+// changes are planned.
+type blockWrite struct {
+	pos  uint64 // Relative to the archive start
+	data []byte
+}
+
+// appendArchive writes the changes of an archive opened with OpenForAppend
+// in place. All blocks are placed and the tables updated in memory first, so
+// a failure while planning leaves the file untouched. An archive without
+// changes is not written at all.
+func (a *Archive) appendArchive() error {
+	if len(a.pendingFiles) == 0 && len(a.removedFiles) == 0 && !a.patchMetadataChanged {
+		return nil
+	}
+	archiveStart := int64(a.header.ArchiveOffset)
+
+	// Everything needed from the old special files is read first, as their
+	// space may be reused
+	attrs, err := a.readAttributes()
+	if err != nil {
+		attrs = nil
+	}
+	names, err := a.ListFiles()
+	if err != nil {
+		names = nil // No (listfile); only new files can be listed
+	}
+
+	// The new (attributes) keeps every column the old one stored. Blocks
+	// this Close writes get new values; untouched blocks keep theirs, or
+	// zeros where the old table lacks a column, so no file is read back
+	columns := uint32(attributesFlagCRC32)
+	if attrs != nil {
+		columns |= attrs.flags & (attributesFlagMD5 | attributesFlagPatchBit)
+	}
+	if a.timestamps != TimestampsNone {
+		columns |= attributesFlagFileTime
+	}
+	attributes := newFileAttributes(columns, len(a.blockTable))
+	if attrs != nil {
+		copy(attributes.crc32, attrs.crc32)
+		copy(attributes.fileTime, attrs.fileTime)
+		copy(attributes.md5, attrs.md5)
+		copy(attributes.patchBit, attrs.patchBit)
+	}
+
+	// Free the special files and the removed files
+	removed := make(map[string]bool)
+	for _, name := range appendSpecialFiles {
+		removed[normalizeMpqPath(name)] = true
+	}
+	for name := range a.removedFiles {
+		removed[normalizeMpqPath(name)] = true
+	}
+	for name := range removed {
+		for _, entry := range a.hashEntries(name) {
+			a.blockTable[entry.BlockIndex] = blockTableEntryEx{}
+			attributes.set(int(entry.BlockIndex), 0, 0, [16]byte{}, false)
+			entry.BlockIndex = hashTableDeleted
+		}
+	}
+
+	var listed []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		key := normalizeMpqPath(name)
+		if !removed[key] && !seen[key] {
+			seen[key] = true
+			listed = append(listed, name)
+		}
+	}
+
+	// A later write of the same path and locale wins
+	type fileKey struct {
+		path   string
+		locale uint16
+	}
+	latest := make(map[fileKey]int)
+	for i, pf := range a.pendingFiles {
+		latest[fileKey{normalizeMpqPath(pf.mpqPath), pf.locale}] = i
+	}
+
+	// Replaced files keep their block index; their data is freed
+	targets := make(map[int]uint32)
+	for i, pf := range a.pendingFiles {
+		if latest[fileKey{normalizeMpqPath(pf.mpqPath), pf.locale}] != i {
+			continue
+		}
+		for _, entry := range a.hashEntries(pf.mpqPath) {
+			if entry.Locale == pf.locale {
+				a.blockTable[entry.BlockIndex] = blockTableEntryEx{}
+				targets[i] = entry.BlockIndex
+				break
+			}
+		}
+	}
+
+	regions, end := a.freeRegions()
+	space := &spaceAllocator{regions: regions, end: end}
+
+	// Blocks that no hash entry refers to can be reused
+	referenced := a.referencedBlocks()
+	var freeBlocks []uint32
+	for i := range a.blockTable {
+		if a.blockTable[i].Flags&fileExists == 0 && !referenced[uint32(i)] {
+			freeBlocks = append(freeBlocks, uint32(i))
+		}
+	}
+	nextBlock := func() uint32 {
+		if len(freeBlocks) > 0 {
+			index := freeBlocks[0]
+			freeBlocks = freeBlocks[1:]
+			return index
+		}
+		a.blockTable = append(a.blockTable, blockTableEntryEx{})
+		attributes.grow()
+		return uint32(len(a.blockTable) - 1)
+	}
+
+	var writes []blockWrite
+	place := func(index uint32, pos uint64, data []byte, fileSize, flags uint32) {
+		a.blockTable[index] = blockTableEntryEx{
+			blockTableEntry: blockTableEntry{
+				FilePos:        uint32(pos),
+				CompressedSize: uint32(len(data)),
+				FileSize:       fileSize,
+				Flags:          flags,
+			},
+			FilePosHi: uint16(pos >> 32),
+		}
+		if len(data) > 0 {
+			writes = append(writes, blockWrite{pos: pos, data: data})
+		}
+	}
+	addBlock := func(mpqPath string, locale uint16) (uint32, error) {
+		index := nextBlock()
+		if err := a.addToHashTable(mpqPath, locale, index); err != nil {
+			return 0, fmt.Errorf("add %s: %w; compact the archive with a larger MaxFiles first", mpqPath, err)
+		}
+		return index, nil
+	}
+
+	for i := range a.pendingFiles {
+		pf := &a.pendingFiles[i]
+		if latest[fileKey{normalizeMpqPath(pf.mpqPath), pf.locale}] != i {
+			continue
+		}
+
+		index, replaced := targets[i]
+		if !replaced {
+			if index, err = addBlock(pf.mpqPath, pf.locale); err != nil {
+				return err
+			}
+		}
+
+		key := normalizeMpqPath(pf.mpqPath)
+		if !seen[key] {
+			seen[key] = true
+			listed = append(listed, pf.mpqPath)
+		}
+		if pf.isDeleteMarker {
+			attributes.set(int(index), 0, a.fileTimeFor(pf), [16]byte{}, false)
+			place(index, space.end, nil, 0, fileDeleteMarker|fileExists)
+			continue
+		}
+
+		// Only FILE_FIX_KEY data depends on the position, so the size is
+		// known before the position is
+		tentative := space.end
+		data, flags, err := a.encodeFile(pf, int64(tentative))
+		if err != nil {
+			return err
+		}
+		pos := space.alloc(uint64(len(data)))
+		if flags&fileFixKey != 0 && pos != tentative {
+			if data, flags, err = a.encodeFile(pf, int64(pos)); err != nil {
+				return err
+			}
+		}
+		attributes.set(int(index), crc32(pf.data), a.fileTimeFor(pf), md5.Sum(pf.data), pf.isPatchFile)
+		place(index, pos, data, uint32(len(pf.data)), flags)
+	}
+
+	// (patch_metadata) is stored uncompressed; PatchMD5 is filled in last
+	metaPos := uint64(0)
+	if a.patchMetadata != nil {
+		index, err := addBlock("(patch_metadata)", localeNeutral)
+		if err != nil {
+			return err
+		}
+		meta := *a.patchMetadata
+		meta.PatchMD5 = [16]byte{}
+		metaPos = space.alloc(patchMetadataSize)
+		attributes.set(int(index), 0, a.fileTimeFor(nil), [16]byte{}, false)
+		place(index, metaPos, meta.encode(), patchMetadataSize, fileExists|fileSingleUnit)
+	}
+
+	if len(listed) > 0 {
+		index, err := addBlock("(listfile)", localeNeutral)
+		if err != nil {
+			return err
+		}
+		listFileData := []byte(strings.Join(listed, "\r\n") + "\r\n")
+		data, flags, err := storeSpecialFile(listFileData)
+		if err != nil {
+			return fmt.Errorf("compress listfile: %w", err)
+		}
+		attributes.set(int(index), crc32(listFileData), a.fileTimeFor(nil), md5.Sum(listFileData), false)
+		place(index, space.alloc(uint64(len(data))), data, uint32(len(listFileData)), flags)
+	}
+
+	// The (attributes) block is allocated before the table is built so the
+	// table covers it
+	attrIndex, err := addBlock("(attributes)", localeNeutral)
+	if err != nil {
+		return err
+	}
+	attributes.set(int(attrIndex), 0, a.fileTimeFor(nil), [16]byte{}, false)
+	attributesData := attributes.encode()
+	data, flags, err := storeSpecialFile(attributesData)
+	if err != nil {
+		return fmt.Errorf("compress attributes: %w", err)
+	}
+	place(attrIndex, space.alloc(uint64(len(data))), data, uint32(len(attributesData)), flags)
+
+	// Write the data, then the tables after the last block, then the header
+	for _, w := range writes {
+		if _, err := a.file.WriteAt(w.data, archiveStart+int64(w.pos)); err != nil {
+			return fmt.Errorf("write file data: %w", err)
+		}
+	}
+
+	needsHiBlockTable := false
+	for i := range a.blockTable {
+		if a.blockTable[i].FilePosHi != 0 {
+			needsHiBlockTable = true
+		}
+	}
+
+	hashTableOffset := space.end
+	blockTableOffset := hashTableOffset + uint64(len(a.hashTable))*16
+	totalSize := blockTableOffset + uint64(len(a.blockTable))*16
+	if _, err := a.file.Seek(archiveStart+int64(hashTableOffset), io.SeekStart); err != nil {
+		return fmt.Errorf("seek to hash table: %w", err)
+	}
+	if err := writeUint32Array(a.file, encryptHashTable(a.hashTable)); err != nil {
+		return fmt.Errorf("write hash table: %w", err)
+	}
+	if err := writeUint32Array(a.file, encryptBlockTable(a.blockTable)); err != nil {
+		return fmt.Errorf("write block table: %w", err)
+	}
+
+	a.header.HiBlockTableOffset64 = 0
+	if a.formatVersion == FormatV2 && needsHiBlockTable {
+		hiBlockTable := make([]uint16, len(a.blockTable))
+		for i, entry := range a.blockTable {
+			hiBlockTable[i] = entry.FilePosHi
+		}
+		if err := writeUint16Array(a.file, hiBlockTable); err != nil {
+			return fmt.Errorf("write hi-block table: %w", err)
+		}
+		a.header.HiBlockTableOffset64 = totalSize
+		totalSize += uint64(len(hiBlockTable)) * 2
+	}
+
+	// Anything after the tables is stale, including a strong signature
+	if err := a.file.Truncate(archiveStart + int64(totalSize)); err != nil {
+		return fmt.Errorf("truncate archive: %w", err)
+	}
+
+	a.header.setHashTableOffset64(hashTableOffset)
+	a.header.setBlockTableOffset64(blockTableOffset)
+	a.header.BlockTableSize = uint32(len(a.blockTable))
+	a.header.ArchiveSize = uint32(totalSize) - a.header.HeaderSize
+	if _, err := a.file.Seek(archiveStart, io.SeekStart); err != nil {
+		return fmt.Errorf("seek to header: %w", err)
+	}
+	if err := writeArchiveHeader(a.file, a.header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+
+	if a.patchMetadata != nil {
+		sum, err := sectionMD5(a.file, archiveStart, int64(totalSize))
+		if err != nil {
+			return fmt.Errorf("hash archive: %w", err)
+		}
+		if _, err := a.file.WriteAt(sum[:], archiveStart+int64(metaPos)+16); err != nil {
+			return fmt.Errorf("write patch metadata: %w", err)
+		}
+	}
+
+	a.pendingFiles = nil
+	a.removedFiles = make(map[string]bool)
+	a.patchMetadataChanged = false
+	return nil
+}
+
+// hashEntries returns the hash table entries of every locale of mpqPath
+// that refer to a block.
+func (a *Archive) hashEntries(mpqPath string) []*hashTableEntry {
+	var entries []*hashTableEntry
+	for _, slot := range a.hashSlots(mpqPath) {
+		entries = append(entries, &a.hashTable[slot])
+	}
+	return entries
+}
+
+// hashSlots returns the hash table indices of the entries hashEntries returns.
+func (a *Archive) hashSlots(mpqPath string) []uint32 {
+	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
+
+	hashA := hashString(mpqPath, hashTypeNameA)
+	hashB := hashString(mpqPath, hashTypeNameB)
+	startIndex := hashString(mpqPath, hashTypeTableOffset) % a.header.HashTableSize
+
+	var slots []uint32
+	for i := uint32(0); i < a.header.HashTableSize; i++ {
+		slot := (startIndex + i) % a.header.HashTableSize
+		entry := &a.hashTable[slot]
+		if entry.BlockIndex == hashTableEmpty {
+			break
+		}
+		if entry.HashA == hashA && entry.HashB == hashB && entry.BlockIndex < uint32(len(a.blockTable)) {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// archiveRegion is a range of archive space.
+type archiveRegion struct {
+	pos  uint64 // Relative to the archive start
+	size uint64
+}
+
+// freeRegions returns the gaps between the data of existing blocks and the
+// reserved regions, sorted by position, and the end of the last of them.
+func (a *Archive) freeRegions(reserved ...archiveRegion) ([]archiveRegion, uint64) {
+	used := append([]archiveRegion(nil), reserved...)
+	for i := range a.blockTable {
+		block := &a.blockTable[i]
+		if block.Flags&fileExists == 0 || block.CompressedSize == 0 {
+			continue
+		}
+		used = append(used, archiveRegion{pos: block.getFilePos64(), size: uint64(block.CompressedSize)})
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].pos < used[j].pos })
+
+	var regions []archiveRegion
+	end := uint64(a.header.HeaderSize)
+	for _, r := range used {
+		if r.pos > end {
+			regions = append(regions, archiveRegion{pos: end, size: r.pos - end})
+		}
+		if r.pos+r.size > end {
+			end = r.pos + r.size
+		}
+	}
+	return regions, end
+}
+
+// spaceAllocator hands out archive space for new blocks, first from free
+// regions and then after the last block.
+type spaceAllocator struct {
+	regions []archiveRegion
+	end     uint64
+}
+
+// alloc returns the position for size bytes.
+func (s *spaceAllocator) alloc(size uint64) uint64 {
+	if size == 0 {
+		return s.end
+	}
+	for i := range s.regions {
+		region := &s.regions[i]
+		if region.size >= size {
+			pos := region.pos
+			region.pos += size
+			region.size -= size
+			return pos
+		}
+	}
+	pos := s.end
+	s.end += size
+	return pos
+}
+
+// storeSpecialFile returns the stored form of a special file and its block
+// flags, compressing it if that makes it smaller.
+func storeSpecialFile(data []byte) ([]byte, uint32, error) {
+	compressed, err := compressData(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(compressed) < len(data) {
+		return compressed, fileExists | fileSingleUnit | fileCompress, nil
+	}
+	return data, fileExists | fileSingleUnit, nil
+}
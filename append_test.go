@@ -0,0 +1,305 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenForAppend(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_append_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Incompressible, so its block leaves a gap the new files fit in
+	doomed := make([]byte, 8192)
+	seed := uint32(1)
+	for i := range doomed {
+		seed = seed*1103515245 + 12345
+		doomed[i] = byte(seed >> 16)
+	}
+	large := bytes.Repeat([]byte("sectored data "), 2000)
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	add := func(archive *Archive, data []byte, name string, opts FileOptions) {
+		t.Helper()
+		if err := archive.AddFileData(data, name, opts); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	add(archive, doomed, "Data\\doomed.txt", FileOptions{})
+	add(archive, []byte("old"), "Data\\replaced.txt", FileOptions{})
+	add(archive, large, "Data\\fixkey.bin", FileOptions{FixKey: true, SectorCRC: true})
+	add(archive, []byte("Deutsch"), "Data\\German.txt", FileOptions{Locale: 0x407})
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	before, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	doomedBlock, _ := before.findFile("Data\\doomed.txt")
+	doomedPos, doomedEnd := doomedBlock.getFilePos64(), doomedBlock.getFilePos64()+uint64(doomedBlock.CompressedSize)
+	keptBlock, _ := before.findFile("Data\\fixkey.bin")
+	kept := *keptBlock
+	before.Close()
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	if err := archive.RemoveFile("Data\\doomed.txt"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	add(archive, []byte("new"), "Data\\replaced.txt", FileOptions{})
+	add(archive, []byte("English"), "Data\\German.txt", FileOptions{})
+	add(archive, large, "Data\\added.bin", FileOptions{FixKey: true, Compression: CompressionBzip2})
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	after, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer after.Close()
+
+	if after.HasFile("Data\\doomed.txt") {
+		t.Error("removed file is still present")
+	}
+	for name, want := range map[string][]byte{
+		"Data\\replaced.txt": []byte("new"),
+		"Data\\fixkey.bin":   large,
+		"Data\\added.bin":    large,
+	} {
+		data, err := after.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: contents = %q", name, data[:min(len(data), 16)])
+		}
+	}
+
+	var locales []uint16
+	for _, entry := range after.hashEntries("Data\\German.txt") {
+		locales = append(locales, entry.Locale)
+	}
+	if len(locales) != 2 {
+		t.Errorf("German.txt locales = %v, want neutral and 0x407", locales)
+	}
+
+	block, _ := after.findFile("Data\\fixkey.bin")
+	if *block != kept {
+		t.Errorf("untouched block moved: %+v, was %+v", *block, kept)
+	}
+	block, _ = after.findFile("Data\\added.bin")
+	if pos := block.getFilePos64(); pos < doomedPos || pos+uint64(block.CompressedSize) > doomedEnd {
+		t.Errorf("added file at %d, want it in the freed space at %d-%d", pos, doomedPos, doomedEnd)
+	}
+
+	files, err := after.ListFiles()
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	want := []string{"Data\\replaced.txt", "Data\\fixkey.bin", "Data\\German.txt", "Data\\added.bin"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	report, err := after.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("verify failed: %+v", report)
+	}
+}
+
+func TestOpenForAppendHashTableFull(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_append_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 4)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileData([]byte("kept"), "Data\\kept.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	original, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("Data\\file%d.txt", i)
+		if err := archive.AddFileData([]byte(name), name, FileOptions{}); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err == nil {
+		t.Fatal("expected an error for a full hash table")
+	}
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("archive changed after a failed append")
+	}
+}
+
+func TestOpenForAppendUnchanged(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_append_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	key := testWeakKey
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileData([]byte("kept"), "Data\\kept.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.SetWeakSigningKey(key); err != nil {
+		t.Fatalf("set signing key: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	original, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	if _, err := archive.ReadFile("Data\\kept.txt"); err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Errorf("archive changed from %d to %d bytes without changes", len(original), len(data))
+	}
+}
+
+func TestOpenForAppendKeepsAttributes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_append_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileData([]byte("kept"), "Data\\kept.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	// Replace (attributes) with one storing MD5s and patch bits but no
+	// CRC32s, as other tools may write
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	keptIndex := archive.hashEntries("Data\\kept.txt")[0].BlockIndex
+	source := newFileAttributes(attributesFlagMD5|attributesFlagPatchBit, len(archive.blockTable))
+	source.set(int(keptIndex), 0, 0, md5.Sum([]byte("kept")), true)
+	sourceData := source.encode()
+	stat, err := archive.file.Stat()
+	if err != nil {
+		t.Fatalf("stat archive: %v", err)
+	}
+	if _, err := archive.file.WriteAt(sourceData, stat.Size()); err != nil {
+		t.Fatalf("write attributes: %v", err)
+	}
+	block, _ := archive.findFile("(attributes)")
+	*block = blockTableEntryEx{}
+	block.setFilePos64(uint64(stat.Size()) - archive.header.ArchiveOffset)
+	block.CompressedSize = uint32(len(sourceData))
+	block.FileSize = uint32(len(sourceData))
+	block.Flags = fileExists | fileSingleUnit
+
+	if err := archive.AddFileData([]byte("added"), "Data\\added.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	after, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer after.Close()
+
+	attrs, err := after.readAttributes()
+	if err != nil || attrs == nil {
+		t.Fatalf("read attributes: %v", err)
+	}
+	if attrs.md5 == nil || attrs.patchBit == nil || attrs.crc32 == nil {
+		t.Fatalf("attributes flags = 0x%X, want CRC32, MD5 and patch bit", attrs.flags)
+	}
+	addedIndex := after.hashEntries("Data\\added.txt")[0].BlockIndex
+	if attrs.md5[keptIndex] != md5.Sum([]byte("kept")) || !attrs.patchBit[keptIndex] || attrs.crc32[keptIndex] != 0 {
+		t.Errorf("kept.txt attributes = %x, %v, 0x%08X", attrs.md5[keptIndex], attrs.patchBit[keptIndex], attrs.crc32[keptIndex])
+	}
+	if attrs.md5[addedIndex] != md5.Sum([]byte("added")) || attrs.patchBit[addedIndex] || attrs.crc32[addedIndex] != crc32([]byte("added")) {
+		t.Errorf("added.txt attributes = %x, %v, 0x%08X", attrs.md5[addedIndex], attrs.patchBit[addedIndex], attrs.crc32[addedIndex])
+	}
+
+	report, err := after.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("verify failed: %+v", report)
+	}
+}
@@ -3,15 +3,26 @@
 
 package mpq
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
 
 const (
-	attributesVersion   = 100
-	attributesFlagCRC32 = 0x00000001
+	attributesVersion      = 100
+	attributesFlagCRC32    = 0x00000001
+	attributesFlagFileTime = 0x00000002
+	attributesFlagMD5      = 0x00000004
+	attributesFlagPatchBit = 0x00000008
+
+	// Number of 100-nanosecond intervals between 1601-01-01 and 1970-01-01
+	filetimeUnixEpoch = 116444736000000000
 )
 
 type attributesWriter struct {
-	crc32 []uint32
+	crc32    []uint32
+	fileTime []uint64 // nil unless file times are written
 }
 
 func newAttributesWriter(fileCount int) *attributesWriter {
@@ -20,6 +31,11 @@ func newAttributesWriter(fileCount int) *attributesWriter {
 	}
 }
 
+// enableFileTime makes build include a FILETIME for every entry.
+func (a *attributesWriter) enableFileTime() {
+	a.fileTime = make([]uint64, len(a.crc32))
+}
+
 func (a *attributesWriter) setEntry(index int, data []byte) {
 	if index < 0 || index >= len(a.crc32) {
 		return
@@ -32,20 +48,266 @@ func (a *attributesWriter) setEntry(index int, data []byte) {
 	}
 }
 
+// setCRC32 sets the CRC32 of an entry whose data is not at hand.
+func (a *attributesWriter) setCRC32(index int, value uint32) {
+	if index < 0 || index >= len(a.crc32) {
+		return
+	}
+	a.crc32[index] = value
+}
+
+// setFileTime sets the FILETIME of an entry if file times are enabled.
+func (a *attributesWriter) setFileTime(index int, fileTime uint64) {
+	if index < 0 || index >= len(a.fileTime) {
+		return
+	}
+	a.fileTime[index] = fileTime
+}
+
 func (a *attributesWriter) build() ([]byte, error) {
 	if len(a.crc32) == 0 {
 		return nil, nil
 	}
 
-	data := make([]byte, 8+len(a.crc32)*4)
+	flags := uint32(attributesFlagCRC32)
+	entrySize := 4
+	if a.fileTime != nil {
+		flags |= attributesFlagFileTime
+		entrySize += 8
+	}
+
+	data := make([]byte, 8+len(a.crc32)*entrySize)
 	binary.LittleEndian.PutUint32(data[0:4], attributesVersion)
-	binary.LittleEndian.PutUint32(data[4:8], attributesFlagCRC32)
+	binary.LittleEndian.PutUint32(data[4:8], flags)
 
 	offset := 8
 	for _, value := range a.crc32 {
 		binary.LittleEndian.PutUint32(data[offset:offset+4], value)
 		offset += 4
 	}
+	for _, value := range a.fileTime {
+		binary.LittleEndian.PutUint64(data[offset:offset+8], value)
+		offset += 8
+	}
 
 	return data, nil
 }
+
+// fileAttributes holds the parsed contents of the (attributes) special file.
+// Each slice is indexed by block table index and is nil if the archive does
+// not store that attribute.
+type fileAttributes struct {
+	flags    uint32
+	crc32    []uint32
+	fileTime []uint64
+	md5      [][16]byte
+	patchBit []bool
+}
+
+// newFileAttributes returns zeroed attributes for count blocks storing the
+// columns in flags.
+func newFileAttributes(flags uint32, count int) *fileAttributes {
+	f := &fileAttributes{flags: flags}
+	if flags&attributesFlagCRC32 != 0 {
+		f.crc32 = make([]uint32, count)
+	}
+	if flags&attributesFlagFileTime != 0 {
+		f.fileTime = make([]uint64, count)
+	}
+	if flags&attributesFlagMD5 != 0 {
+		f.md5 = make([][16]byte, count)
+	}
+	if flags&attributesFlagPatchBit != 0 {
+		f.patchBit = make([]bool, count)
+	}
+	return f
+}
+
+// parseAttributes parses (attributes) data for an archive with blockCount blocks.
+// Some archives omit the entry for the (attributes) file itself, so a table
+// one entry short is accepted.
+func parseAttributes(data []byte, blockCount int) (*fileAttributes, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("attributes too small: %d bytes", len(data))
+	}
+
+	version := binary.LittleEndian.Uint32(data[0:4])
+	if version != attributesVersion {
+		return nil, fmt.Errorf("unsupported attributes version: %d", version)
+	}
+	flags := binary.LittleEndian.Uint32(data[4:8])
+
+	entrySize := attributesEntrySize(flags)
+	count := blockCount
+	if entrySize > 0 && 8+count*entrySize > len(data) {
+		count = blockCount - 1
+	}
+	if count < 0 || 8+count*entrySize > len(data) {
+		return nil, fmt.Errorf("attributes truncated: %d bytes for %d blocks", len(data), blockCount)
+	}
+
+	attrs := newFileAttributes(flags, count)
+	offset := 8
+	for i := range attrs.crc32 {
+		attrs.crc32[i] = binary.LittleEndian.Uint32(data[offset : offset+4])
+		offset += 4
+	}
+	for i := range attrs.fileTime {
+		attrs.fileTime[i] = binary.LittleEndian.Uint64(data[offset : offset+8])
+		offset += 8
+	}
+	for i := range attrs.md5 {
+		copy(attrs.md5[i][:], data[offset:offset+16])
+		offset += 16
+	}
+	// The patch bits are packed most significant bit first. Some writers
+	// store a byte less than the table needs; missing bits are clear.
+	for i := range attrs.patchBit {
+		if offset+i/8 < len(data) {
+			attrs.patchBit[i] = data[offset+i/8]&(0x80>>(i%8)) != 0
+		}
+	}
+
+	return attrs, nil
+}
+
+// attributesEntrySize returns the bytes each block takes in the CRC32,
+// FILETIME and MD5 columns selected by flags.
+func attributesEntrySize(flags uint32) int {
+	size := 0
+	if flags&attributesFlagCRC32 != 0 {
+		size += 4
+	}
+	if flags&attributesFlagFileTime != 0 {
+		size += 8
+	}
+	if flags&attributesFlagMD5 != 0 {
+		size += 16
+	}
+	return size
+}
+
+// grow adds a zeroed entry to every column f stores.
+func (f *fileAttributes) grow() {
+	if f.crc32 != nil {
+		f.crc32 = append(f.crc32, 0)
+	}
+	if f.fileTime != nil {
+		f.fileTime = append(f.fileTime, 0)
+	}
+	if f.md5 != nil {
+		f.md5 = append(f.md5, [16]byte{})
+	}
+	if f.patchBit != nil {
+		f.patchBit = append(f.patchBit, false)
+	}
+}
+
+// set stores the values of entry index in the columns f stores.
+func (f *fileAttributes) set(index int, crc uint32, fileTime uint64, sum [16]byte, patch bool) {
+	if index < len(f.crc32) {
+		f.crc32[index] = crc
+	}
+	if index < len(f.fileTime) {
+		f.fileTime[index] = fileTime
+	}
+	if index < len(f.md5) {
+		f.md5[index] = sum
+	}
+	if index < len(f.patchBit) {
+		f.patchBit[index] = patch
+	}
+}
+
+// encode returns the (attributes) data for f. Columns shorter than the
+// longest one are padded with zeros.
+func (f *fileAttributes) encode() []byte {
+	count := max(len(f.crc32), len(f.fileTime), len(f.md5), len(f.patchBit))
+	order := make([]int, count)
+	for i := range order {
+		order[i] = i
+	}
+	return f.reorder(order)
+}
+
+// reorder returns (attributes) data whose entry i is entry order[i] of f,
+// keeping the attributes f stores. Missing entries are written as zeros.
+func (f *fileAttributes) reorder(order []int) []byte {
+	flags := f.flags & (attributesFlagCRC32 | attributesFlagFileTime | attributesFlagMD5 | attributesFlagPatchBit)
+	size := 8 + len(order)*attributesEntrySize(flags)
+	if flags&attributesFlagPatchBit != 0 {
+		size += (len(order) + 7) / 8
+	}
+
+	data := make([]byte, size)
+	binary.LittleEndian.PutUint32(data[0:4], attributesVersion)
+	binary.LittleEndian.PutUint32(data[4:8], flags)
+
+	offset := 8
+	if flags&attributesFlagCRC32 != 0 {
+		for _, index := range order {
+			if index < len(f.crc32) {
+				binary.LittleEndian.PutUint32(data[offset:], f.crc32[index])
+			}
+			offset += 4
+		}
+	}
+	if flags&attributesFlagFileTime != 0 {
+		for _, index := range order {
+			if index < len(f.fileTime) {
+				binary.LittleEndian.PutUint64(data[offset:], f.fileTime[index])
+			}
+			offset += 8
+		}
+	}
+	if flags&attributesFlagMD5 != 0 {
+		for _, index := range order {
+			if index < len(f.md5) {
+				copy(data[offset:offset+16], f.md5[index][:])
+			}
+			offset += 16
+		}
+	}
+	if flags&attributesFlagPatchBit != 0 {
+		for i, index := range order {
+			if index < len(f.patchBit) && f.patchBit[index] {
+				data[offset+i/8] |= 0x80 >> (i % 8)
+			}
+		}
+	}
+	return data
+}
+
+// readAttributes reads and parses the (attributes) special file.
+// Returns nil if the archive has no attributes.
+func (a *Archive) readAttributes() (*fileAttributes, error) {
+	if _, err := a.findFile("(attributes)"); err != nil {
+		return nil, nil // Attributes are optional
+	}
+
+	data, err := a.readFile("(attributes)")
+	if err != nil {
+		return nil, fmt.Errorf("read attributes: %w", err)
+	}
+
+	return parseAttributes(data, len(a.blockTable))
+}
+
+// filetimeToTime converts a Windows FILETIME to a time.Time.
+// A zero FILETIME yields the zero time.
+func filetimeToTime(ft uint64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+	intervals := int64(ft - filetimeUnixEpoch)
+	return time.Unix(intervals/10000000, (intervals%10000000)*100).UTC()
+}
+
+// timeToFiletime converts a time.Time to a Windows FILETIME.
+// The zero time yields a zero FILETIME.
+func timeToFiletime(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano()/100 + filetimeUnixEpoch)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// createBSDIFF40 produces a Blizzard BSDIFF40 delta from old to new (see
+// applyBSDIFF40). Matches are found with Colin Percival's bsdiff algorithm
+// over a suffix array of old; unlike upstream bsdiff the blocks are stored
+// uncompressed.
+func createBSDIFF40(old, new []byte) []byte {
+	suffixes := qsufsort(old)
+
+	var ctrl, diff, extra bytes.Buffer
+	addControl := func(add, copyLen, seek int) {
+		s := uint32(seek)
+		if seek < 0 {
+			s = uint32(-seek) | 0x80000000
+		}
+		binary.Write(&ctrl, binary.LittleEndian, [3]uint32{uint32(add), uint32(copyLen), s})
+	}
+
+	scan, length, pos := 0, 0, 0
+	lastScan, lastPos, lastOffset := 0, 0, 0
+	for scan < len(new) {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < len(new); scan++ {
+			pos, length = searchSuffixes(suffixes, old, new[scan:])
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < len(old) && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+			if scan+lastOffset < len(old) && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != len(new) {
+			continue
+		}
+
+		// Extend the previous match forwards and this one backwards
+		lenf := 0
+		for i, s, best := 0, 0, 0; lastScan+i < scan && lastPos+i < len(old); {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > best*2-lenf {
+				best, lenf = s, i
+			}
+		}
+
+		lenb := 0
+		if scan < len(new) {
+			for i, s, best := 1, 0, 0; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > best*2-lenb {
+					best, lenb = s, i
+				}
+			}
+		}
+
+		// Split any overlap where it scores best
+		if lastScan+lenf > scan-lenb {
+			overlap := lastScan + lenf - (scan - lenb)
+			s, best, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lenf-overlap+i] == old[lastPos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > best {
+					best, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		for i := 0; i < lenf; i++ {
+			diff.WriteByte(new[lastScan+i] - old[lastPos+i])
+		}
+		extraLen := (scan - lenb) - (lastScan + lenf)
+		extra.Write(new[lastScan+lenf : lastScan+lenf+extraLen])
+		addControl(lenf, extraLen, (pos-lenb)-(lastPos+lenf))
+
+		lastScan = scan - lenb
+		lastPos = pos - lenb
+		lastOffset = pos - scan
+	}
+
+	var out bytes.Buffer
+	out.WriteString(bsdiffSignature)
+	binary.Write(&out, binary.LittleEndian, [3]uint64{uint64(ctrl.Len()), uint64(diff.Len()), uint64(len(new))})
+	out.Write(ctrl.Bytes())
+	out.Write(diff.Bytes())
+	out.Write(extra.Bytes())
+	return out.Bytes()
+}
+
+// searchSuffixes finds the longest match for target among the suffixes of
+// old, returning its position and length.
+func searchSuffixes(suffixes []int, old, target []byte) (int, int) {
+	st, en := 0, len(old)
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		n := min(len(old)-suffixes[x], len(target))
+		if bytes.Compare(old[suffixes[x]:suffixes[x]+n], target[:n]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+
+	x := matchLen(old[suffixes[st]:], target)
+	y := matchLen(old[suffixes[en]:], target)
+	if x > y {
+		return suffixes[st], x
+	}
+	return suffixes[en], y
+}
+
+func matchLen(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// qsufsort builds the suffix array of buf (including the empty suffix) with
+// Larsson and Sadakane's algorithm, as used by bsdiff.
+func qsufsort(buf []byte) []int {
+	n := len(buf)
+	I := make([]int, n+1)
+	V := make([]int, n+1)
+
+	var buckets [256]int
+	for _, c := range buf {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, c := range buf {
+		buckets[c]++
+		I[buckets[c]] = i
+	}
+	I[0] = n
+	for i, c := range buf {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := 1; I[0] != -(n + 1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				splitSuffixes(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = i
+	}
+	return I
+}
+
+// splitSuffixes sorts the group I[start:start+length] by the rank h
+// positions further on, ternary quicksort style.
+func splitSuffixes(I, V []int, start, length, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := V[I[k]+h]
+			for i := 1; k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	jj, kk := 0, 0
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, 0, 0
+	for i < jj {
+		if V[I[i]+h] < x {
+			i++
+		} else if V[I[i]+h] == x {
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		} else {
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		splitSuffixes(I, V, start, jj-start, h)
+	}
+	for i := 0; i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		splitSuffixes(I, V, kk, start+length-kk, h)
+	}
+}
@@ -0,0 +1,513 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"sort"
+)
+
+// The standard library only decompresses bzip2, so this is a small encoder
+// for the MPQ BZip2 compression (0x10). It produces a standard stream that
+// compress/bzip2 and libbzip2 decode: initial RLE, Burrows-Wheeler
+// transform, move-to-front with zero run-length coding and up to six Huffman
+// tables chosen per 50 symbols.
+const (
+	bzip2Level        = 9
+	bzip2BlockMax     = bzip2Level*100000 - 19
+	bzip2GroupSize    = 50
+	bzip2MaxCodeLen   = 17
+	bzip2Iterations   = 4
+	bzip2BlockMagic   = 0x314159265359
+	bzip2StreamMagic  = 0x177245385090
+	bzip2RunA         = 0
+	bzip2RunB         = 1
+	bzip2MaxRunLength = 255
+)
+
+var bzip2CRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04C11DB7
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+// bzip2BitWriter writes bits most significant first.
+type bzip2BitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nbits uint
+}
+
+func (w *bzip2BitWriter) writeBits(n uint, v uint64) {
+	for n > 0 {
+		take := n
+		if take > 32 {
+			take = 32
+		}
+		n -= take
+		w.acc = w.acc<<take | (v>>n)&(1<<take-1)
+		w.nbits += take
+		for w.nbits >= 8 {
+			w.nbits -= 8
+			w.buf.WriteByte(byte(w.acc >> w.nbits))
+		}
+	}
+}
+
+func (w *bzip2BitWriter) flush() {
+	if w.nbits > 0 {
+		w.buf.WriteByte(byte(w.acc << (8 - w.nbits)))
+		w.nbits = 0
+	}
+}
+
+// compressBzip2 compresses data into a bzip2 stream.
+func compressBzip2(data []byte) []byte {
+	w := &bzip2BitWriter{}
+	w.buf.WriteString("BZh")
+	w.buf.WriteByte('0' + bzip2Level)
+
+	var combinedCRC uint32
+	block := make([]byte, 0, 4096)
+	crc := ^uint32(0)
+	flushBlock := func() {
+		if len(block) == 0 {
+			return
+		}
+		crc = ^crc
+		combinedCRC = (combinedCRC<<1 | combinedCRC>>31) ^ crc
+		writeBzip2Block(w, block, crc)
+		block = block[:0]
+		crc = ^uint32(0)
+	}
+
+	// Initial run-length encoding: runs of 4 to 255 bytes become four bytes
+	// and a count of the remaining repeats
+	for i := 0; i < len(data); {
+		b := data[i]
+		run := 1
+		for i+run < len(data) && run < bzip2MaxRunLength && data[i+run] == b {
+			run++
+		}
+		encoded := run
+		if run >= 4 {
+			encoded = 5
+		}
+		if len(block)+encoded > bzip2BlockMax {
+			flushBlock()
+		}
+
+		for j := 0; j < run; j++ {
+			crc = crc<<8 ^ bzip2CRCTable[byte(crc>>24)^b]
+		}
+		if run >= 4 {
+			block = append(block, b, b, b, b, byte(run-4))
+		} else {
+			for j := 0; j < run; j++ {
+				block = append(block, b)
+			}
+		}
+		i += run
+	}
+	flushBlock()
+
+	w.writeBits(48, bzip2StreamMagic)
+	w.writeBits(32, uint64(combinedCRC))
+	w.flush()
+	return w.buf.Bytes()
+}
+
+// writeBzip2Block writes one compressed block.
+func writeBzip2Block(w *bzip2BitWriter, block []byte, crc uint32) {
+	bwt, origPtr := bzip2BWT(block)
+
+	// Map the bytes in use to a dense alphabet
+	var inUse [256]bool
+	for _, b := range block {
+		inUse[b] = true
+	}
+	var seq [256]byte
+	numInUse := 0
+	for i := 0; i < 256; i++ {
+		if inUse[i] {
+			seq[i] = byte(numInUse)
+			numInUse++
+		}
+	}
+	alphaSize := numInUse + 2
+	eob := uint16(numInUse + 1)
+
+	// Move-to-front with RUNA/RUNB coding of zero runs
+	var mtf [256]byte
+	for i := range mtf {
+		mtf[i] = byte(i)
+	}
+	symbols := make([]uint16, 0, len(bwt)+1)
+	zeroRun := 0
+	flushRun := func() {
+		for zeroRun > 0 {
+			zeroRun--
+			symbols = append(symbols, uint16(bzip2RunA+zeroRun&1))
+			zeroRun >>= 1
+		}
+	}
+	for _, b := range bwt {
+		s := seq[b]
+		if mtf[0] == s {
+			zeroRun++
+			continue
+		}
+		flushRun()
+		j := 1
+		for mtf[j] != s {
+			j++
+		}
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = s
+		symbols = append(symbols, uint16(j+1))
+	}
+	flushRun()
+	symbols = append(symbols, eob)
+
+	lengths, selectors := bzip2Tables(symbols, alphaSize)
+
+	w.writeBits(48, bzip2BlockMagic)
+	w.writeBits(32, uint64(crc))
+	w.writeBits(1, 0) // Not randomized
+	w.writeBits(24, uint64(origPtr))
+
+	// Symbol map: 16 ranges, then the bytes used within each range
+	var ranges uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				ranges |= 1 << (15 - i)
+				break
+			}
+		}
+	}
+	w.writeBits(16, ranges)
+	for i := 0; i < 16; i++ {
+		if ranges&(1<<(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				bits |= 1 << (15 - j)
+			}
+		}
+		w.writeBits(16, bits)
+	}
+
+	// Table count and move-to-front coded selectors in unary
+	w.writeBits(3, uint64(len(lengths)))
+	w.writeBits(15, uint64(len(selectors)))
+	order := []byte{0, 1, 2, 3, 4, 5}
+	for _, sel := range selectors {
+		j := 0
+		for order[j] != sel {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = sel
+		w.writeBits(uint(j+1), 1<<(j+1)-2)
+	}
+
+	// Code lengths as deltas
+	codes := make([][]uint32, len(lengths))
+	for t, table := range lengths {
+		cur := int(table[0])
+		w.writeBits(5, uint64(cur))
+		for _, l := range table {
+			for cur < int(l) {
+				w.writeBits(2, 2)
+				cur++
+			}
+			for cur > int(l) {
+				w.writeBits(2, 3)
+				cur--
+			}
+			w.writeBits(1, 0)
+		}
+		codes[t] = bzip2Codes(table)
+	}
+
+	for i, s := range symbols {
+		t := selectors[i/bzip2GroupSize]
+		w.writeBits(uint(lengths[t][s]), uint64(codes[t][s]))
+	}
+}
+
+// bzip2Tables chooses the Huffman tables and the table used for each group
+// of 50 symbols, refining the tables over a few passes.
+func bzip2Tables(symbols []uint16, alphaSize int) ([][]uint8, []byte) {
+	var numTables int
+	switch n := len(symbols); {
+	case n < 200:
+		numTables = 2
+	case n < 600:
+		numTables = 3
+	case n < 1200:
+		numTables = 4
+	case n < 2400:
+		numTables = 5
+	default:
+		numTables = 6
+	}
+
+	freqs := make([]int, alphaSize)
+	for _, s := range symbols {
+		freqs[s]++
+	}
+
+	// Start with each table covering a slice of the alphabet with a similar
+	// share of the symbols
+	lengths := make([][]uint8, numTables)
+	remaining := len(symbols)
+	start := 0
+	for part := numTables; part > 0; part-- {
+		target := remaining / part
+		end := start - 1
+		sum := 0
+		for sum < target && end < alphaSize-1 {
+			end++
+			sum += freqs[end]
+		}
+		if end > start && part != numTables && part != 1 && (numTables-part)%2 == 1 {
+			sum -= freqs[end]
+			end--
+		}
+
+		table := make([]uint8, alphaSize)
+		for s := range table {
+			if s < start || s > end {
+				table[s] = 15
+			}
+		}
+		lengths[part-1] = table
+		start = end + 1
+		remaining -= sum
+	}
+
+	selectors := make([]byte, (len(symbols)+bzip2GroupSize-1)/bzip2GroupSize)
+	for iter := 0; iter < bzip2Iterations; iter++ {
+		tableFreqs := make([][]int, numTables)
+		for t := range tableFreqs {
+			tableFreqs[t] = make([]int, alphaSize)
+		}
+
+		for g := range selectors {
+			group := symbols[g*bzip2GroupSize : min(len(symbols), (g+1)*bzip2GroupSize)]
+			best, bestCost := 0, -1
+			for t, table := range lengths {
+				cost := 0
+				for _, s := range group {
+					cost += int(table[s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = byte(best)
+			for _, s := range group {
+				tableFreqs[best][s]++
+			}
+		}
+
+		for t := range lengths {
+			lengths[t] = huffmanLengths(tableFreqs[t], bzip2MaxCodeLen)
+		}
+	}
+
+	return lengths, selectors
+}
+
+// huffmanLengths returns Huffman code lengths for freqs no longer than
+// maxLen. Every symbol gets a code, even if it is unused.
+func huffmanLengths(freqs []int, maxLen int) []uint8 {
+	weights := make([]int, len(freqs))
+	for i, f := range freqs {
+		weights[i] = f
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+
+	for {
+		lengths := huffmanTree(weights)
+		longest := uint8(0)
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if int(longest) <= maxLen {
+			return lengths
+		}
+
+		// Flatten the distribution and try again
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+// huffmanTree builds a Huffman tree and returns the depth of each leaf.
+// Leaves are sorted once; merged nodes are created in order of weight, so
+// the two smallest nodes are always at the front of one of the two queues.
+func huffmanTree(weights []int) []uint8 {
+	n := len(weights)
+	leaves := make([]int, n)
+	for i := range leaves {
+		leaves[i] = i
+	}
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return weights[leaves[i]] < weights[leaves[j]]
+	})
+
+	weight := append(make([]int, 0, 2*n), weights...)
+	parent := make([]int, n, 2*n)
+	var merged []int
+	pop := func() int {
+		if len(merged) == 0 || (len(leaves) > 0 && weight[leaves[0]] <= weight[merged[0]]) {
+			node := leaves[0]
+			leaves = leaves[1:]
+			return node
+		}
+		node := merged[0]
+		merged = merged[1:]
+		return node
+	}
+
+	for len(leaves)+len(merged) > 1 {
+		a, b := pop(), pop()
+		node := len(weight)
+		weight = append(weight, weight[a]+weight[b])
+		parent = append(parent, -1)
+		parent[a], parent[b] = node, node
+		merged = append(merged, node)
+	}
+	if n == 1 {
+		return []uint8{1}
+	}
+
+	// Parents are created after their children, so depths can be filled in
+	// from the root down
+	depth := make([]uint8, len(weight))
+	for node := len(weight) - 2; node >= 0; node-- {
+		depth[node] = depth[parent[node]] + 1
+	}
+	return depth[:n]
+}
+
+// bzip2Codes assigns canonical codes: shorter codes first, then by symbol.
+func bzip2Codes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	code := uint32(0)
+	for l := uint8(1); l <= 20; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
+
+// bzip2BWT returns the Burrows-Wheeler transform of block and the row of
+// the original string among its sorted rotations.
+func bzip2BWT(block []byte) ([]byte, int) {
+	n := len(block)
+	rotations := sortRotations(block)
+
+	out := make([]byte, n)
+	origPtr := 0
+	for i, r := range rotations {
+		if r == 0 {
+			origPtr = i
+			out[i] = block[n-1]
+		} else {
+			out[i] = block[r-1]
+		}
+	}
+	return out, origPtr
+}
+
+// sortRotations sorts the cyclic rotations of data by prefix doubling with
+// counting sorts, in O(n log n).
+func sortRotations(data []byte) []int32 {
+	n := len(data)
+	order := make([]int32, n)
+	class := make([]int32, n)
+	count := make([]int32, max(n, 256))
+
+	for _, b := range data {
+		count[b]++
+	}
+	for i := 1; i < 256; i++ {
+		count[i] += count[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		count[data[i]]--
+		order[count[data[i]]] = int32(i)
+	}
+	classes := int32(1)
+	for i := 1; i < n; i++ {
+		if data[order[i]] != data[order[i-1]] {
+			classes++
+		}
+		class[order[i]] = classes - 1
+	}
+
+	shifted := make([]int32, n)
+	next := make([]int32, n)
+	for h := 1; h < n && int(classes) < n; h <<= 1 {
+		// Sorted by the second half already; stable sort by the first half
+		for i, r := range order {
+			s := int(r) - h
+			if s < 0 {
+				s += n
+			}
+			shifted[i] = int32(s)
+		}
+		for i := range count[:classes] {
+			count[i] = 0
+		}
+		for _, s := range shifted {
+			count[class[s]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			count[i] += count[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			s := shifted[i]
+			count[class[s]]--
+			order[count[class[s]]] = s
+		}
+
+		next[order[0]] = 0
+		classes = 1
+		for i := 1; i < n; i++ {
+			cur, prev := int(order[i]), int(order[i-1])
+			if class[cur] != class[prev] || class[(cur+h)%n] != class[(prev+h)%n] {
+				classes++
+			}
+			next[cur] = classes - 1
+		}
+		class, next = next, class
+	}
+
+	return order
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressBzip2(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	r.Read(random)
+	small := make([]byte, 1200000) // More than one block
+	for i := range small {
+		small[i] = byte(r.Intn(8))
+	}
+
+	tests := map[string][]byte{
+		"empty":    nil,
+		"single":   {42},
+		"runs":     append(bytes.Repeat([]byte{1}, 1000), bytes.Repeat([]byte{2}, 3)...),
+		"periodic": bytes.Repeat([]byte("ab"), 5000),
+		"text":     bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 2000),
+		"random":   random,
+		"blocks":   small,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			compressed := compressBzip2(data)
+			got, err := io.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("round trip mismatch: got %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
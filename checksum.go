@@ -14,3 +14,13 @@ func adler32(data []byte) uint32 {
 	}
 	return (b << 16) | a
 }
+
+// sectorCRCMatches reports whether a stored sector checksum matches a sector.
+// A zero checksum means "not computed". This package checksums the uncompressed
+// sector, while StormLib checksums the stored (compressed) bytes, so both are accepted.
+func sectorCRCMatches(expected uint32, stored, decoded []byte) bool {
+	if expected == 0 {
+		return true
+	}
+	return adler32(decoded) == expected || adler32(stored) == expected
+}
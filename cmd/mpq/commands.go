@@ -0,0 +1,500 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	mpq "github.com/suprsokr/go-mpq"
+)
+
+// fileEntry is the JSON form of an archive entry.
+type fileEntry struct {
+	Path           string `json:"path"`
+	Archive        string `json:"archive"`
+	Size           uint32 `json:"size"`
+	CompressedSize uint32 `json:"compressed_size"`
+	Flags          string `json:"flags"`
+}
+
+// extractResult is the JSON form of an extracted file.
+type extractResult struct {
+	Path   string `json:"path"`
+	Output string `json:"output"`
+	Size   int    `json:"size"`
+}
+
+func runList(args []string) error {
+	flags := newFlagSet("list", "[-json] [-p patch]... <archive> [pattern...]")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	var patches stringList
+	flags.Var(&patches, "p", "patch archive to apply on top (repeatable)")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	src, err := openSource(flags.Arg(0), patches)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	patterns := flags.Args()[1:]
+	if !*jsonOut {
+		files, err := globAll(src, patterns)
+		if err != nil {
+			return err
+		}
+		for _, name := range files {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	if len(patterns) == 0 {
+		patterns = []string{"**"}
+	}
+	seen := make(map[string]bool)
+	entries := []fileEntry{}
+	for _, pattern := range patterns {
+		var walkErr error
+		src.Walk(pattern)(func(info *mpq.FileInfo, err error) bool {
+			if err != nil {
+				walkErr = err
+				return false
+			}
+			if key := strings.ToUpper(info.Path); !seen[key] {
+				seen[key] = true
+				entries = append(entries, fileEntry{
+					Path:           info.Path,
+					Archive:        info.ArchivePath,
+					Size:           info.FileSize,
+					CompressedSize: info.CompressedSize,
+					Flags:          info.Flags.String(),
+				})
+			}
+			return true
+		})
+		if walkErr != nil {
+			return walkErr
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return printJSON(entries)
+}
+
+func runExtract(args []string) error {
+	flags := newFlagSet("extract", "[-o dir] [-stdout] [-json] [-p patch]... <archive> [pattern...]")
+	outDir := flags.String("o", ".", "output directory")
+	toStdout := flags.Bool("stdout", false, "write file contents to stdout instead of files")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	var patches stringList
+	flags.Var(&patches, "p", "patch archive to apply on top (repeatable)")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+	if *toStdout && *jsonOut {
+		return fmt.Errorf("-stdout and -json cannot be combined")
+	}
+
+	src, err := openSource(flags.Arg(0), patches)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	patterns := flags.Args()[1:]
+	selected, err := globAll(src, patterns)
+	if err != nil {
+		return err
+	}
+	if len(patterns) > 0 && len(selected) == 0 {
+		return fmt.Errorf("no files match %s", strings.Join(patterns, " "))
+	}
+
+	var results []extractResult
+	for _, name := range selected {
+		data, err := src.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		if *toStdout {
+			if _, err := os.Stdout.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		destPath, err := outputPath(*outDir, name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return fmt.Errorf("create directory: %w", err)
+		}
+		if err := os.WriteFile(destPath, data, 0644); err != nil {
+			return fmt.Errorf("write %s: %w", destPath, err)
+		}
+
+		if *jsonOut {
+			results = append(results, extractResult{Path: name, Output: destPath, Size: len(data)})
+		} else {
+			fmt.Println(destPath)
+		}
+	}
+
+	if *jsonOut {
+		if results == nil {
+			results = []extractResult{}
+		}
+		return printJSON(results)
+	}
+	return nil
+}
+
+// outputPath maps an MPQ path to a path below dir, rejecting paths that
+// would escape it.
+func outputPath(dir, mpqPath string) (string, error) {
+	rel := filepath.FromSlash(strings.ReplaceAll(mpqPath, "\\", "/"))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to extract %q outside the output directory", mpqPath)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+func runAdd(args []string) error {
+	flags := newFlagSet("add", "[-crc] [-as path | -root dir] [-v2] [-max n] [-inplace] [-json] <archive> <file>...")
+	withCRC := flags.Bool("crc", false, "generate sector CRCs")
+	inPlace := flags.Bool("inplace", false, "write changes in place instead of rewriting the archive")
+	as := flags.String("as", "", "path inside the archive (single file only)")
+	root := flags.String("root", "", "store files at their path relative to this directory")
+	v2 := flags.Bool("v2", false, "use the V2 format when creating a new archive")
+	maxFiles := flags.Int("max", 1024, "maximum number of files when creating a new archive")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+
+	srcFiles := flags.Args()[1:]
+	if *as != "" && len(srcFiles) != 1 {
+		return fmt.Errorf("-as requires exactly one file")
+	}
+	if *as != "" && *root != "" {
+		return fmt.Errorf("-as and -root cannot be combined")
+	}
+
+	added := make([]string, len(srcFiles))
+	for i, srcPath := range srcFiles {
+		added[i] = *as
+		if added[i] == "" {
+			mpqPath, err := sourceMpqPath(*root, srcPath)
+			if err != nil {
+				return err
+			}
+			added[i] = mpqPath
+		}
+	}
+
+	archive, err := openOrCreate(flags.Arg(0), *maxFiles, *v2, *inPlace)
+	if err != nil {
+		return err
+	}
+
+	for i, srcPath := range srcFiles {
+		if err := archive.AddFileWithOptions(srcPath, added[i], *withCRC); err != nil {
+			archive.Abort()
+			return fmt.Errorf("%s: %w", srcPath, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return report(*jsonOut, "added", added)
+}
+
+// sourceMpqPath returns the archive path for a file added without -as: its
+// path relative to root, or its base name if root is empty.
+func sourceMpqPath(root, srcPath string) (string, error) {
+	rel := filepath.Base(srcPath)
+	if root != "" {
+		var err error
+		if rel, err = filepath.Rel(root, srcPath); err != nil {
+			return "", fmt.Errorf("%s: %w", srcPath, err)
+		}
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("refusing to add %q outside the root directory", srcPath)
+	}
+	return strings.ReplaceAll(filepath.ToSlash(rel), "/", "\\"), nil
+}
+
+// openOrCreate opens an archive for modification, creating it if it does not exist.
+func openOrCreate(path string, maxFiles int, v2, inPlace bool) (*mpq.Archive, error) {
+	if _, err := os.Stat(path); err == nil {
+		return openForChange(path, inPlace)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return mpq.CreateWithVersion(path, maxFiles, formatVersion(v2))
+}
+
+// openForChange opens an existing archive for modification, in place if
+// inPlace is set.
+func openForChange(path string, inPlace bool) (*mpq.Archive, error) {
+	if inPlace {
+		return mpq.OpenForAppend(path)
+	}
+	return mpq.OpenForModify(path)
+}
+
+func runRemove(args []string) error {
+	flags := newFlagSet("rm", "[-inplace] [-json] <archive> <path>...")
+	inPlace := flags.Bool("inplace", false, "write changes in place instead of rewriting the archive")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+
+	archive, err := openForChange(flags.Arg(0), *inPlace)
+	if err != nil {
+		return err
+	}
+
+	removed := flags.Args()[1:]
+	for _, mpqPath := range removed {
+		if err := archive.RemoveFile(mpqPath); err != nil {
+			archive.Abort()
+			return fmt.Errorf("%s: %w", mpqPath, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return report(*jsonOut, "removed", removed)
+}
+
+func runInfo(args []string) error {
+	flags := newFlagSet("info", "[-json] [-blocks] <archive>")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	showBlocks := flags.Bool("blocks", false, "list block table entries")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	archive, err := mpq.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	info, err := archive.Info()
+	if err != nil {
+		return err
+	}
+	if !*showBlocks {
+		info.Blocks = nil
+	}
+
+	if *jsonOut {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Format version:     %d\n", info.FormatVersion+1)
+	fmt.Printf("Header size:        %d\n", info.HeaderSize)
+	fmt.Printf("Sector size:        %d\n", info.SectorSize)
+	fmt.Printf("Archive offset:     0x%X\n", info.ArchiveOffset)
+	fmt.Printf("Archive size:       %d\n", info.ArchiveSize)
+	fmt.Printf("Hash table:         offset 0x%X, %d entries, %d used, %d deleted (%.1f%% full)\n",
+		info.HashTableOffset, info.HashTableSize, info.HashTableUsed, info.HashTableDeleted, info.HashTableFill*100)
+	fmt.Printf("Block table:        offset 0x%X, %d entries\n", info.BlockTableOffset, info.BlockTableSize)
+	if info.HiBlockTableOffset != 0 {
+		fmt.Printf("Hi-block table:     offset 0x%X\n", info.HiBlockTableOffset)
+	}
+	if info.UserData != nil {
+		fmt.Printf("User data:          offset 0x%X, %d bytes, header at +0x%X\n",
+			info.UserData.Offset, info.UserData.UserDataSize, info.UserData.HeaderOffset)
+	}
+
+	for _, block := range info.Blocks {
+		fmt.Printf("%6d  0x%08X  %10d  %10d  %s\n",
+			block.Index, block.Offset, block.CompressedSize, block.FileSize, block.Flags)
+	}
+	return nil
+}
+
+func runCompact(args []string) error {
+	flags := newFlagSet("compact", "[-order position|directory|extension] [-max n] [-n] [-json] <archive>")
+	order := flags.String("order", "position", "data order: position, directory or extension")
+	maxFiles := flags.Int("max", 0, "resize the hash table for this many files (0 keeps its size)")
+	dryRun := flags.Bool("n", false, "only report the free space")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	orders := map[string]mpq.CompactOrder{
+		"position":  mpq.CompactByPosition,
+		"directory": mpq.CompactByDirectory,
+		"extension": mpq.CompactByExtension,
+	}
+	compactOrder, ok := orders[*order]
+	if !ok {
+		return fmt.Errorf("unknown order %q", *order)
+	}
+
+	if *dryRun {
+		archive, err := mpq.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		space, err := archive.FreeSpace()
+		if err != nil {
+			return err
+		}
+		if *jsonOut {
+			return printJSON(space)
+		}
+		fmt.Printf("Gaps:               %d bytes in %d gaps\n", space.GapBytes, space.Gaps)
+		fmt.Printf("Orphaned blocks:    %d bytes in %d blocks\n", space.OrphanedBytes, space.OrphanedBlocks)
+		fmt.Printf("Free block entries: %d\n", space.FreeEntries)
+		return nil
+	}
+
+	archive, err := mpq.OpenForAppend(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	compactReport, err := archive.Compact(mpq.CompactOptions{Order: compactOrder, MaxFiles: *maxFiles})
+	if err != nil {
+		archive.Abort()
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		return printJSON(compactReport)
+	}
+	fmt.Printf("compacted %d blocks, %d -> %d bytes\n", compactReport.Blocks, compactReport.OldSize, compactReport.NewSize)
+	return nil
+}
+
+func runVerify(args []string) error {
+	flags := newFlagSet("verify", "[-json] <archive>")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return err
+	}
+
+	archive, err := mpq.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	verifyReport, err := archive.Verify(mpq.VerifyOptions{})
+	if err != nil {
+		return err
+	}
+
+	if *jsonOut {
+		if err := printJSON(verifyReport); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range verifyReport.Problems {
+			fmt.Println(problem)
+		}
+		for _, file := range verifyReport.Files {
+			name := file.Name
+			if name == "" {
+				name = fmt.Sprintf("block %d", file.BlockIndex)
+			}
+			for _, fileErr := range file.Errors {
+				fmt.Printf("%s: %s\n", name, fileErr)
+			}
+		}
+		if verifyReport.OK() {
+			fmt.Printf("OK (%d files)\n", len(verifyReport.Files))
+		}
+	}
+
+	if !verifyReport.OK() {
+		return fmt.Errorf("archive failed verification")
+	}
+	return nil
+}
+
+func runCreate(args []string) error {
+	flags := newFlagSet("create", "[-crc] [-v2] [-manifest file] [-json] <archive> <dir>")
+	withCRC := flags.Bool("crc", false, "generate sector CRCs (without a manifest)")
+	v2 := flags.Bool("v2", false, "use the V2 format")
+	manifestPath := flags.String("manifest", "", "JSON manifest mapping files to archive paths and options")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	if err := parseFlags(flags, args, 2); err != nil {
+		return err
+	}
+
+	opts := mpq.BuildOptions{Version: formatVersion(*v2)}
+	if *manifestPath != "" {
+		manifest, err := mpq.LoadManifest(*manifestPath)
+		if err != nil {
+			return err
+		}
+		opts.Manifest = manifest
+	} else if *withCRC {
+		opts.Manifest = &mpq.Manifest{Defaults: mpq.FileOptions{SectorCRC: true}}
+	}
+
+	archive, err := mpq.CreateFromDir(flags.Arg(0), flags.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	readArchive, err := mpq.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer readArchive.Close()
+
+	added, err := readArchive.ListFiles()
+	if err != nil {
+		return err
+	}
+	return report(*jsonOut, "added", added)
+}
+
+// formatVersion returns the archive format for the -v2 flag.
+func formatVersion(v2 bool) mpq.FormatVersion {
+	if v2 {
+		return mpq.FormatV2
+	}
+	return mpq.FormatV1
+}
+
+// report prints the paths affected by a modifying command.
+func report(jsonOut bool, action string, paths []string) error {
+	if jsonOut {
+		return printJSON(map[string][]string{action: paths})
+	}
+	for _, p := range paths {
+		fmt.Printf("%s %s\n", action, p)
+	}
+	return nil
+}
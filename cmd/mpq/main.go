@@ -0,0 +1,165 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+// Command mpq lists, extracts, creates and modifies MPQ archives.
+//
+// Usage:
+//
+//	mpq <command> [flags] <archive> [args...]
+//
+// Commands that read archives accept -p to layer patch archives on top of the
+// base archive as a patch chain. Most commands accept -json to print
+// machine-readable output.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	mpq "github.com/suprsokr/go-mpq"
+)
+
+const usage = `usage: mpq <command> [flags] <archive> [args...]
+
+Commands:
+  list     [-json] [-p patch]... <archive> [pattern...]   List files
+  extract  [-o dir] [-stdout] [-json] [-p patch]... <archive> [pattern...]
+                                                         Extract files (all if no pattern)
+  add      [-crc] [-as path | -root dir] [-v2] [-max n] [-inplace] [-json] <archive> <file>...
+                                                         Add or replace files
+  rm       [-inplace] [-json] <archive> <path>...         Remove files
+  info     [-json] [-blocks] <archive>                    Show header and table information
+  verify   [-json] <archive>                              Check archive integrity
+  compact  [-order position|directory|extension] [-max n] [-n] [-json] <archive>
+                                                         Remove unused space from an archive
+  create   [-crc] [-v2] [-manifest file] [-json] <archive> <dir>
+                                                         Create an archive from a directory
+
+Patterns use MPQ paths and are case-insensitive; * and ? do not match
+path separators and ** matches any number of directories.
+`
+
+// errUsage signals a command line error; the usage text has already been printed.
+var errUsage = fmt.Errorf("invalid usage")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string) error{
+		"list":    runList,
+		"extract": runExtract,
+		"add":     runAdd,
+		"rm":      runRemove,
+		"info":    runInfo,
+		"verify":  runVerify,
+		"compact": runCompact,
+		"create":  runCreate,
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		fmt.Print(usage)
+		return
+	}
+
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "mpq: unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[2:]); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "mpq %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates the flag set for a command with a usage line.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: mpq %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args and checks that at least minArgs positional arguments remain.
+func parseFlags(fs *flag.FlagSet, args []string, minArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() < minArgs {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// source is the read API shared by Archive and PatchChain.
+type source interface {
+	Glob(pattern string) ([]string, error)
+	Walk(pattern string) func(yield func(*mpq.FileInfo, error) bool)
+	ReadFile(mpqPath string) ([]byte, error)
+	Close() error
+}
+
+// openSource opens a single archive, or a patch chain if patches are given.
+func openSource(archivePath string, patches []string) (source, error) {
+	if len(patches) == 0 {
+		return mpq.Open(archivePath)
+	}
+	return mpq.OpenPatchChain(append([]string{archivePath}, patches...))
+}
+
+// globAll returns the sorted union of the files matching any of patterns,
+// or all files if there are none.
+func globAll(src source, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"**"}
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := src.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			if key := strings.ToUpper(name); !seen[key] {
+				seen[key] = true
+				files = append(files, name)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command itself when the test binary is started by runMPQ.
+func TestMain(m *testing.M) {
+	if os.Getenv("MPQ_TEST_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMPQ runs the mpq command with args in dir and returns its output and
+// exit status.
+func runMPQ(t *testing.T, dir string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "MPQ_TEST_RUN_MAIN=1")
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &outBuf, &errBuf
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("run mpq %v: %v", args, err)
+	}
+	return outBuf.String(), errBuf.String(), code
+}
+
+func TestCommands(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_cmd_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcFiles := map[string]string{
+		"src/Data/a.txt":      "alpha",
+		"src/Data/b.xml":      "<b/>",
+		"src/Interface/c.txt": "gamma",
+	}
+	for name, data := range srcFiles {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	src := filepath.Join(tmpDir, "src")
+
+	// The steps run in order against the same archive
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		stdout string   // Exact output, checked unless empty
+		has    []string // Substrings of stdout, or of stderr on failure
+		json   any      // Expected -json output, decoded into the same type
+	}{
+		{
+			name:   "create",
+			args:   []string{"create", "test.mpq", src},
+			stdout: "added Data\\a.txt\nadded Data\\b.xml\nadded Interface\\c.txt\n",
+		},
+		{
+			name:   "list",
+			args:   []string{"list", "test.mpq"},
+			stdout: "Data\\a.txt\nData\\b.xml\nInterface\\c.txt\n",
+		},
+		{
+			name:   "list pattern",
+			args:   []string{"list", "test.mpq", "data/*.TXT"},
+			stdout: "Data\\a.txt\n",
+		},
+		{
+			name: "list json",
+			args: []string{"list", "-json", "test.mpq", "Interface/**"},
+			json: []fileEntry{{Path: "Interface\\c.txt", Archive: "test.mpq", Size: 5, CompressedSize: 5, Flags: "single_unit|exists"}},
+		},
+		{
+			name:   "add base name",
+			args:   []string{"add", "test.mpq", filepath.Join(src, "Interface", "c.txt")},
+			stdout: "added c.txt\n",
+		},
+		{
+			name:   "add relative to root",
+			args:   []string{"add", "-root", src, "test.mpq", filepath.Join(src, "Data", "a.txt")},
+			stdout: "added Data\\a.txt\n",
+		},
+		{
+			name: "add outside root",
+			args: []string{"add", "-root", filepath.Join(src, "Data"), "test.mpq", filepath.Join(src, "Interface", "c.txt")},
+			code: 1,
+			has:  []string{"outside the root directory"},
+		},
+		{
+			name:   "rm",
+			args:   []string{"rm", "test.mpq", "c.txt"},
+			stdout: "removed c.txt\n",
+		},
+		{
+			name: "rm in place",
+			args: []string{"rm", "-inplace", "-json", "test.mpq", "Interface\\c.txt"},
+			json: map[string][]string{"removed": {"Interface\\c.txt"}},
+		},
+		{
+			name: "list after rm",
+			args: []string{"list", "-json", "test.mpq"},
+			json: []fileEntry{
+				{Path: "Data\\a.txt", Archive: "test.mpq", Size: 5, CompressedSize: 5, Flags: "single_unit|exists"},
+				{Path: "Data\\b.xml", Archive: "test.mpq", Size: 4, CompressedSize: 4, Flags: "single_unit|exists"},
+			},
+		},
+		{
+			name:   "extract",
+			args:   []string{"extract", "-o", "out", "test.mpq", "Data/*.txt"},
+			stdout: filepath.Join("out", "Data", "a.txt") + "\n",
+		},
+		{
+			name: "extract json",
+			args: []string{"extract", "-json", "-o", "out", "test.mpq", "Data/b.xml"},
+			json: []extractResult{{Path: "Data\\b.xml", Output: filepath.Join("out", "Data", "b.xml"), Size: 4}},
+		},
+		{
+			name:   "extract stdout",
+			args:   []string{"extract", "-stdout", "test.mpq", "Data\\a.txt"},
+			stdout: "alpha",
+		},
+		{
+			name: "extract no match",
+			args: []string{"extract", "test.mpq", "Sound/*"},
+			code: 1,
+			has:  []string{"no files match Sound/*"},
+		},
+		{
+			name: "info",
+			args: []string{"info", "test.mpq"},
+			has:  []string{"Format version:     1\n", "Block table:"},
+		},
+		{
+			name: "verify",
+			args: []string{"verify", "test.mpq"},
+			has:  []string{"OK ("},
+		},
+		{
+			name: "compact dry run",
+			args: []string{"compact", "-n", "test.mpq"},
+			has:  []string{"Gaps:", "Free block entries:"},
+		},
+		{
+			name: "compact",
+			args: []string{"compact", "-order", "extension", "-max", "32", "test.mpq"},
+			has:  []string{"compacted "},
+		},
+		{
+			name: "compact dry run after compacting",
+			args: []string{"compact", "-n", "-json", "test.mpq"},
+			json: map[string]int{"Gaps": 0, "GapBytes": 0, "OrphanedBlocks": 0, "OrphanedBytes": 0, "FreeEntries": 0},
+		},
+		{
+			name: "verify json",
+			args: []string{"verify", "-json", "test.mpq"},
+			has:  []string{`"Problems": null`},
+		},
+		{
+			name: "verify not an archive",
+			args: []string{"verify", filepath.Join(src, "Data", "a.txt")},
+			code: 1,
+			has:  []string{"mpq verify:"},
+		},
+		{
+			name: "compact unknown order",
+			args: []string{"compact", "-order", "size", "test.mpq"},
+			code: 1,
+			has:  []string{`unknown order "size"`},
+		},
+		{
+			name: "missing arguments",
+			args: []string{"add", "test.mpq"},
+			code: 2,
+			has:  []string{"usage: mpq add"},
+		},
+		{
+			name: "unknown command",
+			args: []string{"pack", "test.mpq"},
+			code: 2,
+			has:  []string{`unknown command "pack"`},
+		},
+	}
+
+	for _, test := range tests {
+		stdout, stderr, code := runMPQ(t, tmpDir, test.args...)
+		if code != test.code {
+			t.Fatalf("%s: exit status %d, want %d\nstdout: %s\nstderr: %s", test.name, code, test.code, stdout, stderr)
+		}
+		if test.stdout != "" && stdout != test.stdout {
+			t.Errorf("%s: stdout = %q, want %q", test.name, stdout, test.stdout)
+		}
+		output := stdout
+		if code != 0 {
+			output = stderr
+		}
+		for _, want := range test.has {
+			if !strings.Contains(output, want) {
+				t.Errorf("%s: output %q does not contain %q", test.name, output, want)
+			}
+		}
+		if test.json != nil {
+			got := reflect.New(reflect.TypeOf(test.json))
+			if err := json.Unmarshal([]byte(stdout), got.Interface()); err != nil {
+				t.Fatalf("%s: decode %q: %v", test.name, stdout, err)
+			}
+			if !reflect.DeepEqual(got.Elem().Interface(), test.json) {
+				t.Errorf("%s: json = %+v, want %+v", test.name, got.Elem().Interface(), test.json)
+			}
+		}
+	}
+
+	for _, name := range []string{"Data/a.txt", "Data/b.xml"} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, "out", filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("read extracted file: %v", err)
+		}
+		if want := srcFiles["src/"+name]; string(data) != want {
+			t.Errorf("extracted %s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestFailedChangesDiscarded(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_cmd_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if _, stderr, code := runMPQ(t, tmpDir, "add", "new.mpq", "a.txt", "missing.txt"); code != 1 {
+		t.Fatalf("add to new archive: exit status %d, want 1\nstderr: %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "new.mpq")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("failed add created the archive: %v", err)
+	}
+
+	if _, stderr, code := runMPQ(t, tmpDir, "add", "test.mpq", "a.txt", "b.txt"); code != 0 {
+		t.Fatalf("add: exit status %d\nstderr: %s", code, stderr)
+	}
+	mpqPath := filepath.Join(tmpDir, "test.mpq")
+	want, err := os.ReadFile(mpqPath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"add", []string{"add", "test.mpq", "a.txt", "missing.txt"}},
+		{"add in place", []string{"add", "-inplace", "test.mpq", "a.txt", "missing.txt"}},
+		{"rm", []string{"rm", "test.mpq", "b.txt", "nope.txt"}},
+		{"rm in place", []string{"rm", "-inplace", "test.mpq", "b.txt", "nope.txt"}},
+	}
+	for _, test := range tests {
+		if _, stderr, code := runMPQ(t, tmpDir, test.args...); code != 1 {
+			t.Fatalf("%s: exit status %d, want 1\nstderr: %s", test.name, code, stderr)
+		}
+		got, err := os.ReadFile(mpqPath)
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: failed command changed the archive", test.name)
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("read temp dir: %v", err)
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".tmp" {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
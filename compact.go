@@ -0,0 +1,486 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SpaceReport describes the space in an archive that holds no file data.
+type SpaceReport struct {
+	Gaps           int    // Ranges between blocks and tables that nothing uses
+	GapBytes       uint64 // Total size of the gaps
+	OrphanedBlocks int    // Blocks with data that no hash table entry refers to
+	OrphanedBytes  uint64 // Total size of the orphaned blocks
+	FreeEntries    int    // Block table entries without a file, reused by OpenForAppend
+}
+
+// Wasted returns the number of bytes Compact would reclaim.
+func (r *SpaceReport) Wasted() uint64 {
+	return r.GapBytes + r.OrphanedBytes
+}
+
+// FreeSpace reports the space wasted by gaps between blocks, such as those
+// OpenForAppend leaves behind, and by blocks that no file refers to.
+func (a *Archive) FreeSpace() (*SpaceReport, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	referenced := a.referencedBlocks()
+	report := &SpaceReport{}
+	for i := range a.blockTable {
+		block := &a.blockTable[i]
+		switch {
+		case block.Flags&fileExists == 0:
+			report.FreeEntries++
+		case !referenced[uint32(i)] && block.CompressedSize > 0:
+			report.OrphanedBlocks++
+			report.OrphanedBytes += uint64(block.CompressedSize)
+		}
+	}
+
+	regions, _ := a.freeRegions(a.tableRegions()...)
+	for _, region := range regions {
+		report.Gaps++
+		report.GapBytes += region.size
+	}
+	return report, nil
+}
+
+// referencedBlocks returns the block indices that hash table entries refer to.
+func (a *Archive) referencedBlocks() map[uint32]bool {
+	referenced := make(map[uint32]bool)
+	for _, entry := range a.hashTable {
+		if entry.BlockIndex < uint32(len(a.blockTable)) {
+			referenced[entry.BlockIndex] = true
+		}
+	}
+	return referenced
+}
+
+// tableRegions returns the space used by the hash, block and hi-block tables.
+func (a *Archive) tableRegions() []archiveRegion {
+	h := a.header
+	regions := []archiveRegion{
+		{pos: h.getHashTableOffset64(), size: uint64(h.HashTableSize) * 16},
+		{pos: h.getBlockTableOffset64(), size: uint64(h.BlockTableSize) * 16},
+	}
+	if h.HiBlockTableOffset64 != 0 {
+		regions = append(regions, archiveRegion{pos: h.HiBlockTableOffset64, size: uint64(h.BlockTableSize) * 2})
+	}
+	return regions
+}
+
+// CompactOrder selects the order in which Compact writes file data.
+type CompactOrder int
+
+const (
+	CompactByPosition  CompactOrder = iota // Keep the current order
+	CompactByDirectory                     // Group files by directory, then by name
+	CompactByExtension                     // Group files by extension, then by path
+)
+
+// CompactOptions configures Compact.
+type CompactOptions struct {
+	Order CompactOrder
+
+	// MaxFiles sizes the hash table as Create does; 0 keeps the current size.
+	MaxFiles int
+
+	// Names adds file names that are missing from (listfile).
+	Names []string
+
+	// Progress, if set, is called after each block is written.
+	Progress func(done, total int)
+}
+
+// CompactReport describes the result of Compact.
+type CompactReport struct {
+	Blocks        int   // Blocks written
+	Unnamed       int   // Hash table entries whose file names are unknown
+	OldSize       int64 // File size before compacting
+	NewSize       int64 // File size after compacting
+	HashTableSize uint32
+}
+
+// Compact rewrites an archive opened with OpenForAppend without unused
+// space. Pending changes are written first. Gaps and orphaned blocks are
+// dropped, the remaining blocks are copied byte for byte in opts.Order, and
+// the hash table is rebuilt with the size opts.MaxFiles asks for.
+// (attributes) is reordered along with the blocks, or dropped if it can't be
+// parsed, (patch_metadata) gets a new PatchMD5, and a weak or strong
+// signature is dropped.
+//
+// Files are found through the hash table, so files missing from (listfile)
+// are kept. Their names are needed to resize the hash table and to move
+// FILE_FIX_KEY files; pass them in opts.Names. The archive is written to a
+// temporary file that then replaces it, and stays open for appending.
+func (a *Archive) Compact(opts CompactOptions) (*CompactReport, error) {
+	if a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for appending")
+	}
+	if opts.Order < CompactByPosition || opts.Order > CompactByExtension {
+		return nil, fmt.Errorf("unknown compact order: %d", opts.Order)
+	}
+
+	if err := a.appendArchive(); err != nil {
+		return nil, err
+	}
+
+	stat, err := a.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat archive: %w", err)
+	}
+	report := &CompactReport{OldSize: stat.Size()}
+
+	// (attributes) is indexed by block, so one that can't be parsed can't
+	// follow the blocks to their new places and is dropped
+	attrs, err := a.readAttributes()
+	dropAttributes := err != nil
+
+	// Name the hash table entries from (listfile), opts.Names and the
+	// special files
+	candidates := append(append([]string(nil), appendSpecialFiles...), opts.Names...)
+	if listed, err := a.ListFiles(); err == nil {
+		candidates = append(candidates, listed...)
+	}
+	names := make(map[uint32]string)
+	for _, name := range candidates {
+		name = strings.ReplaceAll(name, "/", "\\")
+		for _, slot := range a.hashSlots(name) {
+			names[slot] = name
+		}
+	}
+
+	// Collect the entries to keep and the blocks they refer to
+	var live []uint32
+	blockNames := make(map[uint32]string)
+	var blocks []uint32
+	for slot, entry := range a.hashTable {
+		if entry.BlockIndex >= uint32(len(a.blockTable)) || a.blockTable[entry.BlockIndex].Flags&fileExists == 0 {
+			continue
+		}
+		name, named := names[uint32(slot)]
+		if strings.EqualFold(name, "(signature)") || dropAttributes && strings.EqualFold(name, "(attributes)") {
+			continue
+		}
+		live = append(live, uint32(slot))
+		if !named {
+			report.Unnamed++
+		}
+		if _, seen := blockNames[entry.BlockIndex]; !seen {
+			blocks = append(blocks, entry.BlockIndex)
+		}
+		if named || blockNames[entry.BlockIndex] == "" {
+			blockNames[entry.BlockIndex] = name
+		}
+	}
+
+	hashTableSize := a.header.HashTableSize
+	if opts.MaxFiles > 0 {
+		hashTableSize = nextPowerOf2(uint32(float64(opts.MaxFiles) * 1.5))
+		if hashTableSize < 16 {
+			hashTableSize = 16
+		}
+	}
+	if uint32(len(live)) > hashTableSize {
+		return nil, fmt.Errorf("%d files do not fit in a hash table of %d entries", len(live), hashTableSize)
+	}
+	if report.Unnamed > 0 && hashTableSize != a.header.HashTableSize {
+		return nil, fmt.Errorf("%d files are missing from (listfile); pass their names in CompactOptions.Names to resize the hash table", report.Unnamed)
+	}
+
+	a.sortCompactBlocks(blocks, blockNames, opts.Order)
+	newIndex := make(map[uint32]uint32, len(blocks))
+	for i, old := range blocks {
+		newIndex[old] = uint32(i)
+	}
+
+	hashTable := make([]hashTableEntry, hashTableSize)
+	if report.Unnamed == 0 {
+		for i := range hashTable {
+			hashTable[i] = hashTableEntry{
+				HashA:      0xFFFFFFFF,
+				HashB:      0xFFFFFFFF,
+				Locale:     0xFFFF,
+				Platform:   0xFFFF,
+				BlockIndex: hashTableEmpty,
+			}
+		}
+		for _, slot := range live {
+			entry := a.hashTable[slot]
+			entry.BlockIndex = newIndex[entry.BlockIndex]
+			start := hashString(names[slot], hashTypeTableOffset) % hashTableSize
+			for i := uint32(0); ; i++ {
+				if index := (start + i) % hashTableSize; hashTable[index].BlockIndex == hashTableEmpty {
+					hashTable[index] = entry
+					break
+				}
+			}
+		}
+	} else {
+		// Without every name the entries can't be placed again, so they keep
+		// their slots
+		kept := make(map[uint32]bool, len(live))
+		for _, slot := range live {
+			kept[slot] = true
+		}
+		copy(hashTable, a.hashTable)
+		for i := range hashTable {
+			if kept[uint32(i)] {
+				hashTable[i].BlockIndex = newIndex[hashTable[i].BlockIndex]
+			} else if hashTable[i].BlockIndex != hashTableEmpty {
+				hashTable[i].BlockIndex = hashTableDeleted
+			}
+		}
+	}
+
+	tempPath, size, err := a.writeCompacted(blocks, blockNames, attrs, hashTable, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the archive and open the result
+	a.file.Close()
+	a.file = nil
+	if err := os.Rename(tempPath, a.path); err != nil {
+		if err := copyFile(tempPath, a.path); err != nil {
+			os.Remove(tempPath)
+			a.mode = "r"
+			return nil, fmt.Errorf("save archive: %w", err)
+		}
+		os.Remove(tempPath)
+	}
+
+	reopened, err := OpenForAppend(a.path)
+	if err != nil {
+		a.mode = "r"
+		return nil, fmt.Errorf("reopen archive: %w", err)
+	}
+	reopened.timestamps, reopened.fixedTime = a.timestamps, a.fixedTime
+	*a = *reopened
+
+	report.Blocks = len(blocks)
+	report.NewSize = size
+	report.HashTableSize = hashTableSize
+	return report, nil
+}
+
+// sortCompactBlocks sorts block indices into the order Compact writes them.
+// Ordered by path, named files come first, then unnamed ones and special
+// files by position; (attributes) always comes last since it is rebuilt.
+func (a *Archive) sortCompactBlocks(blocks []uint32, names map[uint32]string, order CompactOrder) {
+	rank := func(index uint32) int {
+		name := names[index]
+		switch {
+		case strings.EqualFold(name, "(attributes)"):
+			return 3
+		case order == CompactByPosition:
+			return 0
+		case name == "":
+			return 1
+		case strings.HasPrefix(name, "("):
+			return 2
+		}
+		return 0
+	}
+	key := func(index uint32) (string, string) {
+		path := strings.ToUpper(names[index])
+		slash := lastIndexOfSlash(path)
+		if order == CompactByExtension {
+			base := path[slash+1:]
+			if dot := strings.LastIndexByte(base, '.'); dot >= 0 {
+				return base[dot+1:], path
+			}
+			return "", path
+		}
+		if slash < 0 {
+			return "", path
+		}
+		return path[:slash], path[slash+1:]
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		bi, bj := blocks[i], blocks[j]
+		if ri, rj := rank(bi), rank(bj); ri != rj {
+			return ri < rj
+		}
+		if order != CompactByPosition && rank(bi) == 0 {
+			ki1, ki2 := key(bi)
+			kj1, kj2 := key(bj)
+			if ki1 != kj1 {
+				return ki1 < kj1
+			}
+			if ki2 != kj2 {
+				return ki2 < kj2
+			}
+		}
+		return a.blockTable[bi].getFilePos64() < a.blockTable[bj].getFilePos64()
+	})
+}
+
+// writeCompacted writes the blocks in order, followed by hashTable and the
+// new block table, to a temporary file next to the archive. (attributes) is
+// rebuilt from attrs for the new block order. It returns the temporary path
+// and the file size.
+func (a *Archive) writeCompacted(blocks []uint32, names map[uint32]string, attrs *fileAttributes, hashTable []hashTableEntry, progress func(done, total int)) (string, int64, error) {
+	_, _, leading, err := readLeadingData(a.file, a.header)
+	if err != nil {
+		return "", 0, fmt.Errorf("read user data: %w", err)
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(a.path), "mpq_*.tmp")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temp file: %w", err)
+	}
+	tempPath := file.Name()
+	done := false
+	defer func() {
+		if !done {
+			file.Close()
+			os.Remove(tempPath)
+		}
+	}()
+
+	if _, err := file.Write(leading); err != nil {
+		return "", 0, fmt.Errorf("write user data: %w", err)
+	}
+	archiveStart := int64(len(leading))
+
+	order := make([]int, len(blocks))
+	for i, old := range blocks {
+		order[i] = int(old)
+	}
+
+	blockTable := make([]blockTableEntryEx, len(blocks))
+	pos := uint64(a.header.HeaderSize)
+	metaPos := int64(-1)
+	needsHiBlockTable := false
+	for i, old := range blocks {
+		block := a.blockTable[old]
+		name := names[old]
+		flags, fileSize := block.Flags, block.FileSize
+
+		size := block.CompressedSize
+		switch {
+		case strings.EqualFold(name, "(attributes)") && attrs != nil:
+			attributesData := attrs.reorder(order)
+			data, storedFlags, err := storeSpecialFile(attributesData)
+			if err != nil {
+				return "", 0, fmt.Errorf("compress attributes: %w", err)
+			}
+			if _, err := file.WriteAt(data, archiveStart+int64(pos)); err != nil {
+				return "", 0, fmt.Errorf("write attributes: %w", err)
+			}
+			flags, fileSize, size = storedFlags, uint32(len(attributesData)), uint32(len(data))
+
+		case strings.EqualFold(name, "(patch_metadata)") && flags&(fileCompress|fileImplode|fileEncrypted) == 0 && size == patchMetadataSize:
+			// An uncompressed (patch_metadata) gets a new PatchMD5 at the end
+			data, err := a.readBlockData(&block)
+			if err != nil {
+				return "", 0, fmt.Errorf("read block %d: %w", old, err)
+			}
+			copy(data[16:32], make([]byte, 16))
+			if _, err := file.WriteAt(data, archiveStart+int64(pos)); err != nil {
+				return "", 0, fmt.Errorf("write patch metadata: %w", err)
+			}
+			metaPos = int64(pos)
+
+		default:
+			// Blocks are streamed; FILE_FIX_KEY blocks are re-keyed on the way
+			if flags&fileFixKey != 0 && flags&fileEncrypted != 0 && pos != block.getFilePos64() && name == "" {
+				return "", 0, fmt.Errorf("block %d has a key that depends on its position and its name is unknown; pass it in CompactOptions.Names", old)
+			}
+			w := io.NewOffsetWriter(file, archiveStart+int64(pos))
+			if err := a.writeRaw(w, name, a.rawBlock(&block, 0), pos); err != nil {
+				return "", 0, fmt.Errorf("copy block %d: %w", old, err)
+			}
+		}
+
+		blockTable[i] = blockTableEntryEx{
+			blockTableEntry: blockTableEntry{
+				FilePos:        uint32(pos),
+				CompressedSize: size,
+				FileSize:       fileSize,
+				Flags:          flags,
+			},
+			FilePosHi: uint16(pos >> 32),
+		}
+		if pos>>32 != 0 {
+			needsHiBlockTable = true
+		}
+		pos += uint64(size)
+
+		if progress != nil {
+			progress(i+1, len(blocks))
+		}
+	}
+
+	header := *a.header
+	hashTableOffset := pos
+	blockTableOffset := hashTableOffset + uint64(len(hashTable))*16
+	size := blockTableOffset + uint64(len(blockTable))*16
+	header.HiBlockTableOffset64 = 0
+	if needsHiBlockTable {
+		if a.formatVersion != FormatV2 {
+			return "", 0, fmt.Errorf("compacted archive exceeds 4GB, which needs the V2 format")
+		}
+		header.HiBlockTableOffset64 = size
+		size += uint64(len(blockTable)) * 2
+	}
+
+	if _, err := file.Seek(archiveStart+int64(hashTableOffset), io.SeekStart); err != nil {
+		return "", 0, fmt.Errorf("seek to hash table: %w", err)
+	}
+	if err := writeUint32Array(file, encryptHashTable(hashTable)); err != nil {
+		return "", 0, fmt.Errorf("write hash table: %w", err)
+	}
+	if err := writeUint32Array(file, encryptBlockTable(blockTable)); err != nil {
+		return "", 0, fmt.Errorf("write block table: %w", err)
+	}
+	if needsHiBlockTable {
+		hiBlockTable := make([]uint16, len(blockTable))
+		for i, entry := range blockTable {
+			hiBlockTable[i] = entry.FilePosHi
+		}
+		if err := writeUint16Array(file, hiBlockTable); err != nil {
+			return "", 0, fmt.Errorf("write hi-block table: %w", err)
+		}
+	}
+
+	header.setHashTableOffset64(hashTableOffset)
+	header.setBlockTableOffset64(blockTableOffset)
+	header.HashTableSize = uint32(len(hashTable))
+	header.BlockTableSize = uint32(len(blockTable))
+	header.ArchiveSize = uint32(size) - header.HeaderSize
+	if _, err := file.Seek(archiveStart, io.SeekStart); err != nil {
+		return "", 0, fmt.Errorf("seek to header: %w", err)
+	}
+	if err := writeArchiveHeader(file, &header); err != nil {
+		return "", 0, fmt.Errorf("write header: %w", err)
+	}
+
+	if metaPos >= 0 {
+		sum, err := sectionMD5(file, archiveStart, int64(size))
+		if err != nil {
+			return "", 0, fmt.Errorf("hash archive: %w", err)
+		}
+		if _, err := file.WriteAt(sum[:], archiveStart+metaPos+16); err != nil {
+			return "", 0, fmt.Errorf("write patch metadata: %w", err)
+		}
+	}
+
+	done = true
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
+		return "", 0, fmt.Errorf("close temp file: %w", err)
+	}
+	return tempPath, archiveStart + int64(size), nil
+}
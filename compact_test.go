@@ -0,0 +1,400 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_compact_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fixed := time.Date(2008, 11, 13, 0, 0, 0, 0, time.UTC)
+	large := bytes.Repeat([]byte("sectored data "), 2000)
+	files := map[string][]byte{
+		"Sound\\music.wav":      []byte("music"),
+		"Data\\b.txt":           []byte("b text"),
+		"Data\\a.xml":           []byte("<a/>"),
+		"Data\\fixkey.bin":      large,
+		"Interface\\frame.xml":  []byte("<frame/>"),
+		"Interface\\button.txt": []byte("button"),
+	}
+	opts := map[string]FileOptions{
+		"Data\\fixkey.bin": {FixKey: true, SectorCRC: true},
+		"Data\\b.txt":      {Encrypt: true, Compression: CompressionBzip2},
+	}
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetTimestamps(TimestampsFixed, fixed); err != nil {
+		t.Fatalf("set timestamps: %v", err)
+	}
+	// Incompressible, so removing it leaves a gap larger than the hash table grows
+	doomed := make([]byte, 8192)
+	rand.New(rand.NewSource(1)).Read(doomed)
+	if err := archive.AddFileData(doomed, "Data\\doomed.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := archive.AddFileData(files[name], name, opts[name]); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	if err := archive.RemoveFile("Data\\doomed.txt"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	space, err := archive.FreeSpace()
+	if err != nil {
+		t.Fatalf("free space: %v", err)
+	}
+	if space.Gaps == 0 || space.Wasted() == 0 {
+		t.Errorf("free space before compacting = %+v", space)
+	}
+
+	calls, lastTotal := 0, 0
+	report, err := archive.Compact(CompactOptions{
+		Order:    CompactByDirectory,
+		MaxFiles: 64,
+		Progress: func(done, total int) {
+			calls++
+			lastTotal = total
+			if done != calls {
+				t.Errorf("progress(%d, %d) on call %d", done, total, calls)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if calls != report.Blocks || lastTotal != report.Blocks || report.Unnamed != 0 || report.HashTableSize != 128 {
+		t.Errorf("report = %+v after %d progress calls", report, calls)
+	}
+	if report.NewSize >= report.OldSize {
+		t.Errorf("size %d -> %d, want it to shrink", report.OldSize, report.NewSize)
+	}
+
+	space, err = archive.FreeSpace()
+	if err != nil {
+		t.Fatalf("free space: %v", err)
+	}
+	if space.Wasted() != 0 || space.FreeEntries != 0 {
+		t.Errorf("free space after compacting = %+v", space)
+	}
+
+	// The archive stays open for appending
+	if err := archive.AddFileData([]byte("added"), "Data\\added.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	compacted, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer compacted.Close()
+
+	for name, want := range files {
+		data, err := compacted.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: contents changed", name)
+		}
+		info, err := compacted.Stat(name)
+		if err != nil {
+			t.Fatalf("stat %s: %v", name, err)
+		}
+		if !info.Time.Equal(fixed) {
+			t.Errorf("%s: time = %v, want %v", name, info.Time, fixed)
+		}
+	}
+
+	if data, err := compacted.ReadFile("Data\\added.txt"); err != nil || string(data) != "added" {
+		t.Errorf("added.txt = %q, %v", data, err)
+	}
+
+	byPosition := append([]string(nil), names...)
+	sort.Slice(byPosition, func(i, j int) bool {
+		bi, _ := compacted.findFile(byPosition[i])
+		bj, _ := compacted.findFile(byPosition[j])
+		return bi.getFilePos64() < bj.getFilePos64()
+	})
+	want := []string{"Data\\a.xml", "Data\\b.txt", "Data\\fixkey.bin", "Interface\\button.txt", "Interface\\frame.xml", "Sound\\music.wav"}
+	if !reflect.DeepEqual(byPosition, want) {
+		t.Errorf("data order = %v, want %v", byPosition, want)
+	}
+
+	verify, err := compacted.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !verify.OK() {
+		t.Errorf("verify failed: %+v", verify)
+	}
+}
+
+func TestCompactUnnamedFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_compact_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	large := bytes.Repeat([]byte("sectored data "), 2000)
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	add := func(data []byte, name string, opts FileOptions) {
+		t.Helper()
+		if err := archive.AddFileData(data, name, opts); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	add(bytes.Repeat([]byte("doomed "), 1000), "Data\\doomed.txt", FileOptions{})
+	add([]byte("hidden"), "Data\\hidden.txt", FileOptions{})
+	add(large, "Data\\fixkey.bin", FileOptions{FixKey: true})
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	// Drop (listfile) so the remaining files have no known names, as in
+	// archives built by other tools
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	if err := archive.RemoveFile("Data\\doomed.txt"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	for _, entry := range archive.hashEntries("(listfile)") {
+		entry.BlockIndex = hashTableDeleted
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	defer archive.Close()
+
+	if _, err := archive.Compact(CompactOptions{}); err == nil {
+		t.Error("expected an error moving an unnamed FILE_FIX_KEY file")
+	}
+
+	report, err := archive.Compact(CompactOptions{Names: []string{"Data\\fixkey.bin"}})
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if report.Unnamed != 1 {
+		t.Errorf("unnamed = %d, want 1", report.Unnamed)
+	}
+	for name, want := range map[string][]byte{"Data\\hidden.txt": []byte("hidden"), "Data\\fixkey.bin": large} {
+		data, err := archive.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: contents changed", name)
+		}
+	}
+
+	if _, err := archive.Compact(CompactOptions{MaxFiles: 64}); err == nil {
+		t.Error("expected an error resizing the hash table with unnamed files")
+	}
+	if _, err := archive.Compact(CompactOptions{MaxFiles: 64, Names: []string{"Data\\hidden.txt", "Data\\fixkey.bin"}}); err != nil {
+		t.Fatalf("compact with names: %v", err)
+	}
+	if data, err := archive.ReadFile("Data\\hidden.txt"); err != nil || string(data) != "hidden" {
+		t.Errorf("hidden.txt = %q, %v", data, err)
+	}
+}
+
+func TestCompactByExtension(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_compact_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string][]byte{
+		"Sound\\a.wav":     []byte("wave"),
+		"Data\\b.txt":      []byte("b text"),
+		"Data\\c.xml":      []byte("<c/>"),
+		"Interface\\d.txt": []byte("d text"),
+		"Data\\e.wav":      bytes.Repeat([]byte("sectored wave "), 2000),
+	}
+	names := []string{"Sound\\a.wav", "Data\\b.txt", "Data\\c.xml", "Interface\\d.txt", "Data\\e.wav"}
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 16)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileData([]byte("doomed"), "Data\\doomed.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	for _, name := range names {
+		if err := archive.AddFileData(files[name], name, FileOptions{SectorCRC: true}); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	if err := archive.RemoveFile("Data\\doomed.txt"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	if _, err := archive.Compact(CompactOptions{Order: CompactByExtension}); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	compacted, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer compacted.Close()
+
+	byPosition := append([]string(nil), names...)
+	sort.Slice(byPosition, func(i, j int) bool {
+		bi, _ := compacted.findFile(byPosition[i])
+		bj, _ := compacted.findFile(byPosition[j])
+		return bi.getFilePos64() < bj.getFilePos64()
+	})
+	want := []string{"Data\\b.txt", "Interface\\d.txt", "Data\\e.wav", "Sound\\a.wav", "Data\\c.xml"}
+	if !reflect.DeepEqual(byPosition, want) {
+		t.Errorf("data order = %v, want %v", byPosition, want)
+	}
+
+	// The CRCs in (attributes) have to follow the blocks to their new order
+	attrs, err := compacted.readAttributes()
+	if err != nil || attrs == nil {
+		t.Fatalf("read attributes: %v", err)
+	}
+	for _, name := range names {
+		index := compacted.hashEntries(name)[0].BlockIndex
+		if attrs.crc32[index] != crc32(files[name]) {
+			t.Errorf("%s: attributes CRC32 0x%08X, want 0x%08X", name, attrs.crc32[index], crc32(files[name]))
+		}
+	}
+
+	report, err := compacted.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("verify failed: %+v", report)
+	}
+}
+
+func TestCompactUnreadableAttributes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_compact_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 16)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for _, name := range []string{"Data\\z.txt", "Data\\a.txt"} {
+		if err := archive.AddFileData([]byte(name), name, FileOptions{}); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	// Point (attributes) at data with an unknown version
+	archive, err = OpenForAppend(archivePath)
+	if err != nil {
+		t.Fatalf("open for append: %v", err)
+	}
+	stat, err := archive.file.Stat()
+	if err != nil {
+		t.Fatalf("stat archive: %v", err)
+	}
+	garbage := make([]byte, 64)
+	garbage[0] = 99
+	if _, err := archive.file.WriteAt(garbage, stat.Size()); err != nil {
+		t.Fatalf("write attributes: %v", err)
+	}
+	block, _ := archive.findFile("(attributes)")
+	*block = blockTableEntryEx{}
+	block.setFilePos64(uint64(stat.Size()) - archive.header.ArchiveOffset)
+	block.CompressedSize = uint32(len(garbage))
+	block.FileSize = uint32(len(garbage))
+	block.Flags = fileExists | fileSingleUnit
+
+	if _, err := archive.Compact(CompactOptions{Order: CompactByDirectory}); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if archive.HasFile("(attributes)") {
+		t.Error("unreadable (attributes) was kept")
+	}
+	for _, name := range []string{"Data\\z.txt", "Data\\a.txt"} {
+		if data, err := archive.ReadFile(name); err != nil || string(data) != name {
+			t.Errorf("%s = %q, %v", name, data, err)
+		}
+	}
+	report, err := archive.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("verify failed: %+v", report)
+	}
+}
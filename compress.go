@@ -47,6 +47,14 @@ func compressData(data []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// compressDataWith compresses data using the given method
+func compressDataWith(data []byte, method Compression) ([]byte, error) {
+	if method == CompressionBzip2 {
+		return append([]byte{compressionBzip2}, compressBzip2(data)...), nil
+	}
+	return compressData(data)
+}
+
 // decompressData decompresses MPQ-compressed data
 // Supports multi-compression: compressions are applied in order and must be
 // decompressed in reverse order (last compression first)
@@ -0,0 +1,119 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Run with -race to check the locking.
+func TestConcurrentReads(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_concurrency_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	contents := make(map[string][]byte)
+	writeArchive := func(name string, version int) string {
+		path := filepath.Join(tmpDir, name)
+		archive, err := Create(path, 64)
+		if err != nil {
+			t.Fatalf("create archive: %v", err)
+		}
+		for i := 0; i < 16; i++ {
+			mpqPath := fmt.Sprintf("Data\\file%02d.bin", i)
+			data := bytes.Repeat([]byte(fmt.Sprintf("%s v%d ", mpqPath, version)), 200+i*50)
+			opts := FileOptions{SectorCRC: i%2 == 0, Encrypt: i%3 == 0}
+			if err := archive.AddFileData(data, mpqPath, opts); err != nil {
+				t.Fatalf("add file: %v", err)
+			}
+			if version == 1 || i%2 == 0 {
+				contents[mpqPath] = data
+			}
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+		return path
+	}
+	basePath := writeArchive("base.mpq", 0)
+	patchPath := writeArchive("patch.mpq", 1)
+
+	archive, err := Open(patchPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer archive.Close()
+
+	chain, err := OpenPatchChain([]string{basePath, patchPath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 64)
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 64; i++ {
+				mpqPath := fmt.Sprintf("Data\\file%02d.bin", (g+i)%16)
+				want := contents[mpqPath]
+
+				data, err := archive.ReadFile(mpqPath)
+				if err != nil || !bytes.Equal(data, want) {
+					errs <- fmt.Errorf("archive read %s: %v", mpqPath, err)
+					return
+				}
+				data, err = chain.ReadFile(mpqPath)
+				if err != nil || !bytes.Equal(data, want) {
+					errs <- fmt.Errorf("chain read %s: %v", mpqPath, err)
+					return
+				}
+				if !chain.HasFile(mpqPath) || chain.HasFile("Data\\missing.bin") {
+					errs <- fmt.Errorf("chain HasFile %s", mpqPath)
+					return
+				}
+
+				dest := filepath.Join(tmpDir, fmt.Sprintf("out%d", g), fmt.Sprintf("%d.bin", i))
+				if err := chain.ExtractFile(mpqPath, dest); err != nil {
+					errs <- fmt.Errorf("chain extract %s: %v", mpqPath, err)
+					return
+				}
+				if err := archive.ExtractFile(mpqPath, dest); err != nil {
+					errs <- fmt.Errorf("archive extract %s: %v", mpqPath, err)
+					return
+				}
+				if _, err := chain.Stat(mpqPath); err != nil {
+					errs <- fmt.Errorf("chain stat %s: %v", mpqPath, err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	// Pending changes are made while the reads run
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			chain.WriteFile("Data\\pending.txt", []byte("pending"), FileOptions{})
+			chain.Glob("Data\\*")
+			chain.Discard()
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
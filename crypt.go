@@ -3,6 +3,12 @@
 
 package mpq
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
 // Hash types for the hash function
 const (
 	hashTypeTableOffset = 0
@@ -85,15 +91,8 @@ func decryptBlock(data []uint32, key uint32) {
 }
 
 // decryptBytes decrypts a byte slice in place
-// The data length must be a multiple of 4
+// Trailing bytes that do not fill a whole 32-bit word are not encrypted
 func decryptBytes(data []byte, key uint32) {
-	if len(data)%4 != 0 {
-		// Pad to 4-byte boundary for decryption
-		padded := make([]byte, (len(data)+3)&^3)
-		copy(padded, data)
-		data = padded
-	}
-
 	// Convert to uint32 slice for decryption
 	words := make([]uint32, len(data)/4)
 	for i := range words {
@@ -114,6 +113,27 @@ func decryptBytes(data []byte, key uint32) {
 	}
 }
 
+// encryptBytes encrypts a byte slice in place.
+// Trailing bytes that do not fill a whole 32-bit word are left unencrypted.
+func encryptBytes(data []byte, key uint32) {
+	words := make([]uint32, len(data)/4)
+	for i := range words {
+		words[i] = uint32(data[i*4]) |
+			uint32(data[i*4+1])<<8 |
+			uint32(data[i*4+2])<<16 |
+			uint32(data[i*4+3])<<24
+	}
+
+	encryptBlock(words, key)
+
+	for i := range words {
+		data[i*4] = byte(words[i])
+		data[i*4+1] = byte(words[i] >> 8)
+		data[i*4+2] = byte(words[i] >> 16)
+		data[i*4+3] = byte(words[i] >> 24)
+	}
+}
+
 // getFileKey computes the encryption key for a file
 // based on its filename and block offset
 func getFileKey(filename string, blockOffset uint64, fileSize uint32, flags uint32) uint32 {
@@ -144,3 +164,90 @@ func lastIndexOfSlash(s string) int {
 	}
 	return -1
 }
+
+// rekeyStream copies stored file data from r to w, re-encrypting it from
+// oldKey to newKey without decompressing it. It follows the layout
+// decodeBlock expects: a single unit is one encrypted block, while sectored
+// files encrypt the offset table with key-1, the sector CRC table with
+// key-1+numSectors and sector i with key+i. Sectors are re-keyed one at a
+// time, so only a single unit is held in memory whole.
+func rekeyStream(w io.Writer, r *io.SectionReader, flags, fileSize, sectorSize, oldKey, newKey uint32) error {
+	size := r.Size()
+
+	if flags&fileSingleUnit != 0 {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		decryptBytes(data, oldKey)
+		encryptBytes(data, newKey)
+		_, err := w.Write(data)
+		return err
+	}
+
+	numSectors := (fileSize + sectorSize - 1) / sectorSize
+	offsetTableSize := (numSectors + 1) * 4
+	if size < int64(offsetTableSize) {
+		return fmt.Errorf("data too small for sector offset table")
+	}
+
+	offsetTable := make([]byte, offsetTableSize)
+	if _, err := io.ReadFull(r, offsetTable); err != nil {
+		return err
+	}
+	decryptBytes(offsetTable, oldKey-1)
+	offsets := make([]uint32, numSectors+1)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint32(offsetTable[i*4:])
+	}
+	encryptBytes(offsetTable, newKey-1)
+	if _, err := w.Write(offsetTable); err != nil {
+		return err
+	}
+	pos := int64(offsetTableSize)
+
+	crcTableEnd := offsetTableSize + numSectors*4
+	if flags&fileSectorCRC != 0 && offsets[0] >= crcTableEnd {
+		if int64(crcTableEnd) > size {
+			return fmt.Errorf("sector CRC table out of range")
+		}
+		crcTable := make([]byte, crcTableEnd-offsetTableSize)
+		if _, err := io.ReadFull(r, crcTable); err != nil {
+			return err
+		}
+		decryptBytes(crcTable, oldKey-1+numSectors)
+		encryptBytes(crcTable, newKey-1+numSectors)
+		if _, err := w.Write(crcTable); err != nil {
+			return err
+		}
+		pos = int64(crcTableEnd)
+	}
+
+	var sector []byte
+	for i := uint32(0); i < numSectors; i++ {
+		start, end := int64(offsets[i]), int64(offsets[i+1])
+		if start < pos || end < start || end > size {
+			return fmt.Errorf("invalid sector offsets: %d-%d", start, end)
+		}
+		// Anything between the tables and the sectors is copied as is
+		if _, err := io.CopyN(w, r, start-pos); err != nil {
+			return err
+		}
+		if int64(cap(sector)) < end-start {
+			sector = make([]byte, end-start)
+		}
+		sector = sector[:end-start]
+		if _, err := io.ReadFull(r, sector); err != nil {
+			return err
+		}
+		decryptBytes(sector, oldKey+i)
+		encryptBytes(sector, newKey+i)
+		if _, err := w.Write(sector); err != nil {
+			return err
+		}
+		pos = end
+	}
+
+	_, err := io.CopyN(w, r, size-pos)
+	return err
+}
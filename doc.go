@@ -13,7 +13,7 @@ versions 1 and 2, which covers games up through WoW: Wrath of the Lich King (3.3
   - Pure Go implementation - no CGO or external dependencies
   - Read and write MPQ archives
   - Support for MPQ format V1 (original, up to 4GB) and V2 (extended, >4GB)
-  - Zlib compression support
+  - Zlib and BZip2 compression support
   - Cross-platform compatibility
 
 # Basic Usage
@@ -63,10 +63,8 @@ converts forward slashes to backslashes, so both formats work:
 
 This package focuses on the subset of MPQ functionality needed for game modding:
 
-  - No support for encrypted files (except hash/block table encryption)
   - No support for PKWare implode compression
   - No support for ADPCM audio compression
   - No support for MPQ format V3/V4 (Cataclysm+)
-  - No support for patch archives
 */
 package mpq
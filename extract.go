@@ -0,0 +1,180 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ExtractOptions controls Archive.ExtractAll.
+type ExtractOptions struct {
+	Pattern string // Only extract files matching this pattern (see Glob), empty for all
+	Workers int    // Number of files decoded in parallel, 0 for runtime.NumCPU()
+}
+
+// ExtractError describes a file that could not be extracted.
+type ExtractError struct {
+	Path string // Path within the archive
+	Err  error
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractReport is the result of a bulk extraction.
+type ExtractReport struct {
+	Files  []string       // Archive paths that were extracted, sorted
+	Bytes  int64          // Total uncompressed bytes written
+	Errors []ExtractError // Files that failed, sorted by path
+}
+
+// OK reports whether every file was extracted.
+func (r *ExtractReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// extractJob is a file queued for extraction.
+type extractJob struct {
+	mpqPath  string
+	destPath string
+	block    *blockTableEntryEx
+	raw      []byte
+}
+
+// ExtractAll extracts every file (or those matching opts.Pattern) below destDir.
+// Backslashes in archive paths become directory separators.
+//
+// Blocks are read sequentially in file offset order and decoded and written
+// by a pool of workers. A file that fails does not stop the run; it is
+// recorded in the report's Errors. The returned error is only set if the file
+// list cannot be determined.
+func (a *Archive) ExtractAll(destDir string, opts ExtractOptions) (*ExtractReport, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	pattern := opts.Pattern
+	if pattern == "" {
+		pattern = "**"
+	}
+	names, err := a.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ExtractReport{}
+	jobs := make([]*extractJob, 0, len(names))
+	for _, name := range names {
+		destPath, err := extractPath(destDir, name)
+		if err != nil {
+			report.Errors = append(report.Errors, ExtractError{Path: name, Err: err})
+			continue
+		}
+		block, err := a.findFile(name)
+		if err != nil {
+			report.Errors = append(report.Errors, ExtractError{Path: name, Err: err})
+			continue
+		}
+		jobs = append(jobs, &extractJob{mpqPath: name, destPath: destPath, block: block})
+	}
+
+	// Read in file order so the archive is scanned front to back
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].block.getFilePos64() < jobs[j].block.getFilePos64()
+	})
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan *extractJob, workers*2)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				size, err := a.writeExtracted(job)
+
+				mu.Lock()
+				if err != nil {
+					report.Errors = append(report.Errors, ExtractError{Path: job.mpqPath, Err: err})
+				} else {
+					report.Files = append(report.Files, job.mpqPath)
+					report.Bytes += size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		raw, err := a.readBlockData(job.block)
+		if err != nil {
+			mu.Lock()
+			report.Errors = append(report.Errors, ExtractError{Path: job.mpqPath, Err: err})
+			mu.Unlock()
+			continue
+		}
+		job.raw = raw
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Strings(report.Files)
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Path < report.Errors[j].Path
+	})
+
+	return report, nil
+}
+
+// ExtractMatching extracts the files matching pattern below destDir.
+// See ExtractAll and Glob.
+func (a *Archive) ExtractMatching(pattern, destDir string) (*ExtractReport, error) {
+	return a.ExtractAll(destDir, ExtractOptions{Pattern: pattern})
+}
+
+// writeExtracted decodes a job's block and writes it to its destination.
+func (a *Archive) writeExtracted(job *extractJob) (int64, error) {
+	data, err := a.decodeBlock(job.mpqPath, job.block, job.raw)
+	job.raw = nil
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(job.destPath), 0755); err != nil {
+		return 0, fmt.Errorf("create directory: %w", err)
+	}
+	if err := os.WriteFile(job.destPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("write file: %w", err)
+	}
+
+	return int64(len(data)), nil
+}
+
+// extractPath maps an archive path to a path below destDir, rejecting paths
+// that would escape it.
+func extractPath(destDir, mpqPath string) (string, error) {
+	rel := filepath.FromSlash(strings.ReplaceAll(mpqPath, "\\", "/"))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path escapes the destination directory")
+	}
+	return filepath.Join(destDir, rel), nil
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractAll(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_extract_all_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	contents := make(map[string][]byte)
+	mpqPath := filepath.Join(tmpDir, "extract.mpq")
+	archive, err := Create(mpqPath, 100)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("Dir%d\\Sub\\File%02d.dat", i%3, i)
+		data := bytes.Repeat([]byte(fmt.Sprintf("file %d ", i)), i*300+1)
+		opts := FileOptions{SectorCRC: i%2 == 0, Encrypt: i%5 == 0}
+		if err := archive.AddFileData(data, name, opts); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+		contents[name] = data
+	}
+	archive.AddDeleteMarker("Dir0\\Deleted.dat")
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	// Corrupt one file so that it fails to decompress
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	corrupt := "Dir1\\Sub\\File01.dat"
+	info, err := readArchive.Stat(corrupt)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	block := readArchive.blockTable[info.BlockIndex]
+	readArchive.Close()
+
+	raw, _ := os.ReadFile(mpqPath)
+	mid := int(block.getFilePos64()) + int(block.CompressedSize)/2
+	raw[mid] ^= 0xFF
+	raw[mid+1] ^= 0xFF
+	os.WriteFile(mpqPath, raw, 0644)
+
+	readArchive, err = Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	destDir := filepath.Join(tmpDir, "out")
+	report, err := readArchive.ExtractAll(destDir, ExtractOptions{Workers: 4})
+	if err != nil {
+		t.Fatalf("extract all: %v", err)
+	}
+
+	if len(report.Errors) != 1 || report.Errors[0].Path != corrupt {
+		t.Fatalf("errors = %v, want one for %s", report.Errors, corrupt)
+	}
+	if len(report.Files) != len(contents)-1 {
+		t.Errorf("extracted %d files, want %d", len(report.Files), len(contents)-1)
+	}
+	for _, name := range report.Files {
+		got, err := os.ReadFile(extractTestPath(destDir, name))
+		if err != nil || !bytes.Equal(got, contents[name]) {
+			t.Errorf("%s: content mismatch (%v)", name, err)
+		}
+	}
+	if _, err := os.Stat(extractTestPath(destDir, "Dir0\\Deleted.dat")); err == nil {
+		t.Errorf("deletion marker was extracted")
+	}
+
+	matchDir := filepath.Join(tmpDir, "match")
+	report, err = readArchive.ExtractMatching("dir2\\**\\*.dat", matchDir)
+	if err != nil {
+		t.Fatalf("extract matching: %v", err)
+	}
+	if !report.OK() || len(report.Files) != 13 {
+		t.Errorf("extract matching: %d files, errors %v", len(report.Files), report.Errors)
+	}
+	if _, err := os.Stat(extractTestPath(matchDir, "Dir2\\Sub\\File02.dat")); err != nil {
+		t.Errorf("matching file not extracted: %v", err)
+	}
+	if _, err := os.Stat(extractTestPath(matchDir, "Dir0\\Sub\\File00.dat")); err == nil {
+		t.Errorf("non-matching file was extracted")
+	}
+}
+
+// extractTestPath returns where ExtractAll writes an archive path.
+func extractTestPath(destDir, mpqPath string) string {
+	path, _ := extractPath(destDir, mpqPath)
+	return path
+}
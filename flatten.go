@@ -0,0 +1,169 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// FlattenOptions controls PatchChain.Flatten.
+type FlattenOptions struct {
+	Version    FormatVersion
+	MaxFiles   int           // Hash table capacity, 0 sizes it for the files written
+	Files      FileOptions   // Storage options for files that are encoded again
+	Recompress bool          // Encode every file with Files instead of copying blocks
+	Timestamps TimestampMode // TimestampsSource keeps the times stored in the source archives
+}
+
+// FlattenReport lists the files Flatten wrote. Each list holds chain paths,
+// sorted.
+type FlattenReport struct {
+	Copied  []string // Stored blocks copied without decompressing them
+	Encoded []string // Files decoded and stored again
+}
+
+// Flatten writes the effective contents of the chain to a single archive at
+// outPath: every file that lookups see is written once, from the archive
+// that supplies it. Files removed by deletion markers are left out, patch
+// files are applied, shadowed copies are dropped and pending changes are
+// included. (listfile) and (attributes) are generated for the new archive.
+//
+// Stored blocks are copied as they are when nothing about them has to
+// change. Files are decoded and stored again with opts.Files when they come
+// from a patch or a pending change, or when their sector size differs from
+// the new archive's; encrypted files stay encrypted. Copied blocks are read
+// from the source archives while the new archive is written rather than held
+// in memory, and FILE_FIX_KEY blocks are re-encrypted for their new position.
+func (p *PatchChain) Flatten(outPath string, opts FlattenOptions) (*FlattenReport, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	files, err := p.listFiles()
+	if err != nil {
+		return nil, err
+	}
+	names := globNames(files, "**", p.hasFile)
+
+	maxFiles := opts.MaxFiles
+	if maxFiles < len(names) {
+		maxFiles = len(names)
+	}
+	archive, err := CreateWithVersion(outPath, maxFiles, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.SetTimestamps(opts.Timestamps, time.Time{}); err != nil {
+		os.Remove(archive.tempPath)
+		return nil, err
+	}
+
+	report := &FlattenReport{}
+	if err := p.flattenFiles(archive, names, opts, report); err != nil {
+		os.Remove(archive.tempPath)
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// flattenFiles adds the effective version of each name to archive.
+func (p *PatchChain) flattenFiles(archive *Archive, names []string, opts FlattenOptions, report *FlattenReport) error {
+	// Attributes are loaded once per archive as they are needed
+	attrs := make(map[*Archive]*fileAttributes)
+
+	for _, name := range names {
+		if entry, ok := p.overlayEntry(name); ok {
+			data, err := p.readOverlay(entry)
+			if err != nil {
+				return err
+			}
+			fileOpts := entry.opts
+			fileOpts.PatchFile = false
+			if err := archive.addPending("", name, data, 0, fileOpts); err != nil {
+				return err
+			}
+			report.Encoded = append(report.Encoded, name)
+			continue
+		}
+
+		idx, err := p.locateFile(name)
+		if err != nil {
+			return err
+		}
+		src := p.archives[idx]
+		srcPath := p.archivePath(idx, name)
+
+		srcAttrs, loaded := attrs[src]
+		if !loaded {
+			srcAttrs, err = src.readAttributes()
+			if err != nil {
+				srcAttrs = nil
+			}
+			attrs[src] = srcAttrs
+		}
+		info, err := src.stat(srcPath, srcAttrs)
+		if err != nil {
+			return err
+		}
+		block := &src.blockTable[info.BlockIndex]
+		fileTime := timeToFiletime(info.Time)
+
+		if !opts.Recompress && canCopyBlock(block.Flags, src.sectorSize, archive.sectorSize) {
+			crc := info.CRC32
+			if !info.HasCRC32 {
+				data, err := src.readBlockData(block)
+				if err != nil {
+					return fmt.Errorf("read %s from %s: %w", name, src.path, err)
+				}
+				decoded, err := src.decodeBlock(srcPath, block, data)
+				if err != nil {
+					return fmt.Errorf("read %s from %s: %w", name, src.path, err)
+				}
+				crc = crc32(decoded)
+			}
+
+			// The block is streamed from the source archive on Close
+			archive.pendingFiles = append(archive.pendingFiles, pendingFile{
+				mpqPath:  name,
+				locale:   info.Locale,
+				fileTime: fileTime,
+				raw:      src.rawBlock(block, crc),
+			})
+			report.Copied = append(report.Copied, name)
+			continue
+		}
+
+		data, err := p.readArchives(name)
+		if err != nil {
+			return err
+		}
+		fileOpts := opts.Files
+		fileOpts.Locale = info.Locale
+		if block.Flags&fileEncrypted != 0 && block.Flags&filePatchFile == 0 {
+			fileOpts.Encrypt = true
+			fileOpts.FixKey = block.Flags&fileFixKey != 0
+		}
+		if err := archive.addPending("", name, data, fileTime, fileOpts); err != nil {
+			return err
+		}
+		report.Encoded = append(report.Encoded, name)
+	}
+	return nil
+}
+
+// canCopyBlock reports whether a block with flags can be stored unchanged in
+// an archive with dstSectorSize. Patch files have to be applied, and
+// compressed or encrypted sectors depend on the sector size.
+func canCopyBlock(flags, srcSectorSize, dstSectorSize uint32) bool {
+	if flags&(filePatchFile|fileDeleteMarker) != 0 {
+		return false
+	}
+	sectored := flags&fileSingleUnit == 0 && flags&(fileCompress|fileImplode|fileEncrypted) != 0
+	return !sectored || srcSectorSize == dstSectorSize
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchChainFlatten(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_flatten_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	large := bytes.Repeat([]byte("sectored data "), 2000)
+	spells := bytes.Repeat([]byte("spell record "), 300)
+	newSpells := append(append([]byte(nil), spells...), "new spell"...)
+
+	basePath := filepath.Join(tmpDir, "base.mpq")
+	base, err := Create(basePath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	add := func(archive *Archive, data []byte, name string, opts FileOptions) {
+		t.Helper()
+		if err := archive.AddFileData(data, name, opts); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	add(base, []byte("plain"), "Data\\plain.txt", FileOptions{})
+	add(base, large, "Data\\large.bin", FileOptions{SectorCRC: true})
+	add(base, []byte("secret"), "Data\\secret.txt", FileOptions{Encrypt: true})
+	add(base, large, "Data\\fixkey.bin", FileOptions{FixKey: true})
+	add(base, []byte("old"), "Data\\override.txt", FileOptions{})
+	add(base, []byte("doomed"), "Data\\deleted.txt", FileOptions{})
+	add(base, spells, "DBFilesClient\\Spell.dbc", FileOptions{})
+	if err := base.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	patchPath := filepath.Join(tmpDir, "patch.mpq")
+	patch, err := Create(patchPath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	add(patch, []byte("new"), "Data\\override.txt", FileOptions{})
+	add(patch, []byte("added"), "Data\\added.txt", FileOptions{})
+	if err := patch.AddIncrementalPatchData(spells, newSpells, "DBFilesClient\\Spell.dbc", FileOptions{}); err != nil {
+		t.Fatalf("add patch: %v", err)
+	}
+	patch.AddDeleteMarker("Data\\deleted.txt")
+	if err := patch.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	chain, err := OpenPatchChain([]string{basePath, patchPath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+	if err := chain.WriteFile("Data\\pending.txt", []byte("pending"), FileOptions{}); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	outPath := filepath.Join(tmpDir, "flat.mpq")
+	report, err := chain.Flatten(outPath, FlattenOptions{})
+	if err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+
+	wantCopied := []string{"Data\\added.txt", "Data\\fixkey.bin", "Data\\large.bin", "Data\\override.txt", "Data\\plain.txt", "Data\\secret.txt"}
+	wantEncoded := []string{"DBFilesClient\\Spell.dbc", "Data\\pending.txt"}
+	if !reflect.DeepEqual(report.Copied, wantCopied) {
+		t.Errorf("Copied = %v, want %v", report.Copied, wantCopied)
+	}
+	if !reflect.DeepEqual(report.Encoded, wantEncoded) {
+		t.Errorf("Encoded = %v, want %v", report.Encoded, wantEncoded)
+	}
+
+	flat, err := Open(outPath)
+	if err != nil {
+		t.Fatalf("open flattened archive: %v", err)
+	}
+	defer flat.Close()
+
+	files, err := flat.ListFiles()
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	if len(files) != len(wantCopied)+len(wantEncoded) {
+		t.Errorf("flattened archive lists %v", files)
+	}
+	for _, name := range files {
+		want, err := chain.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s from chain: %v", name, err)
+		}
+		got, err := flat.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs from the chain", name)
+		}
+	}
+	if flat.HasFile("Data\\deleted.txt") || flat.IsDeleteMarker("Data\\deleted.txt") {
+		t.Error("deleted file was written")
+	}
+	if flat.IsPatchFile("DBFilesClient\\Spell.dbc") {
+		t.Error("patch was stored instead of the patched file")
+	}
+
+	info, err := flat.Stat("Data\\fixkey.bin")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if !info.Flags.Encrypted() || !info.Flags.FixKey() {
+		t.Errorf("fixkey.bin flags = %v", info.Flags)
+	}
+
+	verify, err := flat.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !verify.OK() {
+		t.Errorf("flattened archive failed verification: %+v", verify)
+	}
+
+	// Recompress encodes everything again
+	report, err = chain.Flatten(filepath.Join(tmpDir, "recompressed.mpq"), FlattenOptions{Recompress: true})
+	if err != nil {
+		t.Fatalf("flatten with recompression: %v", err)
+	}
+	if len(report.Copied) != 0 || len(report.Encoded) != len(wantCopied)+len(wantEncoded) {
+		t.Errorf("recompress report = %+v", report)
+	}
+}
@@ -192,6 +192,10 @@ func findArchiveHeader(r io.ReadSeeker) (*archiveHeader, error) {
 			header.ArchiveOffset = offset
 			return header, nil
 		case mpqUserDataMagic:
+			// Seek back so the magic is read as part of the header
+			if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+				return nil, err
+			}
 			var userHeader userDataHeader
 			if err := binary.Read(r, binary.LittleEndian, &userHeader); err != nil {
 				return nil, err
@@ -0,0 +1,204 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GameDataOptions controls OpenGameData.
+type GameDataOptions struct {
+	// Locale selects the locale folder, e.g. "enUS". If empty, the only
+	// locale folder in the data directory is used; with none, only the
+	// locale-independent archives are loaded.
+	Locale string
+
+	// DetectPrefixes detects "base\" and locale prefixes in the loaded
+	// archives (see PatchChainOptions).
+	DetectPrefixes bool
+}
+
+// GameDataReport describes the archives OpenGameData loaded.
+type GameDataReport struct {
+	Locale   string   // Locale folder used, or "" if none
+	Archives []string // Archive paths in load order, lowest priority first
+	Ignored  []string // MPQ files in the data directories the client does not load
+}
+
+// gameDataBaseArchives are the main archives in the data directory, in load order.
+var gameDataBaseArchives = []string{
+	"common.mpq", "common-2.mpq", "expansion.mpq", "lichking.mpq",
+}
+
+// gameDataLocaleArchives are the archives in the locale folder, in load
+// order. %s is the locale.
+var gameDataLocaleArchives = []string{
+	"locale-%s.mpq", "speech-%s.mpq",
+	"expansion-locale-%s.mpq", "lichking-locale-%s.mpq",
+	"expansion-speech-%s.mpq", "lichking-speech-%s.mpq",
+}
+
+// OpenGameData opens the archives of a WoW 3.3.5a client's Data directory as a
+// patch chain, in the order the client loads them:
+//
+//	common.MPQ, common-2.MPQ, expansion.MPQ, lichking.MPQ
+//	<locale>\locale-<locale>.MPQ, speech-, expansion-locale-, lichking-locale-,
+//	expansion-speech- and lichking-speech-<locale>.MPQ
+//	patch.MPQ, patch-2.MPQ ... patch-9.MPQ, patch-A.MPQ ... patch-Z.MPQ
+//	<locale>\patch-<locale>.MPQ, patch-<locale>-2.MPQ ... patch-<locale>-Z.MPQ
+//
+// Later archives have higher priority. File names are matched
+// case-insensitively and suffixes are single characters, so patch-10.MPQ is
+// not loaded. Missing archives are skipped, and MPQ files that do not fit the scheme
+// are listed in the report as ignored.
+func OpenGameData(dataDir string, opts GameDataOptions) (*PatchChain, *GameDataReport, error) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read data directory: %w", err)
+	}
+
+	locale, localeDir, err := gameDataLocale(dataDir, entries, opts.Locale)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rootFiles := mpqFileNames(entries)
+	var localeFiles map[string]string
+	if localeDir != "" {
+		localeEntries, err := os.ReadDir(localeDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read locale directory: %w", err)
+		}
+		localeFiles = mpqFileNames(localeEntries)
+	}
+
+	report := &GameDataReport{Locale: locale}
+	add := func(dir string, files map[string]string, name string) {
+		if actual, ok := files[name]; ok {
+			report.Archives = append(report.Archives, filepath.Join(dir, actual))
+			delete(files, name)
+		}
+	}
+
+	for _, name := range gameDataBaseArchives {
+		add(dataDir, rootFiles, name)
+	}
+	for _, name := range gameDataLocaleArchives {
+		add(localeDir, localeFiles, fmt.Sprintf(name, strings.ToLower(locale)))
+	}
+	for _, name := range patchSeries(rootFiles, "patch") {
+		add(dataDir, rootFiles, name)
+	}
+	if locale != "" {
+		for _, name := range patchSeries(localeFiles, "patch-"+strings.ToLower(locale)) {
+			add(localeDir, localeFiles, name)
+		}
+	}
+
+	for _, actual := range rootFiles {
+		report.Ignored = append(report.Ignored, filepath.Join(dataDir, actual))
+	}
+	for _, actual := range localeFiles {
+		report.Ignored = append(report.Ignored, filepath.Join(localeDir, actual))
+	}
+	sort.Strings(report.Ignored)
+
+	if len(report.Archives) == 0 {
+		return nil, report, fmt.Errorf("no game archives found in %s", dataDir)
+	}
+
+	chain, err := OpenPatchChainWithOptions(report.Archives, PatchChainOptions{DetectPrefixes: opts.DetectPrefixes})
+	if err != nil {
+		return nil, report, err
+	}
+	return chain, report, nil
+}
+
+// gameDataLocale returns the locale to load and its folder.
+func gameDataLocale(dataDir string, entries []os.DirEntry, want string) (string, string, error) {
+	var locales []string
+	dirs := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		for _, locale := range patchPrefixLocales {
+			if strings.EqualFold(entry.Name(), locale) {
+				locales = append(locales, locale)
+				dirs[locale] = entry.Name()
+			}
+		}
+	}
+
+	if want == "" {
+		switch len(locales) {
+		case 0:
+			return "", "", nil
+		case 1:
+			want = locales[0]
+		default:
+			return "", "", fmt.Errorf("multiple locales in %s (%s), set GameDataOptions.Locale", dataDir, strings.Join(locales, ", "))
+		}
+	}
+
+	for _, locale := range locales {
+		if strings.EqualFold(locale, want) {
+			return locale, filepath.Join(dataDir, dirs[locale]), nil
+		}
+	}
+	return "", "", fmt.Errorf("locale %s not found in %s", want, dataDir)
+}
+
+// mpqFileNames maps the lowercase names of the .mpq files in entries to
+// their names on disk.
+func mpqFileNames(entries []os.DirEntry) map[string]string {
+	files := make(map[string]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(name), ".mpq") {
+			continue
+		}
+		files[strings.ToLower(name)] = name
+	}
+	return files
+}
+
+// patchSeries returns the lowercase names of the archives in files that
+// belong to the patch series stem ("patch" or "patch-<locale>"), in load
+// order: stem.mpq, then the suffixes 2 to 9, then A to Z. Other suffixes,
+// such as -10, are not part of the series.
+func patchSeries(files map[string]string, stem string) []string {
+	type patch struct {
+		name  string
+		order int
+	}
+	var series []patch
+	for name := range files {
+		base := strings.TrimSuffix(name, ".mpq")
+		if base == stem {
+			series = append(series, patch{name, 0})
+			continue
+		}
+		suffix, ok := strings.CutPrefix(base, stem+"-")
+		if !ok || suffix == "" {
+			continue
+		}
+		// The client only loads single-character suffixes; digits sort
+		// before letters
+		if len(suffix) == 1 && (suffix[0] >= '2' && suffix[0] <= '9' || suffix[0] >= 'a' && suffix[0] <= 'z') {
+			series = append(series, patch{name, int(suffix[0])})
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool { return series[i].order < series[j].order })
+	names := make([]string, len(series))
+	for i, p := range series {
+		names[i] = p.name
+	}
+	return names
+}
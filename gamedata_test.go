@@ -0,0 +1,107 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenGameData(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_gamedata_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dataDir := filepath.Join(tmpDir, "Data")
+	localeDir := filepath.Join(dataDir, "enUS")
+	if err := os.MkdirAll(localeDir, 0755); err != nil {
+		t.Fatalf("create data dir: %v", err)
+	}
+
+	// Each archive stores its own name in version.txt
+	names := []string{
+		"Patch-B.mpq", "patch-A.MPQ", "patch-10.MPQ", "patch-3.MPQ", "patch-2.MPQ",
+		"patch.MPQ", "lichking.MPQ", "expansion.MPQ", "common-2.MPQ", "common.MPQ",
+		"enUS/patch-enUS-2.MPQ", "enUS/patch-enUS.MPQ", "enUS/lichking-locale-enUS.MPQ",
+		"enUS/locale-enUS.MPQ", "wow-update-12340.MPQ", "patch-enUS.MPQ",
+	}
+	for _, name := range names {
+		archive, err := Create(filepath.Join(dataDir, name), 10)
+		if err != nil {
+			t.Fatalf("create archive: %v", err)
+		}
+		if err := archive.AddFileData([]byte(name), "version.txt", FileOptions{}); err != nil {
+			t.Fatalf("add file: %v", err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+	}
+
+	chain, report, err := OpenGameData(dataDir, GameDataOptions{})
+	if err != nil {
+		t.Fatalf("open game data: %v", err)
+	}
+	defer chain.Close()
+
+	var loaded []string
+	for _, path := range report.Archives {
+		rel, _ := filepath.Rel(dataDir, path)
+		loaded = append(loaded, filepath.ToSlash(rel))
+	}
+	want := []string{
+		"common.MPQ", "common-2.MPQ", "expansion.MPQ", "lichking.MPQ",
+		"enUS/locale-enUS.MPQ", "enUS/lichking-locale-enUS.MPQ",
+		"patch.MPQ", "patch-2.MPQ", "patch-3.MPQ", "patch-A.MPQ", "Patch-B.mpq",
+		"enUS/patch-enUS.MPQ", "enUS/patch-enUS-2.MPQ",
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("load order:\n got %v\nwant %v", loaded, want)
+	}
+	if report.Locale != "enUS" {
+		t.Errorf("locale = %q", report.Locale)
+	}
+	wantIgnored := []string{
+		filepath.Join(dataDir, "patch-10.MPQ"),
+		filepath.Join(dataDir, "patch-enUS.MPQ"),
+		filepath.Join(dataDir, "wow-update-12340.MPQ"),
+	}
+	if !reflect.DeepEqual(report.Ignored, wantIgnored) {
+		t.Errorf("ignored = %v, want %v", report.Ignored, wantIgnored)
+	}
+
+	if chain.GetArchiveCount() != len(want) {
+		t.Errorf("chain has %d archives, want %d", chain.GetArchiveCount(), len(want))
+	}
+	data, err := chain.ReadFile("version.txt")
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	if string(data) != "enUS/patch-enUS-2.MPQ" {
+		t.Errorf("version.txt from %q, want the last locale patch", data)
+	}
+
+	// A second locale makes the choice ambiguous
+	if err := os.Mkdir(filepath.Join(dataDir, "deDE"), 0755); err != nil {
+		t.Fatalf("create locale dir: %v", err)
+	}
+	if _, _, err := OpenGameData(dataDir, GameDataOptions{}); err == nil {
+		t.Error("expected error for multiple locales")
+	}
+	chain2, report, err := OpenGameData(dataDir, GameDataOptions{Locale: "dede"})
+	if err != nil {
+		t.Fatalf("open game data with locale: %v", err)
+	}
+	defer chain2.Close()
+	if report.Locale != "deDE" || len(report.Archives) != 9 {
+		t.Errorf("deDE report: %s with %d archives", report.Locale, len(report.Archives))
+	}
+	if _, _, err := OpenGameData(dataDir, GameDataOptions{Locale: "frFR"}); err == nil {
+		t.Error("expected error for a missing locale")
+	}
+}
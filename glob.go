@@ -0,0 +1,77 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// matchGlob reports whether a slash-separated name matches pattern.
+// Each pattern element uses path.Match syntax; an element of "**" matches
+// any number of path elements, including none.
+func matchGlob(pattern, name string) bool {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every possible split
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range name {
+				if matchGlobParts(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+// globBase returns the leading elements of a slash-separated pattern that
+// contain no wildcards, e.g. "dbc/enUS" for "dbc/enUS/**/*.dbc".
+func globBase(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[\\") {
+			return strings.Join(parts[:i], "/")
+		}
+	}
+	return pattern
+}
+
+// matchArchivePath reports whether an archive path matches pattern using MPQ
+// semantics: case-insensitive, with / and \ both accepted as separators.
+func matchArchivePath(pattern, name string) bool {
+	pattern = strings.ToLower(strings.ReplaceAll(pattern, "\\", "/"))
+	name = strings.ToLower(strings.ReplaceAll(name, "\\", "/"))
+	return matchGlob(pattern, name)
+}
+
+// validateGlob checks that every element of a pattern is well formed.
+func validateGlob(pattern string) error {
+	for _, part := range strings.Split(strings.ReplaceAll(pattern, "\\", "/"), "/") {
+		if _, err := path.Match(part, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
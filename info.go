@@ -0,0 +1,179 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileFlags are the flags of a block table entry.
+type FileFlags uint32
+
+// fileFlagNames lists the known flags in the order String prints them.
+var fileFlagNames = []struct {
+	flag FileFlags
+	name string
+}{
+	{fileImplode, "implode"},
+	{fileCompress, "compress"},
+	{fileEncrypted, "encrypted"},
+	{fileFixKey, "fix_key"},
+	{filePatchFile, "patch_file"},
+	{fileSingleUnit, "single_unit"},
+	{fileDeleteMarker, "delete_marker"},
+	{fileSectorCRC, "sector_crc"},
+	{fileExists, "exists"},
+}
+
+// Exists reports whether the block holds a file (FILE_EXISTS).
+func (f FileFlags) Exists() bool { return f&fileExists != 0 }
+
+// Imploded reports whether the file is PKWare imploded (FILE_IMPLODE).
+func (f FileFlags) Imploded() bool { return f&fileImplode != 0 }
+
+// Compressed reports whether the file is compressed (FILE_COMPRESS).
+func (f FileFlags) Compressed() bool { return f&fileCompress != 0 }
+
+// Encrypted reports whether the file is encrypted (FILE_ENCRYPTED).
+func (f FileFlags) Encrypted() bool { return f&fileEncrypted != 0 }
+
+// FixKey reports whether the encryption key is adjusted by the block offset (FILE_FIX_KEY).
+func (f FileFlags) FixKey() bool { return f&fileFixKey != 0 }
+
+// PatchFile reports whether the file is a patch file (FILE_PATCH_FILE).
+func (f FileFlags) PatchFile() bool { return f&filePatchFile != 0 }
+
+// SingleUnit reports whether the file is stored as a single unit (FILE_SINGLE_UNIT).
+func (f FileFlags) SingleUnit() bool { return f&fileSingleUnit != 0 }
+
+// DeleteMarker reports whether the file is a deletion marker (FILE_DELETE_MARKER).
+func (f FileFlags) DeleteMarker() bool { return f&fileDeleteMarker != 0 }
+
+// SectorCRC reports whether the file has sector checksums (FILE_SECTOR_CRC).
+func (f FileFlags) SectorCRC() bool { return f&fileSectorCRC != 0 }
+
+// String returns the flag names separated by "|", e.g. "compress|single_unit|exists".
+// Unknown bits are printed in hexadecimal.
+func (f FileFlags) String() string {
+	var names []string
+	rest := f
+	for _, fn := range fileFlagNames {
+		if f&fn.flag != 0 {
+			names = append(names, fn.name)
+			rest &^= fn.flag
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("0x%08X", uint32(rest)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// ArchiveInfo describes an archive's header and tables.
+type ArchiveInfo struct {
+	FormatVersion FormatVersion
+	HeaderSize    uint32
+	SectorSize    uint32
+	ArchiveOffset uint64 // File offset of the MPQ header
+	ArchiveSize   uint64 // Size from the MPQ header to the end of the last table
+
+	HashTableOffset  uint64  // Offset relative to the MPQ header
+	HashTableSize    uint32  // Number of hash table entries
+	HashTableUsed    uint32  // Entries that reference a block
+	HashTableDeleted uint32  // Entries marked as deleted
+	HashTableFill    float64 // Fraction of entries in use (used + deleted)
+
+	BlockTableOffset   uint64 // Offset relative to the MPQ header
+	BlockTableSize     uint32 // Number of block table entries
+	HiBlockTableOffset uint64 // Offset of the V2 hi-block table, 0 if absent
+
+	UserData *UserDataInfo // User data header, nil if absent
+	Blocks   []BlockInfo   // One entry per block table entry
+}
+
+// UserDataInfo describes an MPQ\x1B user data header.
+type UserDataInfo struct {
+	Offset             uint64 // File offset of the user data header
+	UserDataSize       uint32
+	HeaderOffset       uint32 // Offset of the MPQ header relative to the user data header
+	UserDataHeaderSize uint32
+	Data               []byte // Contents of the user data block
+}
+
+// BlockInfo describes a block table entry.
+type BlockInfo struct {
+	Index          int
+	Offset         uint64 // Offset of the file data relative to the MPQ header
+	CompressedSize uint32
+	FileSize       uint32
+	Flags          FileFlags
+}
+
+// Info returns the archive's header fields, table statistics and block table.
+func (a *Archive) Info() (*ArchiveInfo, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	h := a.header
+	info := &ArchiveInfo{
+		FormatVersion:    a.formatVersion,
+		HeaderSize:       h.HeaderSize,
+		SectorSize:       a.sectorSize,
+		ArchiveOffset:    h.ArchiveOffset,
+		ArchiveSize:      a.archiveDataSize(),
+		HashTableOffset:  h.getHashTableOffset64(),
+		HashTableSize:    h.HashTableSize,
+		BlockTableOffset: h.getBlockTableOffset64(),
+		BlockTableSize:   h.BlockTableSize,
+	}
+	if h.FormatVersion >= formatVersion2 {
+		info.FormatVersion = FormatV2
+		info.HiBlockTableOffset = h.HiBlockTableOffset64
+	}
+
+	for _, entry := range a.hashTable {
+		switch entry.BlockIndex {
+		case hashTableEmpty:
+		case hashTableDeleted:
+			info.HashTableDeleted++
+		default:
+			info.HashTableUsed++
+		}
+	}
+	if h.HashTableSize > 0 {
+		info.HashTableFill = float64(info.HashTableUsed+info.HashTableDeleted) / float64(h.HashTableSize)
+	}
+
+	if h.UserData != nil {
+		data, err := a.UserData()
+		if err != nil {
+			return nil, fmt.Errorf("read user data: %w", err)
+		}
+		info.UserData = &UserDataInfo{
+			Offset:             a.signedDataStart(),
+			UserDataSize:       h.UserData.UserDataSize,
+			HeaderOffset:       h.UserData.HeaderOffset,
+			UserDataHeaderSize: h.UserData.UserDataHeaderSize,
+			Data:               data,
+		}
+	}
+
+	info.Blocks = make([]BlockInfo, len(a.blockTable))
+	for i, block := range a.blockTable {
+		info.Blocks[i] = BlockInfo{
+			Index:          i,
+			Offset:         block.getFilePos64(),
+			CompressedSize: block.CompressedSize,
+			FileSize:       block.FileSize,
+			Flags:          FileFlags(block.Flags),
+		}
+	}
+
+	return info, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveInfo(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_info_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Info test content, info test content, info test content"), 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	mpqPath := filepath.Join(tmpDir, "info.mpq")
+	archive, err := CreateV2(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetUserData([]byte("user data")); err != nil {
+		t.Fatalf("set user data: %v", err)
+	}
+	if err := archive.AddFile(testFile, "Data\\One.txt"); err != nil {
+		t.Fatalf("add file 1: %v", err)
+	}
+	if err := archive.AddFileWithCRC(testFile, "Data\\Two.txt"); err != nil {
+		t.Fatalf("add file 2: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	info, err := readArchive.Info()
+	if err != nil {
+		t.Fatalf("info: %v", err)
+	}
+
+	if info.FormatVersion != FormatV2 {
+		t.Errorf("format version = %d, want %d", info.FormatVersion, FormatV2)
+	}
+	if info.HeaderSize != headerSizeV2 {
+		t.Errorf("header size = %d, want %d", info.HeaderSize, headerSizeV2)
+	}
+	if info.SectorSize != 4096 {
+		t.Errorf("sector size = %d, want 4096", info.SectorSize)
+	}
+	if info.ArchiveOffset != headerAlignment {
+		t.Errorf("archive offset = 0x%X, want 0x%X", info.ArchiveOffset, headerAlignment)
+	}
+	if info.HashTableSize != 16 || info.HashTableUsed != 4 {
+		t.Errorf("hash table = %d used of %d, want 4 of 16", info.HashTableUsed, info.HashTableSize)
+	}
+	if info.HashTableFill != 0.25 {
+		t.Errorf("hash table fill = %v, want 0.25", info.HashTableFill)
+	}
+	if info.BlockTableSize != 4 || len(info.Blocks) != 4 {
+		t.Errorf("block table size = %d (%d blocks), want 4", info.BlockTableSize, len(info.Blocks))
+	}
+	if info.UserData == nil || string(info.UserData.Data) != "user data" || info.UserData.Offset != 0 {
+		t.Errorf("unexpected user data info: %+v", info.UserData)
+	}
+
+	if !info.Blocks[1].Flags.SectorCRC() || info.Blocks[0].Flags.SectorCRC() {
+		t.Errorf("sector CRC flags not decoded: %v, %v", info.Blocks[0].Flags, info.Blocks[1].Flags)
+	}
+	for _, block := range info.Blocks {
+		if !block.Flags.Exists() || !block.Flags.SingleUnit() {
+			t.Errorf("block %d flags = %v, want exists and single unit", block.Index, block.Flags)
+		}
+		if block.Offset < uint64(info.HeaderSize) || block.Offset >= info.HashTableOffset {
+			t.Errorf("block %d offset 0x%X outside data area", block.Index, block.Offset)
+		}
+	}
+}
+
+func TestFileFlagsString(t *testing.T) {
+	tests := []struct {
+		flags FileFlags
+		want  string
+	}{
+		{0, "none"},
+		{fileExists, "exists"},
+		{fileCompress | fileSingleUnit | fileExists, "compress|single_unit|exists"},
+		{fileEncrypted | fileFixKey | fileExists | 0x10, "encrypted|fix_key|exists|0x00000010"},
+	}
+
+	for _, test := range tests {
+		if got := test.flags.String(); got != test.want {
+			t.Errorf("FileFlags(0x%08X).String() = %q, want %q", uint32(test.flags), got, test.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Manifest describes how CreateFromDir maps the files of a directory tree to
+// archive paths and storage options.
+//
+// Manifests are JSON and read with LoadManifest or ParseManifest; other
+// formats have to be converted to JSON or to a Manifest by the caller.
+//
+// Example (JSON):
+//
+//	{
+//	  "exclude": ["**/*.psd", "README.md"],
+//	  "defaults": {"crc": true},
+//	  "rules": [
+//	    {"match": "dbc/*.dbc", "path": "DBFilesClient\\"},
+//	    {"match": "interface/**", "path": "Interface\\", "compression": "none"},
+//	    {"match": "locale/enUS/**", "path": "Interface\\", "locale": 1033}
+//	  ]
+//	}
+type Manifest struct {
+	Exclude  []string       `json:"exclude,omitempty"` // Globs of files to leave out
+	Defaults FileOptions    `json:"defaults"`          // Options for files no rule matches
+	Rules    []ManifestRule `json:"rules,omitempty"`
+}
+
+// ManifestRule maps the files matching a glob to archive paths and options.
+// Rules are tried in order and the first match wins; its options replace the
+// manifest defaults rather than being merged with them.
+//
+// Globs are matched against paths relative to the root directory using
+// forward slashes. Each element uses path.Match syntax and "**" matches any
+// number of directories.
+//
+// Path selects the archive path: empty keeps the relative path; a path ending
+// in a slash or backslash is a directory that receives the file's path
+// relative to the literal part of Match (for "dbc/*.dbc" and "DBFilesClient\",
+// dbc/Spell.dbc becomes DBFilesClient\Spell.dbc); anything else is used as is
+// and should only be used for rules that match a single file.
+type ManifestRule struct {
+	Match string `json:"match"`
+	Path  string `json:"path,omitempty"`
+	FileOptions
+}
+
+// BuildOptions controls CreateFromDir.
+type BuildOptions struct {
+	Version  FormatVersion
+	MaxFiles int       // Hash table capacity, 0 sizes it for the files found
+	Manifest *Manifest // nil adds every file under its relative path with default options
+}
+
+// ParseManifest decodes a JSON manifest. Unknown fields are rejected so that
+// misspelled options do not go unnoticed.
+func ParseManifest(data []byte) (*Manifest, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadManifest reads a JSON manifest from a file.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	return ParseManifest(data)
+}
+
+// validate checks that all globs are well formed.
+func (m *Manifest) validate() error {
+	for _, pattern := range m.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("manifest exclude %q: %w", pattern, err)
+		}
+	}
+	for i, rule := range m.Rules {
+		if rule.Match == "" {
+			return fmt.Errorf("manifest rule %d: missing match", i)
+		}
+		if _, err := path.Match(rule.Match, ""); err != nil {
+			return fmt.Errorf("manifest rule %d %q: %w", i, rule.Match, err)
+		}
+	}
+	return nil
+}
+
+// resolve returns the archive path and options for a file, given its
+// slash-separated path relative to the root. It returns false if the file is
+// excluded.
+func (m *Manifest) resolve(rel string) (string, FileOptions, bool) {
+	for _, pattern := range m.Exclude {
+		if matchGlob(pattern, rel) {
+			return "", FileOptions{}, false
+		}
+	}
+
+	for _, rule := range m.Rules {
+		if !matchGlob(rule.Match, rel) {
+			continue
+		}
+
+		target := strings.ReplaceAll(rule.Path, "/", "\\")
+		switch {
+		case target == "":
+			target = strings.ReplaceAll(rel, "/", "\\")
+		case strings.HasSuffix(target, "\\"):
+			sub := rel
+			if base := globBase(rule.Match); base != "" {
+				sub = strings.TrimPrefix(strings.TrimPrefix(rel, base), "/")
+				if sub == "" {
+					// The rule names a single file; keep its base name
+					sub = path.Base(rel)
+				}
+			}
+			target += strings.ReplaceAll(sub, "/", "\\")
+		}
+		return target, rule.FileOptions, true
+	}
+
+	return strings.ReplaceAll(rel, "/", "\\"), m.Defaults, true
+}
+
+// CreateFromDir creates an archive at path containing the files below root.
+// Without a manifest every file is added under its path relative to root,
+// with forward slashes converted to backslashes. Files are added in lexical
+// order of their relative paths.
+//
+// The returned archive is in write mode: further files, signing keys or user
+// data can be added before Close writes it to disk.
+func CreateFromDir(path, root string, opts BuildOptions) (*Archive, error) {
+	manifest := opts.Manifest
+	if manifest == nil {
+		manifest = &Manifest{}
+	} else if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+
+	type dirFile struct {
+		srcPath string
+		mpqPath string
+		opts    FileOptions
+	}
+	var files []dirFile
+	seen := make(map[string]string)
+
+	err := filepath.WalkDir(root, func(srcPath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, srcPath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		mpqPath, fileOpts, ok := manifest.resolve(rel)
+		if !ok {
+			return nil
+		}
+
+		// Archive paths are case-insensitive; the same path may exist once per locale
+		key := fmt.Sprintf("%s:%d", strings.ToUpper(mpqPath), fileOpts.Locale)
+		if other, exists := seen[key]; exists {
+			return fmt.Errorf("%s and %s both map to %s", other, rel, mpqPath)
+		}
+		seen[key] = rel
+
+		files = append(files, dirFile{srcPath, mpqPath, fileOpts})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", root, err)
+	}
+
+	maxFiles := opts.MaxFiles
+	if maxFiles < len(files) {
+		maxFiles = len(files)
+	}
+
+	archive, err := CreateWithVersion(path, maxFiles, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		if err := archive.AddFileEx(f.srcPath, f.mpqPath, f.opts); err != nil {
+			os.Remove(archive.tempPath)
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCreateFromDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_manifest_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, "mod")
+	for name, content := range map[string]string{
+		"dbc/Spell.dbc":               "spell records",
+		"dbc/Item.dbc":                "item records",
+		"interface/icons/Sword.blp":   "sword icon",
+		"locale/deDE/Strings.lua":     "german strings",
+		"patch/Spell.dbc.ptch":        "patch data",
+		"art/Source.psd":              "photoshop",
+		"README.md":                   "readme",
+		"interface/FrameXML/Main.xml": "<Ui/>",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	manifest, err := ParseManifest([]byte(`{
+		"exclude": ["**/*.psd", "README.md"],
+		"defaults": {"crc": true},
+		"rules": [
+			{"match": "dbc/*.dbc", "path": "DBFilesClient\\"},
+			{"match": "interface/**", "path": "Interface/", "compression": "none"},
+			{"match": "locale/deDE/**", "path": "Interface\\FrameXML\\", "locale": 1031},
+			{"match": "patch/Spell.dbc.ptch", "path": "DBFilesClient\\Spell.dbc", "patch": true, "locale": 1}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+
+	mpqPath := filepath.Join(tmpDir, "mod.mpq")
+	archive, err := CreateFromDir(mpqPath, root, BuildOptions{Version: FormatV2, Manifest: manifest})
+	if err != nil {
+		t.Fatalf("create from dir: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	files, err := readArchive.ListFiles()
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	sort.Strings(files)
+	want := []string{
+		"DBFilesClient\\Item.dbc",
+		"DBFilesClient\\Spell.dbc",
+		"DBFilesClient\\Spell.dbc",
+		"Interface\\FrameXML\\Main.xml",
+		"Interface\\FrameXML\\Strings.lua",
+		"Interface\\icons\\Sword.blp",
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+
+	checks := []struct {
+		mpqPath string
+		flags   FileFlags
+		locale  uint16
+	}{
+		{"DBFilesClient\\Item.dbc", fileSingleUnit, 0},
+		{"Interface\\icons\\Sword.blp", fileSingleUnit, 0},
+		{"Interface\\FrameXML\\Strings.lua", fileSingleUnit, 1031},
+	}
+	for _, check := range checks {
+		info, err := readArchive.Stat(check.mpqPath)
+		if err != nil {
+			t.Fatalf("stat %s: %v", check.mpqPath, err)
+		}
+		if info.Flags&^fileExists != check.flags || info.Locale != check.locale {
+			t.Errorf("%s: flags %v locale %d, want %v locale %d", check.mpqPath, info.Flags, info.Locale, check.flags, check.locale)
+		}
+	}
+
+	data, err := readArchive.ReadFile("Interface\\icons\\Sword.blp")
+	if err != nil || string(data) != "sword icon" {
+		t.Errorf("read mapped file: %q, %v", data, err)
+	}
+
+	// Two files mapping to the same path and locale is an error
+	dup := &Manifest{Rules: []ManifestRule{{Match: "dbc/*.dbc", Path: "Same.dbc"}}}
+	if _, err := CreateFromDir(filepath.Join(tmpDir, "dup.mpq"), root, BuildOptions{Manifest: dup}); err == nil {
+		t.Errorf("duplicate archive paths were accepted")
+	}
+
+	if _, err := ParseManifest([]byte(`{"rules": [{"match": "*", "compresion": "none"}]}`)); err == nil {
+		t.Errorf("unknown manifest field was accepted")
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.dbc", "Spell.dbc", true},
+		{"*.dbc", "dbc/Spell.dbc", false},
+		{"dbc/*.dbc", "dbc/Spell.dbc", true},
+		{"**/*.dbc", "Spell.dbc", true},
+		{"**/*.dbc", "a/b/Spell.dbc", true},
+		{"a/**", "a/b/c", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/x/c", true},
+		{"a/**/c", "a/b/x/d", false},
+		{"[", "x", false},
+	}
+
+	for _, test := range tests {
+		if got := matchGlob(test.pattern, test.name); got != test.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestModifyCopiesBlocks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_modify_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	large := bytes.Repeat([]byte("sectored data "), 2000)
+	files := []struct {
+		mpqPath string
+		data    []byte
+		opts    FileOptions
+	}{
+		{"Data\\bzip2.txt", bytes.Repeat([]byte("bzip2 "), 100), FileOptions{Compression: CompressionBzip2}},
+		{"Data\\large.bin", large, FileOptions{Compression: CompressionBzip2, SectorCRC: true}},
+		{"Data\\secret.txt", []byte("secret"), FileOptions{Encrypt: true}},
+		{"Data\\fixkey.txt", []byte("fixed key"), FileOptions{FixKey: true}},
+		{"Data\\fixkey.bin", large, FileOptions{FixKey: true, SectorCRC: true}},
+		{"Data\\German.txt", []byte("Deutsch"), FileOptions{Locale: 0x407}},
+	}
+
+	archivePath := filepath.Join(tmpDir, "test.mpq")
+	archive, err := Create(archivePath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileData(bytes.Repeat([]byte("doomed "), 500), "Data\\doomed.bin", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	for _, file := range files {
+		if err := archive.AddFileData(file.data, file.mpqPath, file.opts); err != nil {
+			t.Fatalf("add %s: %v", file.mpqPath, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	before, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	blocks := make(map[string]blockTableEntryEx)
+	for _, file := range files {
+		block, err := before.findFile(file.mpqPath)
+		if err != nil {
+			t.Fatalf("find %s: %v", file.mpqPath, err)
+		}
+		blocks[file.mpqPath] = *block
+	}
+	before.Close()
+
+	archive, err = OpenForModify(archivePath)
+	if err != nil {
+		t.Fatalf("open for modify: %v", err)
+	}
+	if err := archive.RemoveFile("Data\\doomed.bin"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	if err := archive.AddFileData([]byte("added"), "Data\\added.txt", FileOptions{}); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	after, err := Open(archivePath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer after.Close()
+
+	for _, file := range files {
+		block, err := after.findFile(file.mpqPath)
+		if err != nil {
+			t.Fatalf("find %s: %v", file.mpqPath, err)
+		}
+		old := blocks[file.mpqPath]
+		if block.Flags != old.Flags || block.CompressedSize != old.CompressedSize || block.FileSize != old.FileSize {
+			t.Errorf("%s: block flags 0x%X size %d/%d, want 0x%X size %d/%d", file.mpqPath,
+				block.Flags, block.CompressedSize, block.FileSize, old.Flags, old.CompressedSize, old.FileSize)
+		}
+		if file.opts.FixKey && block.getFilePos64() == old.getFilePos64() {
+			t.Errorf("%s: block did not move", file.mpqPath)
+		}
+
+		data, err := after.ReadFile(file.mpqPath)
+		if err != nil {
+			t.Fatalf("read %s: %v", file.mpqPath, err)
+		}
+		if !bytes.Equal(data, file.data) {
+			t.Errorf("%s: contents changed", file.mpqPath)
+		}
+	}
+
+	info, err := after.Stat("Data\\German.txt")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Locale != 0x407 {
+		t.Errorf("locale = 0x%X, want 0x407", info.Locale)
+	}
+	if after.HasFile("Data\\doomed.bin") || !after.HasFile("Data\\added.txt") {
+		t.Error("modification was not applied")
+	}
+
+	report, err := after.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("verify failed: %+v", report)
+	}
+}
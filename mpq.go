@@ -4,12 +4,14 @@
 package mpq
 
 import (
+	"crypto/rsa"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // FormatVersion specifies which MPQ format version to use when creating archives.
@@ -26,11 +28,16 @@ const (
 )
 
 // Archive represents an MPQ archive.
+//
+// An archive opened with Open is safe for concurrent reads: ReadFile,
+// ExtractFile, HasFile, ListFiles, Stat and the other read methods may be
+// called from many goroutines. Adding files and Close must not run
+// concurrently with other calls.
 type Archive struct {
 	file          *os.File
 	path          string
 	tempPath      string
-	mode          string // "r" for read, "w" for write, "m" for modify
+	mode          string // "r" for read, "w" for write, "m" for modify, "a" for append
 	header        *archiveHeader
 	hashTable     []hashTableEntry
 	blockTable    []blockTableEntryEx
@@ -38,6 +45,20 @@ type Archive struct {
 	removedFiles  map[string]bool // Files marked for removal in modify mode
 	sectorSize    uint32
 	formatVersion FormatVersion
+
+	prefixData  []byte // Raw data before the archive (e.g. HM3W header), written on Close
+	userData    []byte // Contents of the MPQ\x1B user data block, nil if none
+	leadingData []byte // Everything written before the archive header
+
+	weakSigningKey      *rsa.PrivateKey // Signs the archive on Close if set
+	strongSigningKey    *rsa.PrivateKey // Appends a strong signature on Close if set
+	strongSignatureTail []byte          // Hashed after the archive data for the strong signature
+
+	timestamps TimestampMode // File times written to (attributes)
+	fixedTime  time.Time     // Time written with TimestampsFixed
+
+	patchMetadata        *PatchMetadata // Written as (patch_metadata) on Close if set
+	patchMetadataChanged bool           // SetPatchMetadata was called
 }
 
 // pendingFile represents a file to be added to the archive.
@@ -48,6 +69,25 @@ type pendingFile struct {
 	generateCRC    bool // Whether to generate sector CRC for this file
 	isPatchFile    bool // Mark as a patch file (FILE_PATCH_FILE)
 	isDeleteMarker bool // Mark as a deletion marker (FILE_DELETE_MARKER)
+	compression    Compression
+	encrypt        bool      // Encrypt the file data (FILE_ENCRYPTED)
+	fixKey         bool      // Adjust the encryption key by block position (FILE_FIX_KEY)
+	locale         uint16    // Locale of the hash table entry
+	fileTime       uint64    // Modification time of the source (FILETIME), 0 if unknown
+	raw            *rawBlock // Stored block copied as is instead of encoding data
+}
+
+// rawBlock is a block copied from another archive without decoding it. The
+// stored bytes are streamed from src while the archive is written, so src
+// has to stay open until then.
+type rawBlock struct {
+	src      io.ReaderAt // Stored bytes, compressed and encrypted as in the source
+	offset   int64       // Position of the stored bytes in src
+	size     uint32      // Stored size
+	flags    uint32      // Block flags of the source
+	fileSize uint32      // Uncompressed size
+	crc32    uint32      // CRC32 of the uncompressed data, for (attributes)
+	filePos  uint64      // Position in the source archive, which FILE_FIX_KEY keys depend on
 }
 
 // Create creates a new MPQ archive using V1 format.
@@ -230,7 +270,9 @@ func Open(path string) (*Archive, error) {
 
 // OpenForModify opens an existing MPQ archive for modification.
 // This allows adding, removing, and replacing files in an existing archive.
-// The archive is re-written when Close() is called.
+// The archive is re-written when Close() is called. Files that were not
+// replaced keep their stored bytes, compression, encryption and CRCs;
+// FILE_FIX_KEY files are only re-encrypted for their new position.
 func OpenForModify(path string) (*Archive, error) {
 	// First open the archive for reading to load its contents
 	file, err := os.Open(path)
@@ -334,6 +376,13 @@ func OpenForModify(path string) (*Archive, error) {
 		formatVer = FormatV1
 	}
 
+	// Preserve prefix and user data in front of the archive
+	prefixData, userData, leadingData, err := readLeadingData(file, header)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("read user data: %w", err)
+	}
+
 	// Create temp file for modifications
 	dir := filepath.Dir(path)
 	tempFile, err := os.CreateTemp(dir, "mpq_*.tmp")
@@ -344,7 +393,7 @@ func OpenForModify(path string) (*Archive, error) {
 	tempPath := tempFile.Name()
 	tempFile.Close()
 
-	return &Archive{
+	archive := &Archive{
 		file:          file,
 		path:          path,
 		tempPath:      tempPath,
@@ -356,7 +405,22 @@ func OpenForModify(path string) (*Archive, error) {
 		removedFiles:  make(map[string]bool),
 		sectorSize:    512 << header.SectorSizeShift,
 		formatVersion: formatVer,
-	}, nil
+		prefixData:    prefixData,
+		userData:      userData,
+		leadingData:   leadingData,
+	}
+
+	// Keep writing file times if the archive already stores them
+	if attrs, err := archive.readAttributes(); err == nil && attrs != nil && attrs.fileTime != nil {
+		archive.timestamps = TimestampsSource
+	}
+
+	// Keep the patch metadata; its PatchMD5 is recomputed on Close
+	if meta, err := archive.readPatchMetadata(); err == nil {
+		archive.patchMetadata = meta
+	}
+
+	return archive, nil
 }
 
 // AddFile adds a file to the archive.
@@ -377,7 +441,7 @@ func (a *Archive) AddFileWithCRC(srcPath, mpqPath string) error {
 
 // AddFileWithOptions adds a file to the archive with specified options.
 func (a *Archive) AddFileWithOptions(srcPath, mpqPath string, generateCRC bool) error {
-	if a.mode != "w" && a.mode != "m" {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
 		return fmt.Errorf("archive not opened for writing or modification")
 	}
 
@@ -385,9 +449,9 @@ func (a *Archive) AddFileWithOptions(srcPath, mpqPath string, generateCRC bool)
 	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 
 	// Read file data
-	data, err := os.ReadFile(srcPath)
+	data, fileTime, err := readSourceFile(srcPath)
 	if err != nil {
-		return fmt.Errorf("read file %s: %w", srcPath, err)
+		return err
 	}
 
 	a.pendingFiles = append(a.pendingFiles, pendingFile{
@@ -395,6 +459,7 @@ func (a *Archive) AddFileWithOptions(srcPath, mpqPath string, generateCRC bool)
 		mpqPath:     mpqPath,
 		data:        data,
 		generateCRC: generateCRC,
+		fileTime:    fileTime,
 	})
 
 	return nil
@@ -403,7 +468,7 @@ func (a *Archive) AddFileWithOptions(srcPath, mpqPath string, generateCRC bool)
 // AddPatchFile adds a file marked as a patch file (FILE_PATCH_FILE).
 // Patch files are typically used in MPQ patch archives.
 func (a *Archive) AddPatchFile(srcPath, mpqPath string) error {
-	if a.mode != "w" && a.mode != "m" {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
 		return fmt.Errorf("archive not opened for writing or modification")
 	}
 
@@ -411,9 +476,9 @@ func (a *Archive) AddPatchFile(srcPath, mpqPath string) error {
 	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 
 	// Read file data
-	data, err := os.ReadFile(srcPath)
+	data, fileTime, err := readSourceFile(srcPath)
 	if err != nil {
-		return fmt.Errorf("read file %s: %w", srcPath, err)
+		return err
 	}
 
 	a.pendingFiles = append(a.pendingFiles, pendingFile{
@@ -421,6 +486,7 @@ func (a *Archive) AddPatchFile(srcPath, mpqPath string) error {
 		mpqPath:     mpqPath,
 		data:        data,
 		isPatchFile: true,
+		fileTime:    fileTime,
 	})
 
 	return nil
@@ -429,7 +495,7 @@ func (a *Archive) AddPatchFile(srcPath, mpqPath string) error {
 // AddDeleteMarker adds a deletion marker for a file.
 // This is used in patch archives to indicate that a file should be deleted.
 func (a *Archive) AddDeleteMarker(mpqPath string) error {
-	if a.mode != "w" && a.mode != "m" {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
 		return fmt.Errorf("archive not opened for writing or modification")
 	}
 
@@ -446,10 +512,10 @@ func (a *Archive) AddDeleteMarker(mpqPath string) error {
 }
 
 // RemoveFile marks a file for removal from the archive.
-// This is only valid for archives opened with OpenForModify.
-// The file will be excluded when the archive is re-written on Close().
+// This is only valid for archives opened with OpenForModify or OpenForAppend.
+// The file will be excluded when the archive is written on Close().
 func (a *Archive) RemoveFile(mpqPath string) error {
-	if a.mode != "m" {
+	if a.mode != "m" && a.mode != "a" {
 		return fmt.Errorf("archive not opened for modification")
 	}
 
@@ -470,30 +536,83 @@ func (a *Archive) RemoveFile(mpqPath string) error {
 // The mpqPath is the path within the archive (use backslashes or forward slashes).
 // This method is valid for archives opened with Open or OpenForModify.
 func (a *Archive) ExtractFile(mpqPath, destPath string) error {
-	if a.mode != "r" && a.mode != "m" {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
 		return fmt.Errorf("archive not opened for reading")
 	}
 
 	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 
-	// Find file in hash table
-	block, err := a.findFile(mpqPath)
+	fileData, err := a.readFile(mpqPath)
 	if err != nil {
 		return err
 	}
 
-	// Read file data
-	blockPos := block.getFilePos64()
-	filePos := blockPos + a.header.ArchiveOffset
-	if _, err := a.file.Seek(int64(filePos), io.SeekStart); err != nil {
-		return fmt.Errorf("seek to file data: %w", err)
+	// Ensure destination directory exists
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
 	}
 
-	compressedData := make([]byte, block.CompressedSize)
-	if _, err := io.ReadFull(a.file, compressedData); err != nil {
-		return fmt.Errorf("read file data: %w", err)
+	if err := os.WriteFile(destPath, fileData, 0644); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadFile returns the contents of a file in the archive.
+// The mpqPath is the path within the archive (use backslashes or forward slashes).
+// This method is valid for archives opened with Open or OpenForModify.
+func (a *Archive) ReadFile(mpqPath string) ([]byte, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	return a.readFile(strings.ReplaceAll(mpqPath, "/", "\\"))
+}
+
+// readFile locates a file and returns its decrypted, decompressed contents.
+func (a *Archive) readFile(mpqPath string) ([]byte, error) {
+	block, err := a.findFile(mpqPath)
+	if err != nil {
+		return nil, err
+	}
+
+	compressedData, err := a.readBlockData(block)
+	if err != nil {
+		return nil, err
 	}
 
+	return a.decodeBlock(mpqPath, block, compressedData)
+}
+
+// readBlockData reads the raw (possibly compressed and encrypted) bytes of a block.
+func (a *Archive) readBlockData(block *blockTableEntryEx) ([]byte, error) {
+	filePos := block.getFilePos64() + a.header.ArchiveOffset
+	data := make([]byte, block.CompressedSize)
+	if _, err := a.file.ReadAt(data, int64(filePos)); err != nil {
+		return nil, fmt.Errorf("read file data: %w", err)
+	}
+
+	return data, nil
+}
+
+// decodeBlock decrypts, decompresses and CRC-checks the raw data of a block.
+// The mpqPath is needed to derive the encryption key of encrypted files.
+func (a *Archive) decodeBlock(mpqPath string, block *blockTableEntryEx, compressedData []byte) ([]byte, error) {
+	// Patch files in WoW patch archives start with a TPatchInfo; the file
+	// data that follows decodes to the patch's size rather than FileSize
+	if block.Flags&filePatchFile != 0 {
+		if info, ok := parsePatchInfo(compressedData); ok && int(info.length) <= len(compressedData) {
+			patchBlock := *block
+			patchBlock.FileSize = info.dataSize
+			patchBlock.CompressedSize = uint32(len(compressedData)) - info.length
+			block = &patchBlock
+			compressedData = compressedData[info.length:]
+		}
+	}
+
+	blockPos := block.getFilePos64()
+	var err error
 	var fileData []byte
 
 	// Check if file is encrypted
@@ -506,13 +625,13 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 			// Single unit file - decrypt as one block
 			fileData, err = a.decryptAndDecompressSingleUnit(compressedData, block, encryptionKey)
 			if err != nil {
-				return fmt.Errorf("decrypt single unit file: %w", err)
+				return nil, fmt.Errorf("decrypt single unit file: %w", err)
 			}
 		} else {
 			// Sector-based file - decrypt each sector
 			fileData, err = a.decryptAndDecompressSectors(compressedData, block, encryptionKey)
 			if err != nil {
-				return fmt.Errorf("decrypt sectored file: %w", err)
+				return nil, fmt.Errorf("decrypt sectored file: %w", err)
 			}
 		}
 	} else if block.Flags&fileCompress != 0 {
@@ -520,24 +639,23 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 		if block.Flags&fileSingleUnit != 0 {
 			// Single unit compressed file
 			dataToDecompress := compressedData
-			
+
 			// Handle sector CRC for single unit files
 			if block.Flags&fileSectorCRC != 0 {
 				if len(compressedData) < 4 {
-					return fmt.Errorf("missing sector CRC for single unit file")
+					return nil, fmt.Errorf("missing sector CRC for single unit file")
 				}
 				dataToDecompress = compressedData[:len(compressedData)-4]
 				crcExpected := binary.LittleEndian.Uint32(compressedData[len(compressedData)-4:])
-				
+
 				// Decompress first, then validate CRC
 				decompressed, err := decompressData(dataToDecompress, block.FileSize)
 				if err != nil {
-					return fmt.Errorf("decompress file: %w", err)
+					return nil, fmt.Errorf("decompress file: %w", err)
 				}
-				
-				crcActual := adler32(decompressed)
-				if crcActual != crcExpected {
-					return fmt.Errorf("sector CRC mismatch: expected 0x%08X got 0x%08X", crcExpected, crcActual)
+
+				if !sectorCRCMatches(crcExpected, dataToDecompress, decompressed) {
+					return nil, fmt.Errorf("sector CRC mismatch: expected 0x%08X got 0x%08X", crcExpected, adler32(decompressed))
 				}
 				fileData = decompressed
 			} else {
@@ -545,7 +663,7 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 				if block.CompressedSize < block.FileSize {
 					fileData, err = decompressData(dataToDecompress, block.FileSize)
 					if err != nil {
-						return fmt.Errorf("decompress file: %w", err)
+						return nil, fmt.Errorf("decompress file: %w", err)
 					}
 				} else {
 					fileData = dataToDecompress
@@ -555,7 +673,7 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 			// Sector-based compressed file
 			fileData, err = a.decompressSectors(compressedData, block)
 			if err != nil {
-				return fmt.Errorf("decompress sectors: %w", err)
+				return nil, fmt.Errorf("decompress sectors: %w", err)
 			}
 		}
 	} else {
@@ -563,13 +681,13 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 		// Handle sector CRC for uncompressed single unit files
 		if block.Flags&fileSingleUnit != 0 && block.Flags&fileSectorCRC != 0 {
 			if len(compressedData) < 4 {
-				return fmt.Errorf("missing sector CRC for single unit file")
+				return nil, fmt.Errorf("missing sector CRC for single unit file")
 			}
 			payload := compressedData[:len(compressedData)-4]
 			crcExpected := binary.LittleEndian.Uint32(compressedData[len(compressedData)-4:])
 			crcActual := adler32(payload)
 			if crcActual != crcExpected {
-				return fmt.Errorf("sector CRC mismatch: expected 0x%08X got 0x%08X", crcExpected, crcActual)
+				return nil, fmt.Errorf("sector CRC mismatch: expected 0x%08X got 0x%08X", crcExpected, crcActual)
 			}
 			fileData = payload
 		} else {
@@ -577,16 +695,7 @@ func (a *Archive) ExtractFile(mpqPath, destPath string) error {
 		}
 	}
 
-	// Ensure destination directory exists
-	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
-		return fmt.Errorf("create directory: %w", err)
-	}
-
-	if err := os.WriteFile(destPath, fileData, 0644); err != nil {
-		return fmt.Errorf("write file: %w", err)
-	}
-
-	return nil
+	return fileData, nil
 }
 
 // decryptAndDecompressSingleUnit handles encrypted single-unit files
@@ -698,12 +807,8 @@ func (a *Archive) decryptAndDecompressSectors(data []byte, block *blockTableEntr
 			sectorOutput = sectorData
 		}
 
-		if len(sectorCRCs) > 0 {
-			crcActual := adler32(sectorOutput)
-			crcExpected := sectorCRCs[i]
-			if crcActual != crcExpected {
-				return nil, fmt.Errorf("sector CRC mismatch for sector %d: expected 0x%08X got 0x%08X", i, crcExpected, crcActual)
-			}
+		if len(sectorCRCs) > 0 && !sectorCRCMatches(sectorCRCs[i], sectorData, sectorOutput) {
+			return nil, fmt.Errorf("sector CRC mismatch for sector %d: expected 0x%08X got 0x%08X", i, sectorCRCs[i], adler32(sectorOutput))
 		}
 
 		result = append(result, sectorOutput...)
@@ -734,6 +839,19 @@ func (a *Archive) decompressSectors(data []byte, block *blockTableEntryEx) ([]by
 			uint32(data[i*4+3])<<24
 	}
 
+	// Read sector CRC table if present (it sits between the offset table and the first sector)
+	var sectorCRCs []uint32
+	if block.Flags&fileSectorCRC != 0 {
+		crcTableEnd := offsetTableSize + numSectors*4
+		if offsetTable[0] >= crcTableEnd && int(crcTableEnd) <= len(data) {
+			sectorCRCs = make([]uint32, numSectors)
+			for i := uint32(0); i < numSectors; i++ {
+				start := offsetTableSize + i*4
+				sectorCRCs[i] = binary.LittleEndian.Uint32(data[start : start+4])
+			}
+		}
+	}
+
 	// Allocate output buffer
 	result := make([]byte, 0, block.FileSize)
 
@@ -755,15 +873,20 @@ func (a *Archive) decompressSectors(data []byte, block *blockTableEntryEx) ([]by
 		}
 
 		// Decompress if sector is smaller than expected
+		sectorOutput := sectorData
 		if uint32(len(sectorData)) < expectedSize {
 			decompressed, err := decompressData(sectorData, expectedSize)
 			if err != nil {
 				return nil, fmt.Errorf("decompress sector %d: %w", i, err)
 			}
-			result = append(result, decompressed...)
-		} else {
-			result = append(result, sectorData...)
+			sectorOutput = decompressed
 		}
+
+		if len(sectorCRCs) > 0 && !sectorCRCMatches(sectorCRCs[i], sectorData, sectorOutput) {
+			return nil, fmt.Errorf("sector CRC mismatch for sector %d: expected 0x%08X got 0x%08X", i, sectorCRCs[i], adler32(sectorOutput))
+		}
+
+		result = append(result, sectorOutput...)
 	}
 
 	return result, nil
@@ -771,7 +894,7 @@ func (a *Archive) decompressSectors(data []byte, block *blockTableEntryEx) ([]by
 
 // ListFiles returns a list of files in the archive by reading the (listfile).
 func (a *Archive) ListFiles() ([]string, error) {
-	if a.mode != "r" && a.mode != "m" {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
 		return nil, fmt.Errorf("archive not opened for reading")
 	}
 
@@ -860,6 +983,7 @@ func (a *Archive) IsPatchFile(mpqPath string) bool {
 
 // Close closes the archive.
 // For archives opened with Create or OpenForModify, this writes the archive to disk.
+// For archives opened with OpenForAppend, the changes are written in place.
 func (a *Archive) Close() error {
 	if a.mode == "r" {
 		if a.file != nil {
@@ -868,6 +992,15 @@ func (a *Archive) Close() error {
 		return nil
 	}
 
+	if a.mode == "a" {
+		err := a.appendArchive()
+		if closeErr := a.file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("close archive: %w", closeErr)
+		}
+		a.file = nil
+		return err
+	}
+
 	// Write or modify mode - need to write the archive
 	if a.mode == "m" {
 		// Modify mode: build pending files from existing archive, excluding removed files
@@ -878,15 +1011,16 @@ func (a *Archive) Close() error {
 			os.Remove(a.tempPath)
 			return err
 		}
-		// Close the source file before writing
-		if a.file != nil {
-			a.file.Close()
-			a.file = nil
-		}
 	}
 
-	// Write the archive (works for both "w" and "m" modes)
-	if err := a.writeArchive(); err != nil {
+	// Write the archive (works for both "w" and "m" modes). Kept blocks
+	// are copied from the source file, which is closed afterwards
+	err := a.writeArchive()
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+	if err != nil {
 		os.Remove(a.tempPath)
 		return err
 	}
@@ -904,6 +1038,21 @@ func (a *Archive) Close() error {
 	return nil
 }
 
+// Abort closes the archive without writing pending changes. An archive
+// opened with Create is not created and one opened with OpenForModify or
+// OpenForAppend is left as it was.
+func (a *Archive) Abort() error {
+	var err error
+	if a.file != nil {
+		err = a.file.Close()
+		a.file = nil
+	}
+	if a.mode == "w" || a.mode == "m" {
+		os.Remove(a.tempPath)
+	}
+	return err
+}
+
 // buildModifiedFileList constructs the pending file list for modify mode.
 // It includes all existing files (not removed) plus any new/replaced files from pendingFiles.
 func (a *Archive) buildModifiedFileList() error {
@@ -913,10 +1062,22 @@ func (a *Archive) buildModifiedFileList() error {
 		return fmt.Errorf("list files: %w", err)
 	}
 
-	// Build a map of pending files for quick lookup
+	// Stored file times are kept for files that are not replaced
+	attrs, err := a.readAttributes()
+	if err != nil {
+		attrs = nil
+	}
+
+	// Build a map of pending files for quick lookup. The last version of a
+	// path wins; pendingOrder keeps new files in the order they were added
+	// so that the output does not depend on map iteration order.
 	pendingMap := make(map[string]pendingFile)
+	var pendingOrder []string
 	for _, pf := range a.pendingFiles {
 		normalizedPath := strings.ReplaceAll(pf.mpqPath, "/", "\\")
+		if _, exists := pendingMap[normalizedPath]; !exists {
+			pendingOrder = append(pendingOrder, normalizedPath)
+		}
 		pendingMap[normalizedPath] = pf
 	}
 
@@ -943,109 +1104,40 @@ func (a *Archive) buildModifiedFileList() error {
 			newPendingFiles = append(newPendingFiles, pending)
 			delete(pendingMap, normalizedPath) // Mark as processed
 		} else {
-			// Keep the existing file - extract its data
-			block, err := a.findFile(normalizedPath)
+			// Keep the existing file, copying its stored block as is
+			entry, err := a.findHashEntry(normalizedPath)
 			if err != nil {
 				continue // Skip files we can't find
 			}
+			block := &a.blockTable[entry.BlockIndex]
 
-			// Read the file data from the archive
-			if _, err := a.file.Seek(int64(block.getFilePos64()+a.header.ArchiveOffset), io.SeekStart); err != nil {
-				return fmt.Errorf("seek to file %s: %w", normalizedPath, err)
-			}
-
-			fileData := make([]byte, block.CompressedSize)
-			if _, err := io.ReadFull(a.file, fileData); err != nil {
-				return fmt.Errorf("read file %s: %w", normalizedPath, err)
-			}
-
-			// Determine if file has CRC
-			hasCRC := block.Flags&fileSectorCRC != 0
-
-			// Check if it's a patch file or deletion marker
-			isPatch := block.Flags&filePatchFile != 0
-			isDelete := block.Flags&fileDeleteMarker != 0
-
-			// For modify mode, we need to extract and re-add the file
-			// Extract the actual file content (decompress if needed)
-			var extractedData []byte
-			if block.Flags&fileExists == 0 || isDelete {
-				// Deletion marker - preserve it
+			if block.Flags&fileDeleteMarker != 0 {
+				var fileTime uint64
+				if attrs != nil && int(entry.BlockIndex) < len(attrs.fileTime) {
+					fileTime = attrs.fileTime[entry.BlockIndex]
+				}
 				newPendingFiles = append(newPendingFiles, pendingFile{
 					mpqPath:        normalizedPath,
-					data:           nil,
 					isDeleteMarker: true,
+					locale:         entry.Locale,
+					fileTime:       fileTime,
 				})
 				continue
 			}
 
-			// Decrypt if needed
-			if block.Flags&fileEncrypted != 0 {
-				key := hashString(filepath.Base(normalizedPath), hashTypeFileKey)
-				if block.Flags&fileFixKey != 0 {
-					key = (key + block.FilePos) ^ block.FileSize
-				}
-
-				if block.Flags&fileSingleUnit != 0 {
-					extractedData, err = a.decryptAndDecompressSingleUnit(fileData, block, key)
-				} else {
-					extractedData, err = a.decryptAndDecompressSectors(fileData, block, key)
-				}
-				if err != nil {
-					return fmt.Errorf("decrypt file %s: %w", normalizedPath, err)
-				}
-			} else if block.Flags&fileCompress != 0 {
-				// Compressed but not encrypted
-				if block.Flags&fileSingleUnit != 0 {
-					// Single-unit compressed file
-					dataToDecompress := fileData
-					if block.Flags&fileSectorCRC != 0 {
-						// Strip CRC from end
-						if len(dataToDecompress) < 4 {
-							return fmt.Errorf("file %s too short for CRC", normalizedPath)
-						}
-						dataToDecompress = dataToDecompress[:len(dataToDecompress)-4]
-					}
-					if block.CompressedSize < block.FileSize {
-						extractedData, err = decompressData(dataToDecompress, block.FileSize)
-						if err != nil {
-							return fmt.Errorf("decompress file %s: %w", normalizedPath, err)
-						}
-					} else {
-						extractedData = dataToDecompress
-					}
-				} else {
-					// Multi-sector compressed file
-					extractedData, err = a.decompressSectors(fileData, block)
-					if err != nil {
-						return fmt.Errorf("decompress sectors %s: %w", normalizedPath, err)
-					}
-				}
-			} else {
-				// Uncompressed, unencrypted
-				if block.Flags&fileSingleUnit != 0 && block.Flags&fileSectorCRC != 0 {
-					// Strip CRC from end
-					if len(fileData) < 4 {
-						return fmt.Errorf("file %s too short for CRC", normalizedPath)
-					}
-					extractedData = fileData[:len(fileData)-4]
-				} else {
-					extractedData = fileData
-				}
+			pf, err := a.copyBlock(normalizedPath, entry, attrs)
+			if err != nil {
+				return fmt.Errorf("copy file %s: %w", normalizedPath, err)
 			}
-
-			newPendingFiles = append(newPendingFiles, pendingFile{
-				mpqPath:     normalizedPath,
-				data:        extractedData,
-				generateCRC: hasCRC,
-				isPatchFile: isPatch,
-			})
+			newPendingFiles = append(newPendingFiles, *pf)
 		}
 	}
 
 	// Add any new files that weren't in the original archive
-	for _, pending := range pendingMap {
-		newPendingFiles = append(newPendingFiles, pending)
+	for _, normalizedPath := range pendingOrder {
+		if pending, exists := pendingMap[normalizedPath]; exists {
+			newPendingFiles = append(newPendingFiles, pending)
+		}
 	}
 
 	// Replace the pending files list
@@ -1054,8 +1146,80 @@ func (a *Archive) buildModifiedFileList() error {
 	return nil
 }
 
+// copyBlock returns a pending file that stores the block of a hash table
+// entry unchanged, keeping its compression, encryption, CRCs and flags.
+// The block is read from the archive when it is written, and FILE_FIX_KEY
+// blocks are re-keyed if they move. The CRC32 for (attributes) comes from
+// attrs when it has one; otherwise the block is decoded to compute it.
+func (a *Archive) copyBlock(mpqPath string, entry *hashTableEntry, attrs *fileAttributes) (*pendingFile, error) {
+	block := &a.blockTable[entry.BlockIndex]
+
+	index := int(entry.BlockIndex)
+	var crc uint32
+	var fileTime uint64
+	hasCRC := false
+	if attrs != nil {
+		if index < len(attrs.crc32) {
+			crc, hasCRC = attrs.crc32[index], true
+		}
+		if index < len(attrs.fileTime) {
+			fileTime = attrs.fileTime[index]
+		}
+	}
+	if !hasCRC {
+		data, err := a.readBlockData(block)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := a.decodeBlock(mpqPath, block, data)
+		if err != nil {
+			return nil, err
+		}
+		crc = crc32(decoded)
+	}
+
+	return &pendingFile{
+		mpqPath:  mpqPath,
+		locale:   entry.Locale,
+		fileTime: fileTime,
+		raw:      a.rawBlock(block, crc),
+	}, nil
+}
+
+// rawBlock returns a rawBlock that streams block from the archive file.
+func (a *Archive) rawBlock(block *blockTableEntryEx, crc uint32) *rawBlock {
+	return &rawBlock{
+		src:      a.file,
+		offset:   int64(block.getFilePos64() + a.header.ArchiveOffset),
+		size:     block.CompressedSize,
+		flags:    block.Flags,
+		fileSize: block.FileSize,
+		crc32:    crc,
+		filePos:  block.getFilePos64(),
+	}
+}
+
 // findFile looks up a file in the hash table and returns its block entry.
 func (a *Archive) findFile(mpqPath string) (*blockTableEntryEx, error) {
+	index, err := a.findBlockIndex(mpqPath)
+	if err != nil {
+		return nil, err
+	}
+	return &a.blockTable[index], nil
+}
+
+// findBlockIndex looks up a file in the hash table and returns its block table index.
+func (a *Archive) findBlockIndex(mpqPath string) (uint32, error) {
+	entry, err := a.findHashEntry(mpqPath)
+	if err != nil {
+		return 0, err
+	}
+	return entry.BlockIndex, nil
+}
+
+// findHashEntry looks up a file in the hash table and returns its hash table entry.
+// Only entries that reference an existing block are returned.
+func (a *Archive) findHashEntry(mpqPath string) (*hashTableEntry, error) {
 	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 
 	hashA := hashString(mpqPath, hashTypeNameA)
@@ -1074,9 +1238,8 @@ func (a *Archive) findFile(mpqPath string) (*blockTableEntryEx, error) {
 		}
 		if entry.HashA == hashA && entry.HashB == hashB {
 			if entry.BlockIndex < uint32(len(a.blockTable)) {
-				block := &a.blockTable[entry.BlockIndex]
-				if block.Flags&fileExists != 0 {
-					return block, nil
+				if a.blockTable[entry.BlockIndex].Flags&fileExists != 0 {
+					return entry, nil
 				}
 			}
 		}
@@ -1120,7 +1283,7 @@ func copyFile(src, dst string) error {
 // readPatchMetadata reads the (patch_metadata) special file if present.
 // Returns nil if the file doesn't exist or can't be parsed.
 func (a *Archive) readPatchMetadata() (*PatchMetadata, error) {
-	if a.mode != "r" {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
 		return nil, fmt.Errorf("archive not opened for reading")
 	}
 
@@ -1133,12 +1296,8 @@ func (a *Archive) readPatchMetadata() (*PatchMetadata, error) {
 	// Read patch_metadata file data
 	blockPos := block.getFilePos64()
 	filePos := blockPos + a.header.ArchiveOffset
-	if _, err := a.file.Seek(int64(filePos), 0); err != nil {
-		return nil, fmt.Errorf("seek to patch_metadata: %w", err)
-	}
-
 	compressedData := make([]byte, block.CompressedSize)
-	if n, err := a.file.Read(compressedData); err != nil || n != int(block.CompressedSize) {
+	if _, err := a.file.ReadAt(compressedData, int64(filePos)); err != nil {
 		return nil, fmt.Errorf("read patch_metadata: %w", err)
 	}
 
@@ -1155,7 +1314,7 @@ func (a *Archive) readPatchMetadata() (*PatchMetadata, error) {
 		metadataBytes = compressedData
 	}
 
-	if len(metadataBytes) < 36 {
+	if len(metadataBytes) < patchMetadataSize {
 		return nil, fmt.Errorf("patch_metadata too small: %d bytes", len(metadataBytes))
 	}
 
@@ -1171,8 +1330,24 @@ func (a *Archive) readPatchMetadata() (*PatchMetadata, error) {
 }
 
 // PatchMetadata contains information about a patch file.
+//
+// When an archive writes (patch_metadata), PatchMD5 is computed over the
+// archive itself (from its header to the end of its tables) with the
+// PatchMD5 field and any weak signature read as zeros.
 type PatchMetadata struct {
 	BaseMD5      [16]byte // MD5 of the base file this patch applies to
 	PatchMD5     [16]byte // MD5 of the patch file itself
 	BaseFileSize uint32   // Size of base file
 }
+
+// patchMetadataSize is the size of the (patch_metadata) file.
+const patchMetadataSize = 36
+
+// encode returns the contents of the (patch_metadata) file.
+func (m *PatchMetadata) encode() []byte {
+	data := make([]byte, patchMetadataSize)
+	copy(data[0:16], m.BaseMD5[:])
+	copy(data[16:32], m.PatchMD5[:])
+	binary.LittleEndian.PutUint32(data[32:36], m.BaseFileSize)
+	return data
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compression selects how file data is compressed when it is written.
+type Compression int
+
+const (
+	// CompressionZlib compresses files with zlib (the default).
+	CompressionZlib Compression = iota
+
+	// CompressionNone stores files uncompressed as a single unit.
+	CompressionNone
+
+	// CompressionBzip2 compresses files with BZip2, as Blizzard does for
+	// patch files. Slower than zlib but usually smaller.
+	CompressionBzip2
+)
+
+// String returns the name used for the compression in manifests.
+func (c Compression) String() string {
+	switch c {
+	case CompressionZlib:
+		return "zlib"
+	case CompressionNone:
+		return "none"
+	case CompressionBzip2:
+		return "bzip2"
+	default:
+		return fmt.Sprintf("Compression(%d)", int(c))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c Compression) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. It accepts "zlib",
+// "bzip2", "none" and the empty string (zlib).
+func (c *Compression) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "", "zlib":
+		*c = CompressionZlib
+	case "none":
+		*c = CompressionNone
+	case "bzip2":
+		*c = CompressionBzip2
+	default:
+		return fmt.Errorf("unknown compression %q", text)
+	}
+	return nil
+}
+
+// FileOptions controls how a file is stored in the archive.
+// The zero value stores a zlib-compressed, unencrypted, locale-neutral file.
+type FileOptions struct {
+	Compression Compression `json:"compression,omitempty"`
+	SectorCRC   bool        `json:"crc,omitempty"`
+	Encrypt     bool        `json:"encrypt,omitempty"`
+	FixKey      bool        `json:"fix_key,omitempty"` // Adjust the key by block position; implies Encrypt
+	Locale      uint16      `json:"locale,omitempty"`  // Windows LANGID, 0 = neutral
+	PatchFile   bool        `json:"patch,omitempty"`   // Mark as FILE_PATCH_FILE
+}
+
+// AddFileEx adds a file from disk using the given storage options.
+// The mpqPath is the path within the archive (use backslashes or forward slashes).
+func (a *Archive) AddFileEx(srcPath, mpqPath string, opts FileOptions) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	data, fileTime, err := readSourceFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	return a.addPending(srcPath, mpqPath, data, fileTime, opts)
+}
+
+// AddFileData adds a file from memory using the given storage options.
+// The data is not copied and must not be modified until the archive is closed.
+func (a *Archive) AddFileData(data []byte, mpqPath string, opts FileOptions) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	return a.addPending("", mpqPath, data, 0, opts)
+}
+
+// addPending queues a file for writing.
+func (a *Archive) addPending(srcPath, mpqPath string, data []byte, fileTime uint64, opts FileOptions) error {
+	if opts.Compression < CompressionZlib || opts.Compression > CompressionBzip2 {
+		return fmt.Errorf("unsupported compression: %v", opts.Compression)
+	}
+
+	a.pendingFiles = append(a.pendingFiles, pendingFile{
+		srcPath:     srcPath,
+		mpqPath:     strings.ReplaceAll(mpqPath, "/", "\\"),
+		data:        data,
+		generateCRC: opts.SectorCRC,
+		isPatchFile: opts.PatchFile,
+		compression: opts.Compression,
+		encrypt:     opts.Encrypt || opts.FixKey,
+		fixKey:      opts.FixKey,
+		locale:      opts.Locale,
+		fileTime:    fileTime,
+	})
+
+	return nil
+}
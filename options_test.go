@@ -0,0 +1,92 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddFileOptions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_options_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	small := []byte("Small file contents, small file contents, small file contents!")
+	large := make([]byte, 20000)
+	for i := range large {
+		large[i] = byte(i % 17)
+	}
+
+	tests := []struct {
+		mpqPath string
+		data    []byte
+		opts    FileOptions
+		want    FileFlags
+	}{
+		{"Data\\Plain.txt", small, FileOptions{}, fileCompress | fileSingleUnit},
+		{"Data\\Stored.txt", small, FileOptions{Compression: CompressionNone}, fileSingleUnit},
+		{"Data\\StoredCRC.txt", small, FileOptions{Compression: CompressionNone, SectorCRC: true}, fileSingleUnit | fileSectorCRC},
+		{"Data\\CRC.txt", small, FileOptions{SectorCRC: true}, fileCompress | fileSingleUnit | fileSectorCRC},
+		{"Data\\Encrypted.txt", small, FileOptions{Encrypt: true}, fileCompress | fileSingleUnit | fileEncrypted},
+		{"Data\\FixKey.txt", small, FileOptions{FixKey: true, Compression: CompressionNone}, fileSingleUnit | fileEncrypted | fileFixKey},
+		{"Data\\Large.bin", large, FileOptions{Encrypt: true, FixKey: true, SectorCRC: true}, fileCompress | fileEncrypted | fileFixKey | fileSectorCRC},
+		{"Data\\Patch.bin", small, FileOptions{PatchFile: true}, fileCompress | fileSingleUnit | filePatchFile},
+		{"Data\\German.txt", small, FileOptions{Locale: 0x407}, fileCompress | fileSingleUnit},
+	}
+
+	mpqPath := filepath.Join(tmpDir, "options.mpq")
+	archive, err := CreateV2(mpqPath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for _, test := range tests {
+		if err := archive.AddFileData(test.data, test.mpqPath, test.opts); err != nil {
+			t.Fatalf("add %s: %v", test.mpqPath, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	for _, test := range tests {
+		data, err := readArchive.ReadFile(test.mpqPath)
+		if err != nil {
+			t.Errorf("read %s: %v", test.mpqPath, err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("%s: content mismatch", test.mpqPath)
+		}
+
+		info, err := readArchive.Stat(test.mpqPath)
+		if err != nil {
+			t.Fatalf("stat %s: %v", test.mpqPath, err)
+		}
+		if info.Flags != test.want|fileExists {
+			t.Errorf("%s: flags = %v, want %v", test.mpqPath, info.Flags, test.want|fileExists)
+		}
+		if info.Locale != test.opts.Locale {
+			t.Errorf("%s: locale = 0x%X, want 0x%X", test.mpqPath, info.Locale, test.opts.Locale)
+		}
+	}
+
+	report, err := readArchive.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("archive failed verification: %+v", report)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// overlayEntry is a pending change recorded on a PatchChain.
+type overlayEntry struct {
+	path    string // Path as written, with backslashes
+	data    []byte
+	opts    FileOptions
+	deleted bool // Deletion marker
+}
+
+// WriteFile records a pending write of data to mpqPath, adding the file or
+// replacing any version in the chain. Pending changes are resolved above all
+// archives until they are committed or discarded. The data is not copied and
+// must not be modified until then.
+//
+// With opts.PatchFile and PTCH data, the file is an incremental patch applied
+// to the version below it.
+func (p *PatchChain) WriteFile(mpqPath string, data []byte, opts FileOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writeFile(mpqPath, data, opts)
+}
+
+// writeFile implements WriteFile; the caller holds p.mu for writing.
+func (p *PatchChain) writeFile(mpqPath string, data []byte, opts FileOptions) error {
+	if mpqPath == "" {
+		return fmt.Errorf("empty file path")
+	}
+	if opts.Compression < CompressionZlib || opts.Compression > CompressionBzip2 {
+		return fmt.Errorf("unsupported compression: %v", opts.Compression)
+	}
+
+	if p.overlay == nil {
+		p.overlay = make(map[string]*overlayEntry)
+	}
+	path := strings.ReplaceAll(mpqPath, "/", "\\")
+	p.overlay[normalizeMpqPath(path)] = &overlayEntry{path: path, data: data, opts: opts}
+	return nil
+}
+
+// ReplaceFile records a pending write like WriteFile, but fails if the file
+// does not exist in the chain.
+func (p *PatchChain) ReplaceFile(mpqPath string, data []byte, opts FileOptions) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.hasFile(mpqPath) {
+		return fmt.Errorf("file not found in patch chain: %s", mpqPath)
+	}
+	return p.writeFile(mpqPath, data, opts)
+}
+
+// DeleteFile records a pending deletion of mpqPath. A file that only exists
+// as a pending write is simply dropped; otherwise a deletion marker is
+// committed.
+func (p *PatchChain) DeleteFile(mpqPath string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.hasFile(mpqPath) {
+		return fmt.Errorf("file not found in patch chain: %s", mpqPath)
+	}
+
+	path := strings.ReplaceAll(mpqPath, "/", "\\")
+	key := normalizeMpqPath(path)
+	delete(p.overlay, key)
+	if _, err := p.locateFile(path); err != nil {
+		return nil
+	}
+
+	if p.overlay == nil {
+		p.overlay = make(map[string]*overlayEntry)
+	}
+	p.overlay[key] = &overlayEntry{path: path, deleted: true}
+	return nil
+}
+
+// Pending returns the paths with pending changes, sorted.
+func (p *PatchChain) Pending() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pending()
+}
+
+// pending implements Pending; the caller holds p.mu.
+func (p *PatchChain) pending() []string {
+	paths := make([]string, 0, len(p.overlay))
+	for _, entry := range p.overlay {
+		paths = append(paths, entry.path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Discard drops all pending changes.
+func (p *PatchChain) Discard() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.overlay = nil
+}
+
+// Commit writes the pending changes to a new patch archive at path: written
+// files are stored with their options and deleted files as deletion markers.
+// The archive names the current top of the chain as its base in
+// (patch_metadata).
+//
+// On success the new archive is opened and added to the chain with the highest
+// priority, and the pending changes are cleared, so lookups are unchanged.
+func (p *PatchChain) Commit(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.overlay) == 0 {
+		return fmt.Errorf("no pending changes")
+	}
+
+	archive, err := Create(path, len(p.overlay))
+	if err != nil {
+		return err
+	}
+	if err := p.writeOverlay(archive); err != nil {
+		os.Remove(archive.tempPath)
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	committed, err := Open(path)
+	if err != nil {
+		return fmt.Errorf("open committed archive: %w", err)
+	}
+	files, err := committed.ListFiles()
+	if err != nil {
+		committed.Close()
+		return fmt.Errorf("list committed archive: %w", err)
+	}
+	meta, err := committed.readPatchMetadata()
+	if err != nil {
+		meta = nil
+	}
+	p.insert(committed, "", meta, files, len(p.archives))
+	p.overlay = nil
+	return nil
+}
+
+// writeOverlay adds the pending changes to archive.
+func (p *PatchChain) writeOverlay(archive *Archive) error {
+	if len(p.archives) > 0 {
+		if err := archive.SetPatchBase(p.archives[len(p.archives)-1].path); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range p.pending() {
+		entry := p.overlay[normalizeMpqPath(path)]
+		if entry.deleted {
+			if err := archive.AddDeleteMarker(entry.path); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := archive.AddFileData(entry.data, entry.path, entry.opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overlayEntry returns the pending change for mpqPath, if any.
+func (p *PatchChain) overlayEntry(mpqPath string) (*overlayEntry, bool) {
+	if len(p.overlay) == 0 {
+		return nil, false
+	}
+	entry, ok := p.overlay[normalizeMpqPath(mpqPath)]
+	return entry, ok
+}
+
+// readOverlay returns the contents of a pending write, applying it to the
+// version below if it is an incremental patch.
+func (p *PatchChain) readOverlay(entry *overlayEntry) ([]byte, error) {
+	if !entry.opts.PatchFile || !IsPatchData(entry.data) {
+		return entry.data, nil
+	}
+
+	base, err := p.readArchives(entry.path)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := ApplyPatch(base, entry.data)
+	if err != nil {
+		return nil, fmt.Errorf("apply pending patch for %s: %w", entry.path, err)
+	}
+	return patched, nil
+}
+
+// statOverlay describes a pending change. It has no ArchivePath.
+func statOverlay(entry *overlayEntry) *FileInfo {
+	flags := uint32(fileExists)
+	if entry.opts.PatchFile {
+		flags |= filePatchFile
+	}
+	if entry.deleted {
+		flags |= fileDeleteMarker
+	}
+	return &FileInfo{
+		Path:           entry.path,
+		BlockIndex:     -1,
+		FileSize:       uint32(len(entry.data)),
+		CompressedSize: uint32(len(entry.data)),
+		Flags:          FileFlags(flags),
+		Locale:         entry.opts.Locale,
+	}
+}
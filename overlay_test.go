@@ -0,0 +1,145 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchChainOverlay(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_overlay_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	basePath := filepath.Join(tmpDir, "base.mpq")
+	base, err := Create(basePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for name, content := range map[string]string{
+		"Data\\keep.txt":    "keep",
+		"Data\\replace.txt": "old",
+		"Data\\delete.txt":  "gone",
+		"Data\\spell.dbc":   "spell table v1",
+	} {
+		if err := base.AddFileData([]byte(content), name, FileOptions{}); err != nil {
+			t.Fatalf("add file: %v", err)
+		}
+	}
+	if err := base.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	chain, err := OpenPatchChain([]string{basePath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+
+	patch, err := CreatePatch([]byte("spell table v1"), []byte("spell table v2"))
+	if err != nil {
+		t.Fatalf("create patch: %v", err)
+	}
+	if err := chain.WriteFile("Data/new.txt", []byte("new"), FileOptions{}); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := chain.ReplaceFile("Data\\replace.txt", []byte("new version"), FileOptions{}); err != nil {
+		t.Fatalf("replace file: %v", err)
+	}
+	if err := chain.ReplaceFile("Data\\missing.txt", nil, FileOptions{}); err == nil {
+		t.Error("expected error replacing a missing file")
+	}
+	if err := chain.WriteFile("Data\\spell.dbc", patch, FileOptions{PatchFile: true}); err != nil {
+		t.Fatalf("write patch: %v", err)
+	}
+	if err := chain.DeleteFile("Data\\delete.txt"); err != nil {
+		t.Fatalf("delete file: %v", err)
+	}
+	if err := chain.WriteFile("Data\\temp.txt", []byte("temp"), FileOptions{}); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := chain.DeleteFile("Data\\temp.txt"); err != nil {
+		t.Fatalf("delete pending file: %v", err)
+	}
+
+	want := []string{"Data\\delete.txt", "Data\\new.txt", "Data\\replace.txt", "Data\\spell.dbc"}
+	if got := chain.Pending(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pending = %v, want %v", got, want)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		for name, content := range map[string]string{
+			"Data\\keep.txt":    "keep",
+			"Data\\replace.txt": "new version",
+			"Data\\new.txt":     "new",
+			"Data\\spell.dbc":   "spell table v2",
+		} {
+			data, err := chain.ReadFile(name)
+			if err != nil {
+				t.Fatalf("%s: read %s: %v", stage, name, err)
+			}
+			if string(data) != content {
+				t.Errorf("%s: %s = %q, want %q", stage, name, data, content)
+			}
+		}
+		if chain.HasFile("Data\\delete.txt") || chain.HasFile("Data\\temp.txt") {
+			t.Errorf("%s: deleted files are still present", stage)
+		}
+		files, err := chain.Glob("Data\\*")
+		if err != nil {
+			t.Fatalf("%s: glob: %v", stage, err)
+		}
+		want := []string{"Data\\keep.txt", "Data\\new.txt", "Data\\replace.txt", "Data\\spell.dbc"}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("%s: Glob = %v, want %v", stage, files, want)
+		}
+	}
+	check("pending")
+
+	info, err := chain.Stat("Data\\new.txt")
+	if err != nil {
+		t.Fatalf("stat pending file: %v", err)
+	}
+	if info.ArchivePath != "" || info.FileSize != 3 {
+		t.Errorf("pending stat = %+v", info)
+	}
+
+	commitPath := filepath.Join(tmpDir, "patch.mpq")
+	if err := chain.Commit(commitPath); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if len(chain.Pending()) != 0 || chain.GetArchiveCount() != 2 {
+		t.Fatalf("after commit: %d pending, %d archives", len(chain.Pending()), chain.GetArchiveCount())
+	}
+	check("committed")
+	if mismatches, err := chain.CheckPatchBases(); err != nil || len(mismatches) != 0 {
+		t.Errorf("CheckPatchBases = %v, %v", mismatches, err)
+	}
+
+	// The committed archive holds only the changes
+	committed, err := Open(commitPath)
+	if err != nil {
+		t.Fatalf("open committed archive: %v", err)
+	}
+	defer committed.Close()
+	if !committed.IsDeleteMarker("Data\\delete.txt") || !committed.IsPatchFile("Data\\spell.dbc") {
+		t.Error("committed archive is missing the deletion marker or patch file")
+	}
+	if committed.HasFile("Data\\keep.txt") || committed.HasFile("Data\\temp.txt") {
+		t.Error("committed archive holds unchanged files")
+	}
+	if meta, err := committed.PatchMetadata(); err != nil || meta == nil {
+		t.Error("committed archive has no patch metadata")
+	}
+
+	if err := chain.Commit(filepath.Join(tmpDir, "empty.mpq")); err == nil {
+		t.Error("expected error committing without changes")
+	}
+}
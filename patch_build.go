@@ -0,0 +1,156 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// PatchArchiveOptions controls BuildPatchArchive.
+type PatchArchiveOptions struct {
+	Version  FormatVersion
+	MaxFiles int         // Hash table capacity, 0 sizes it for the entries written
+	Deltas   bool        // Store changed files as incremental patches when smaller
+	Files    FileOptions // Storage options for added files and full replacements
+}
+
+// PatchArchiveReport lists the differences written to a patch archive.
+// Each list holds archive paths, sorted.
+type PatchArchiveReport struct {
+	Added   []string // Files only in the new version
+	Changed []string // Files whose contents differ, stored in full
+	Deltas  []string // Files whose contents differ, stored as incremental patches
+	Removed []string // Files only in the old version, written as deletion markers
+}
+
+// BuildPatchArchive writes a patch archive to outPath that turns the old
+// archives into the new ones. Both lists are opened as patch chains (last
+// archive has the highest priority) and compared file by file: added and
+// changed files are stored in full or, with opts.Deltas, as incremental
+// patches against the old contents when that is smaller, and removed files
+// get deletion markers.
+//
+// The archive carries (patch_metadata) describing its base, the last archive
+// in oldArchivePaths (BaseFileSize holds the low 32 bits of its size).
+func BuildPatchArchive(oldArchivePaths, newArchivePaths []string, outPath string, opts PatchArchiveOptions) (*PatchArchiveReport, error) {
+	if len(oldArchivePaths) == 0 || len(newArchivePaths) == 0 {
+		return nil, fmt.Errorf("old and new archives are required")
+	}
+
+	oldChain, err := OpenPatchChain(oldArchivePaths)
+	if err != nil {
+		return nil, fmt.Errorf("open old archives: %w", err)
+	}
+	defer oldChain.Close()
+
+	newChain, err := OpenPatchChain(newArchivePaths)
+	if err != nil {
+		return nil, fmt.Errorf("open new archives: %w", err)
+	}
+	defer newChain.Close()
+
+	oldFiles, err := oldChain.Glob("**")
+	if err != nil {
+		return nil, fmt.Errorf("list old archives: %w", err)
+	}
+	newFiles, err := newChain.Glob("**")
+	if err != nil {
+		return nil, fmt.Errorf("list new archives: %w", err)
+	}
+
+	base, err := fileMetadata(oldArchivePaths[len(oldArchivePaths)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	maxFiles := opts.MaxFiles
+	if maxFiles < len(oldFiles)+len(newFiles) {
+		maxFiles = len(oldFiles) + len(newFiles)
+	}
+	archive, err := CreateWithVersion(outPath, maxFiles, opts.Version)
+	if err != nil {
+		return nil, err
+	}
+	archive.patchMetadata = base
+
+	report, err := diffPatchChains(archive, oldChain, newChain, oldFiles, newFiles, opts)
+	if err != nil {
+		os.Remove(archive.tempPath)
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// diffPatchChains adds the differences between two chains to archive.
+func diffPatchChains(archive *Archive, oldChain, newChain *PatchChain, oldFiles, newFiles []string, opts PatchArchiveOptions) (*PatchArchiveReport, error) {
+	report := &PatchArchiveReport{}
+
+	inOld := make(map[string]bool, len(oldFiles))
+	for _, name := range oldFiles {
+		inOld[normalizeMpqPath(name)] = true
+	}
+	inNew := make(map[string]bool, len(newFiles))
+
+	for _, name := range newFiles {
+		inNew[normalizeMpqPath(name)] = true
+
+		data, err := newChain.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s from new archives: %w", name, err)
+		}
+
+		if !inOld[normalizeMpqPath(name)] {
+			if err := archive.AddFileData(data, name, opts.Files); err != nil {
+				return nil, err
+			}
+			report.Added = append(report.Added, name)
+			continue
+		}
+
+		oldData, err := oldChain.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("read %s from old archives: %w", name, err)
+		}
+		if bytes.Equal(oldData, data) {
+			continue
+		}
+
+		if opts.Deltas {
+			patch, err := CreatePatch(oldData, data)
+			if err != nil {
+				return nil, fmt.Errorf("create patch for %s: %w", name, err)
+			}
+			if len(patch) < len(data) {
+				if err := archive.addPending("", name, patch, 0, FileOptions{Compression: CompressionBzip2, PatchFile: true}); err != nil {
+					return nil, err
+				}
+				report.Deltas = append(report.Deltas, name)
+				continue
+			}
+		}
+
+		if err := archive.AddFileData(data, name, opts.Files); err != nil {
+			return nil, err
+		}
+		report.Changed = append(report.Changed, name)
+	}
+
+	for _, name := range oldFiles {
+		if inNew[normalizeMpqPath(name)] {
+			continue
+		}
+		if err := archive.AddDeleteMarker(name); err != nil {
+			return nil, err
+		}
+		report.Removed = append(report.Removed, name)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildPatchArchive(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_patch_build_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	large := []byte(strings.Repeat("item record 0123456789\n", 2000))
+	largeChanged := bytes.Replace(large, []byte("0123"), []byte("4567"), 2)
+
+	writeArchive := func(name string, files map[string][]byte) string {
+		path := filepath.Join(tmpDir, name)
+		archive, err := Create(path, 10)
+		if err != nil {
+			t.Fatalf("create archive: %v", err)
+		}
+		for mpqPath, data := range files {
+			if err := archive.AddFileData(data, mpqPath, FileOptions{}); err != nil {
+				t.Fatalf("add %s: %v", mpqPath, err)
+			}
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+		return path
+	}
+
+	oldPath := writeArchive("old.mpq", map[string][]byte{
+		"Data\\Same.txt":    []byte("unchanged"),
+		"Data\\Small.txt":   []byte("old"),
+		"Data\\Item.dbc":    large,
+		"Data\\Removed.txt": []byte("removed"),
+	})
+	newPath := writeArchive("new.mpq", map[string][]byte{
+		"Data\\Same.txt":  []byte("unchanged"),
+		"Data\\Small.txt": []byte("new"),
+		"Data\\Item.dbc":  largeChanged,
+		"Data\\Added.txt": []byte("added"),
+	})
+
+	patchPath := filepath.Join(tmpDir, "patch.mpq")
+	report, err := BuildPatchArchive([]string{oldPath}, []string{newPath}, patchPath, PatchArchiveOptions{Deltas: true})
+	if err != nil {
+		t.Fatalf("build patch archive: %v", err)
+	}
+
+	want := &PatchArchiveReport{
+		Added:   []string{"Data\\Added.txt"},
+		Changed: []string{"Data\\Small.txt"},
+		Deltas:  []string{"Data\\Item.dbc"},
+		Removed: []string{"Data\\Removed.txt"},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	// Applying the patch to the old archive gives the new contents
+	chain, err := OpenPatchChain([]string{oldPath, patchPath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+
+	files, err := chain.Glob("**")
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if want := []string{"Data\\Added.txt", "Data\\Item.dbc", "Data\\Same.txt", "Data\\Small.txt"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	for name, want := range map[string][]byte{
+		"Data\\Small.txt": []byte("new"),
+		"Data\\Item.dbc":  largeChanged,
+		"Data\\Added.txt": []byte("added"),
+	} {
+		got, err := chain.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s does not match the new version", name)
+		}
+	}
+
+	// The metadata names the old archive as the base and hashes the patch
+	oldData, _ := os.ReadFile(oldPath)
+	meta := chain.GetPatchMetadata(patchPath)
+	if meta == nil {
+		t.Fatal("patch archive has no (patch_metadata)")
+	}
+	if meta.BaseMD5 != md5.Sum(oldData) || meta.BaseFileSize != uint32(len(oldData)) {
+		t.Errorf("base = %x/%d, want %x/%d", meta.BaseMD5, meta.BaseFileSize, md5.Sum(oldData), len(oldData))
+	}
+
+	patchData, _ := os.ReadFile(patchPath)
+	archive := chain.archives[1]
+	block, err := archive.findFile("(patch_metadata)")
+	if err != nil {
+		t.Fatalf("find (patch_metadata): %v", err)
+	}
+	field := block.getFilePos64() + 16
+	copy(patchData[field:field+16], make([]byte, 16))
+	if md5.Sum(patchData) != meta.PatchMD5 {
+		t.Error("PatchMD5 does not match the archive")
+	}
+
+	if report, err := archive.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Errorf("verify patch archive: %v %+v", err, report)
+	}
+}
+
+func TestCheckPatchBases(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_patch_base_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	writeArchive := func(name, content string, setup func(*Archive)) string {
+		path := filepath.Join(tmpDir, name)
+		archive, err := Create(path, 10)
+		if err != nil {
+			t.Fatalf("create archive: %v", err)
+		}
+		if err := archive.AddFileData([]byte(content), "Data\\File.txt", FileOptions{}); err != nil {
+			t.Fatalf("add file: %v", err)
+		}
+		if setup != nil {
+			setup(archive)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+		return path
+	}
+
+	basePath := writeArchive("base.mpq", "base", nil)
+	otherPath := writeArchive("other.mpq", "other base", nil)
+
+	key := testWeakKey
+	patchPath := writeArchive("patch.mpq", "patched", func(a *Archive) {
+		if err := a.SetPatchBase(basePath); err != nil {
+			t.Fatalf("set patch base: %v", err)
+		}
+		if err := a.SetWeakSigningKey(key); err != nil {
+			t.Fatalf("set signing key: %v", err)
+		}
+	})
+
+	check := func(paths ...string) []PatchBaseMismatch {
+		chain, err := OpenPatchChain(paths)
+		if err != nil {
+			t.Fatalf("open chain: %v", err)
+		}
+		defer chain.Close()
+		mismatches, err := chain.CheckPatchBases()
+		if err != nil {
+			t.Fatalf("check patch bases: %v", err)
+		}
+		if opened := chain.PatchBaseMismatches(); !reflect.DeepEqual(opened, mismatches) {
+			t.Errorf("mismatches found on open = %v, want %v", opened, mismatches)
+		}
+		return mismatches
+	}
+
+	if m := check(basePath, patchPath); len(m) != 0 {
+		t.Errorf("correct base: %v", m)
+	}
+	if m := check(otherPath, patchPath); len(m) != 1 || m[0].Base != otherPath {
+		t.Errorf("wrong base: %v", m)
+	}
+	if m := check(patchPath); len(m) != 1 || m[0].Base != "" {
+		t.Errorf("no base: %v", m)
+	}
+
+	// The stored result follows changes to the chain
+	chain, err := OpenPatchChain([]string{patchPath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	if m := chain.PatchBaseMismatches(); len(m) != 1 || m[0].Base != "" {
+		t.Errorf("no base: %v", m)
+	}
+	if err := chain.Insert(otherPath, 0); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if m := chain.PatchBaseMismatches(); len(m) != 1 || m[0].Base != otherPath {
+		t.Errorf("after inserting the wrong base: %v", m)
+	}
+	if err := chain.Insert(basePath, 1); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+	if m := chain.PatchBaseMismatches(); len(m) != 0 {
+		t.Errorf("after inserting the base: %v", m)
+	}
+	if err := chain.Reorder([]string{basePath, otherPath, patchPath}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if m := chain.PatchBaseMismatches(); len(m) != 1 || m[0].Base != otherPath {
+		t.Errorf("after reordering: %v", m)
+	}
+	if err := chain.Remove(otherPath); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if m := chain.PatchBaseMismatches(); len(m) != 0 {
+		t.Errorf("after removing the wrong base: %v", m)
+	}
+	chain.Close()
+
+	// The metadata survives modification and PatchMD5 follows the new contents
+	archive, err := OpenForModify(patchPath)
+	if err != nil {
+		t.Fatalf("open for modify: %v", err)
+	}
+	archive.AddFileData([]byte("more"), "Data\\More.txt", FileOptions{})
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	if m := check(basePath, patchPath); len(m) != 0 {
+		t.Errorf("after modify: %v", m)
+	}
+
+	// Changing the archive behind the metadata's back is detected
+	data, _ := os.ReadFile(patchPath)
+	data[headerSizeV1] ^= 0xFF
+	os.WriteFile(patchPath, data, 0644)
+	if m := check(basePath, patchPath); len(m) != 1 || !strings.Contains(m[0].Reason, "PatchMD5") {
+		t.Errorf("modified patch: %v", m)
+	}
+}
@@ -5,8 +5,10 @@ package mpq
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // normalizeMpqPath normalizes a path for MPQ lookup.
@@ -25,17 +27,37 @@ func normalizeMpqPath(path string) string {
 }
 
 // PatchChain represents a prioritized list of MPQ archives.
+//
+// A PatchChain is safe for concurrent use. Lookups and reads run in
+// parallel; methods that change the chain, such as WriteFile, Commit,
+// Insert and Remove, wait for them to finish and apply the change at once.
 type PatchChain struct {
-	archives   []*Archive
-	metadata   map[string]*PatchMetadata // metadata per archive path
-	fileMap    map[string]int            // cache: normalized filename -> archive index
-	cacheBuilt bool                      // whether fileMap has been populated
+	opts PatchChainOptions // options the chain was opened with, used by Insert
+	mu   sync.RWMutex      // guards the fields below
+
+	archives       []*Archive
+	prefixes       []string                       // path prefix per archive, e.g. "enUS\\" or ""
+	metadata       map[string]*PatchMetadata      // metadata per archive path
+	baseMismatches map[string][]PatchBaseMismatch // base check per archive path
+	fileMap        map[string]int                 // cache: normalized filename -> archive index
+	overlay        map[string]*overlayEntry       // pending changes by normalized filename
 }
 
 // OpenPatchChain opens multiple MPQ archives in order of increasing priority.
 // The last archive in the list has the highest priority.
+//
+// Each archive with (patch_metadata) is checked against the archive below
+// it, which hashes that archive in full; PatchBaseMismatches reports patches
+// applied to the wrong base.
 func OpenPatchChain(paths []string) (*PatchChain, error) {
+	return OpenPatchChainWithOptions(paths, PatchChainOptions{})
+}
+
+// OpenPatchChainWithOptions opens a patch chain like OpenPatchChain, with
+// per-archive path prefixes (see PatchChainOptions).
+func OpenPatchChainWithOptions(paths []string, opts PatchChainOptions) (*PatchChain, error) {
 	archives := make([]*Archive, 0, len(paths))
+	prefixes := make([]string, 0, len(paths))
 	metadata := make(map[string]*PatchMetadata)
 
 	for _, path := range paths {
@@ -47,6 +69,7 @@ func OpenPatchChain(paths []string) (*PatchChain, error) {
 			return nil, fmt.Errorf("open archive %s: %w", path, err)
 		}
 		archives = append(archives, archive)
+		prefixes = append(prefixes, opts.archivePrefix(path, archive))
 
 		// Try to read patch metadata if present
 		if meta, err := archive.readPatchMetadata(); err == nil && meta != nil {
@@ -55,16 +78,15 @@ func OpenPatchChain(paths []string) (*PatchChain, error) {
 	}
 
 	chain := &PatchChain{
-		archives:   archives,
-		metadata:   metadata,
-		fileMap:    make(map[string]int),
-		cacheBuilt: false,
+		opts:           opts,
+		archives:       archives,
+		prefixes:       prefixes,
+		metadata:       metadata,
+		baseMismatches: make(map[string][]PatchBaseMismatch),
 	}
-
-	// Build cache eagerly (non-fatal if it fails)
-	if err := chain.rebuildFileMap(); err != nil {
-		// Cache build can fail if archives don't have listfiles
-		// Cache will be built lazily on first lookup
+	chain.rebuildFileMap()
+	for i := range archives {
+		chain.recheckPatchBase(i)
 	}
 
 	return chain, nil
@@ -72,6 +94,9 @@ func OpenPatchChain(paths []string) (*PatchChain, error) {
 
 // Close closes all archives in the patch chain.
 func (p *PatchChain) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	var firstErr error
 	for _, archive := range p.archives {
 		if err := archive.Close(); err != nil && firstErr == nil {
@@ -82,14 +107,17 @@ func (p *PatchChain) Close() error {
 }
 
 // HasFile returns true if any archive contains the specified file.
-// Respects deletion markers in higher-priority archives.
+// Respects deletion markers in higher-priority archives and pending changes.
 func (p *PatchChain) HasFile(mpqPath string) bool {
-	// Ensure cache is built
-	if !p.cacheBuilt {
-		if err := p.rebuildFileMap(); err != nil {
-			// Fall back to linear search if cache build fails
-			return p.hasFileLinear(mpqPath)
-		}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.hasFile(mpqPath)
+}
+
+// hasFile implements HasFile; the caller holds p.mu.
+func (p *PatchChain) hasFile(mpqPath string) bool {
+	if entry, ok := p.overlayEntry(mpqPath); ok {
+		return !entry.deleted
 	}
 
 	normalizedPath := normalizeMpqPath(mpqPath)
@@ -100,14 +128,11 @@ func (p *PatchChain) HasFile(mpqPath string) bool {
 		return false
 	}
 
-	// Verify file still exists and check for deletion marker
-	archive := p.archives[archiveIdx]
-	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
-	block, err := archive.findFile(mpqPath)
+	// Verify file exists and check for deletion marker
+	block, err := p.findFile(archiveIdx, mpqPath)
 	if err != nil {
-		// File removed? Rebuild cache
-		p.rebuildFileMap()
-		return false
+		// Listed but not in the hash table; search the archives below
+		return p.hasFileLinear(mpqPath)
 	}
 
 	// Check for deletion marker
@@ -120,10 +145,8 @@ func (p *PatchChain) HasFile(mpqPath string) bool {
 
 // hasFileLinear is the fallback linear search implementation.
 func (p *PatchChain) hasFileLinear(mpqPath string) bool {
-	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 	for i := len(p.archives) - 1; i >= 0; i-- {
-		archive := p.archives[i]
-		block, err := archive.findFile(mpqPath)
+		block, err := p.findFile(i, mpqPath)
 		if err == nil {
 			// If file exists, check if it's a deletion marker
 			if block.Flags&fileDeleteMarker != 0 {
@@ -136,68 +159,150 @@ func (p *PatchChain) hasFileLinear(mpqPath string) bool {
 }
 
 // ExtractFile extracts the highest-priority version of a file.
-// Respects deletion markers in patch archives.
+// Respects deletion markers in patch archives and applies incremental
+// patches (see ReadFile).
 func (p *PatchChain) ExtractFile(mpqPath, destPath string) error {
-	// Ensure cache is built
-	if !p.cacheBuilt {
-		if err := p.rebuildFileMap(); err != nil {
-			// Fall back to linear search
-			return p.extractFileLinear(mpqPath, destPath)
+	data, err := p.ReadFile(mpqPath)
+	if err != nil {
+		return err
+	}
+
+	// Ensure destination directory exists
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	if err := os.WriteFile(destPath, data, 0644); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	return nil
+}
+
+// ReadFile returns the contents of the highest-priority version of a file.
+// Respects deletion markers in patch archives and pending changes.
+//
+// If the highest-priority entry is an incremental patch (FILE_PATCH_FILE with
+// a PTCH header), the nearest complete version below it is read and every
+// patch above it is applied in priority order, checking the MD5 before and
+// after each step. Patch files without a PTCH header replace the file as a
+// whole.
+func (p *PatchChain) ReadFile(mpqPath string) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.readFile(mpqPath)
+}
+
+// readFile implements ReadFile; the caller holds p.mu.
+func (p *PatchChain) readFile(mpqPath string) ([]byte, error) {
+	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
+	if entry, ok := p.overlayEntry(mpqPath); ok && !entry.deleted {
+		return p.readOverlay(entry)
+	}
+	return p.readArchives(mpqPath)
+}
+
+// readArchives reads a file from the archives, ignoring pending writes.
+func (p *PatchChain) readArchives(mpqPath string) ([]byte, error) {
+	archiveIdx, err := p.locateFile(mpqPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the patches from the top down to the base version
+	var patches [][]byte
+	var patchArchives []int
+	for i := archiveIdx; i >= 0; i-- {
+		block, err := p.findFile(i, mpqPath)
+		if err != nil {
+			continue
+		}
+		if block.Flags&fileDeleteMarker != 0 {
+			break
+		}
+
+		data, err := p.archives[i].ReadFile(p.archivePath(i, mpqPath))
+		if err != nil {
+			return nil, fmt.Errorf("read %s from %s: %w", mpqPath, p.archives[i].path, err)
 		}
+		if block.Flags&filePatchFile == 0 || !IsPatchData(data) {
+			return p.applyPatches(mpqPath, data, patches, patchArchives)
+		}
+
+		patches = append(patches, data)
+		patchArchives = append(patchArchives, i)
 	}
 
-	normalizedPath := normalizeMpqPath(mpqPath)
+	return nil, fmt.Errorf("no base file for patch in chain: %s", mpqPath)
+}
 
-	// Check cache
-	archiveIdx, found := p.fileMap[normalizedPath]
-	if !found {
-		return fmt.Errorf("file not found in patch chain: %s", mpqPath)
+// applyPatches applies patches (collected highest priority first) to base.
+func (p *PatchChain) applyPatches(mpqPath string, base []byte, patches [][]byte, archives []int) ([]byte, error) {
+	data := base
+	for i := len(patches) - 1; i >= 0; i-- {
+		patched, err := ApplyPatch(data, patches[i])
+		if err != nil {
+			return nil, fmt.Errorf("apply patch for %s from %s: %w", mpqPath, p.archives[archives[i]].path, err)
+		}
+		data = patched
 	}
+	return data, nil
+}
 
-	// Extract from the cached archive
-	archive := p.archives[archiveIdx]
+// locateFile returns the index of the highest-priority archive containing
+// mpqPath. Files removed by a deletion marker, including pending deletions,
+// are reported as errors; pending writes are not considered.
+func (p *PatchChain) locateFile(mpqPath string) (int, error) {
 	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
-	block, err := archive.findFile(mpqPath)
+	if entry, ok := p.overlayEntry(mpqPath); ok && entry.deleted {
+		return 0, fmt.Errorf("file marked for deletion in patch: %s", mpqPath)
+	}
+
+	archiveIdx, found := p.fileMap[normalizeMpqPath(mpqPath)]
+	if !found {
+		return 0, fmt.Errorf("file not found in patch chain: %s", mpqPath)
+	}
+
+	block, err := p.findFile(archiveIdx, mpqPath)
 	if err != nil {
-		// File removed? Rebuild cache and retry
-		p.rebuildFileMap()
-		return fmt.Errorf("file not found in patch chain: %s", mpqPath)
+		// Listed but not in the hash table; search the archives below
+		return p.locateFileLinear(mpqPath)
 	}
 
-	// Check for deletion marker
 	if block.Flags&fileDeleteMarker != 0 {
-		return fmt.Errorf("file marked for deletion in patch: %s", mpqPath)
+		return 0, fmt.Errorf("file marked for deletion in patch: %s", mpqPath)
 	}
 
-	return archive.ExtractFile(mpqPath, destPath)
+	return archiveIdx, nil
 }
 
-// extractFileLinear is the fallback linear search implementation.
-func (p *PatchChain) extractFileLinear(mpqPath, destPath string) error {
-	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
+// locateFileLinear is the fallback linear search implementation.
+func (p *PatchChain) locateFileLinear(mpqPath string) (int, error) {
 	for i := len(p.archives) - 1; i >= 0; i-- {
-		archive := p.archives[i]
-		block, err := archive.findFile(mpqPath)
+		block, err := p.findFile(i, mpqPath)
 		if err == nil {
-			// Check for deletion marker
 			if block.Flags&fileDeleteMarker != 0 {
-				return fmt.Errorf("file marked for deletion in patch: %s", mpqPath)
+				return 0, fmt.Errorf("file marked for deletion in patch: %s", mpqPath)
 			}
-			return archive.ExtractFile(mpqPath, destPath)
+			return i, nil
 		}
 	}
-	return fmt.Errorf("file not found in patch chain: %s", mpqPath)
+	return 0, fmt.Errorf("file not found in patch chain: %s", mpqPath)
 }
 
-// ListFiles returns the union of listfiles across the chain.
+// ListFiles returns the union of listfiles across the chain, followed by
+// pending writes.
 func (p *PatchChain) ListFiles() ([]string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.listFiles()
+}
+
+// listFiles implements ListFiles; the caller holds p.mu.
+func (p *PatchChain) listFiles() ([]string, error) {
 	seen := make(map[string]struct{})
 	var result []string
-	for _, archive := range p.archives {
-		files, err := archive.ListFiles()
-		if err != nil {
-			return nil, err
-		}
+	add := func(files []string) {
 		for _, file := range files {
 			key := strings.ToLower(filepath.Clean(strings.ReplaceAll(file, "/", "\\")))
 			if _, ok := seen[key]; ok {
@@ -207,33 +312,49 @@ func (p *PatchChain) ListFiles() ([]string, error) {
 			result = append(result, file)
 		}
 	}
+
+	for i := range p.archives {
+		files, err := p.listArchive(i)
+		if err != nil {
+			return nil, err
+		}
+		add(files)
+	}
+	for _, path := range p.pending() {
+		if !p.overlay[normalizeMpqPath(path)].deleted {
+			add([]string{path})
+		}
+	}
 	return result, nil
 }
 
 // GetPatchMetadata returns the patch metadata for a specific archive in the chain.
 func (p *PatchChain) GetPatchMetadata(archivePath string) *PatchMetadata {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return p.metadata[archivePath]
 }
 
 // GetArchiveCount returns the number of archives in the chain.
 func (p *PatchChain) GetArchiveCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	return len(p.archives)
 }
 
 // HasPatchFile checks if a file is marked as a patch file in any archive.
 func (p *PatchChain) HasPatchFile(mpqPath string) bool {
-	// Ensure cache is built (though we still need to search all archives)
-	if !p.cacheBuilt {
-		if err := p.rebuildFileMap(); err != nil {
-			return p.hasPatchFileLinear(mpqPath)
-		}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if entry, ok := p.overlayEntry(mpqPath); ok && entry.opts.PatchFile {
+		return true
 	}
 
 	// For patch files, we need to check all archives since patch files
 	// can exist in multiple archives, not just the highest priority one
-	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
 	for i := len(p.archives) - 1; i >= 0; i-- {
-		block, err := p.archives[i].findFile(mpqPath)
+		block, err := p.findFile(i, mpqPath)
 		if err == nil && block.Flags&filePatchFile != 0 {
 			return true
 		}
@@ -241,30 +362,16 @@ func (p *PatchChain) HasPatchFile(mpqPath string) bool {
 	return false
 }
 
-// hasPatchFileLinear is the fallback linear search implementation.
-func (p *PatchChain) hasPatchFileLinear(mpqPath string) bool {
-	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
-	for i := len(p.archives) - 1; i >= 0; i-- {
-		block, err := p.archives[i].findFile(mpqPath)
-		if err == nil && block.Flags&filePatchFile != 0 {
-			return true
-		}
-	}
-	return false
-}
-
-// rebuildFileMap rebuilds the internal file map cache.
-// This should be called when archives are added/removed.
-func (p *PatchChain) rebuildFileMap() error {
+// rebuildFileMap builds the internal file map cache from the listfiles.
+// Insert, Remove and Reorder update the map in place afterwards.
+func (p *PatchChain) rebuildFileMap() {
 	p.fileMap = make(map[string]int)
 
 	// Process archives in reverse order (highest priority first)
 	// This ensures higher-priority archives override lower-priority ones
 	for i := len(p.archives) - 1; i >= 0; i-- {
-		archive := p.archives[i]
-
 		// Get list of files in this archive
-		files, err := archive.ListFiles()
+		files, err := p.listArchive(i)
 		if err != nil {
 			// If ListFiles fails, try to continue with other archives
 			// This handles archives without listfiles gracefully
@@ -280,7 +387,4 @@ func (p *PatchChain) rebuildFileMap() error {
 			}
 		}
 	}
-
-	p.cacheBuilt = true
-	return nil
 }
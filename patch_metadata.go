@@ -0,0 +1,229 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"cmp"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// PatchMetadata returns the archive's (patch_metadata), or nil if it has
+// none. In write mode it returns the metadata that will be written.
+func (a *Archive) PatchMetadata() (*PatchMetadata, error) {
+	if a.mode == "w" {
+		return a.patchMetadata, nil
+	}
+	return a.readPatchMetadata()
+}
+
+// SetPatchMetadata makes Close write (patch_metadata) with the given base
+// MD5 and size. PatchMD5 is ignored; it is computed over the written archive.
+// A nil meta removes the metadata.
+func (a *Archive) SetPatchMetadata(meta *PatchMetadata) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+	if meta != nil {
+		meta = &PatchMetadata{BaseMD5: meta.BaseMD5, BaseFileSize: meta.BaseFileSize}
+	}
+	a.patchMetadata = meta
+	a.patchMetadataChanged = true
+	return nil
+}
+
+// SetPatchBase makes Close write (patch_metadata) naming the archive at
+// basePath as the one this patch applies to.
+func (a *Archive) SetPatchBase(basePath string) error {
+	meta, err := fileMetadata(basePath)
+	if err != nil {
+		return err
+	}
+	return a.SetPatchMetadata(meta)
+}
+
+// fileMetadata returns patch metadata naming path as the base. BaseFileSize
+// holds the low 32 bits of the file size.
+func fileMetadata(path string) (*PatchMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open base archive: %w", err)
+	}
+	defer f.Close()
+
+	h := md5.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("hash base archive: %w", err)
+	}
+
+	meta := &PatchMetadata{BaseFileSize: uint32(size)}
+	copy(meta.BaseMD5[:], h.Sum(nil))
+	return meta, nil
+}
+
+// patchMD5 computes the PatchMD5 of the archive as written: the archive data
+// with the PatchMD5 field and any weak signature zeroed.
+func (a *Archive) patchMD5() ([16]byte, error) {
+	var sum [16]byte
+	r := io.NewSectionReader(a.file, int64(a.header.ArchiveOffset), int64(a.archiveDataSize()))
+
+	var zeroed [][2]int64 // start and end of each zeroed range
+	zero := func(name string, offset, size int64) {
+		block, err := a.findFile(name)
+		if err != nil {
+			return
+		}
+		start := min(int64(block.getFilePos64())+offset, r.Size())
+		zeroed = append(zeroed, [2]int64{start, min(start+size, r.Size())})
+	}
+	zero("(patch_metadata)", 16, 16)
+	zero("(signature)", 0, weakSignatureFileSize)
+	slices.SortFunc(zeroed, func(x, y [2]int64) int { return cmp.Compare(x[0], y[0]) })
+
+	h := md5.New()
+	var pos int64
+	for _, span := range zeroed {
+		start, end := max(span[0], pos), max(span[1], pos)
+		if _, err := io.CopyN(h, r, start-pos); err != nil {
+			return sum, fmt.Errorf("read archive data: %w", err)
+		}
+		if _, err := r.Seek(end, io.SeekStart); err != nil {
+			return sum, fmt.Errorf("read archive data: %w", err)
+		}
+		h.Write(make([]byte, end-start))
+		pos = end
+	}
+	if _, err := io.CopyN(h, r, r.Size()-pos); err != nil {
+		return sum, fmt.Errorf("read archive data: %w", err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// PatchBaseMismatch describes a patch archive whose (patch_metadata) does
+// not match the archive below it in the chain.
+type PatchBaseMismatch struct {
+	Patch  string // Path of the patch archive
+	Base   string // Path of the archive below it, empty if there is none
+	Reason string
+}
+
+func (m PatchBaseMismatch) String() string {
+	if m.Base == "" {
+		return fmt.Sprintf("%s: %s", m.Patch, m.Reason)
+	}
+	return fmt.Sprintf("%s (on %s): %s", m.Patch, m.Base, m.Reason)
+}
+
+// CheckPatchBases compares the (patch_metadata) of each archive in the chain
+// with the archive directly below it and reports patches applied to the
+// wrong base, along with patch archives that changed after their metadata
+// was written. Archives without metadata are not checked. The error is only
+// set if an archive cannot be read.
+//
+// The chain runs the same check when archives are added, removed or
+// reordered and keeps the result; see PatchBaseMismatches. CheckPatchBases
+// hashes the archives again, so it also notices files changed since then.
+func (p *PatchChain) CheckPatchBases() ([]PatchBaseMismatch, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var mismatches []PatchBaseMismatch
+	for i := range p.archives {
+		found, err := p.checkPatchBase(i)
+		if err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, found...)
+	}
+	return mismatches, nil
+}
+
+// PatchBaseMismatches returns the mismatches found by checking each archive
+// against the one below it, as CheckPatchBases does, when the chain was
+// opened and whenever archives were added, removed or reordered since. An
+// archive that could not be read is reported with the error as the reason.
+func (p *PatchChain) PatchBaseMismatches() []PatchBaseMismatch {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var mismatches []PatchBaseMismatch
+	for _, archive := range p.archives {
+		mismatches = append(mismatches, p.baseMismatches[archive.path]...)
+	}
+	return mismatches
+}
+
+// recheckPatchBase updates the stored base check of the archive at index i,
+// if there is one; the caller holds p.mu for writing.
+func (p *PatchChain) recheckPatchBase(i int) {
+	if i < 0 || i >= len(p.archives) {
+		return
+	}
+	path := p.archives[i].path
+	mismatches, err := p.checkPatchBase(i)
+	if err != nil {
+		mismatches = []PatchBaseMismatch{{Patch: path, Reason: err.Error()}}
+	}
+	if mismatches == nil {
+		delete(p.baseMismatches, path)
+		return
+	}
+	p.baseMismatches[path] = mismatches
+}
+
+// checkPatchBase checks the (patch_metadata) of the archive at index i
+// against the archive below it; the caller holds p.mu.
+func (p *PatchChain) checkPatchBase(i int) ([]PatchBaseMismatch, error) {
+	archive := p.archives[i]
+	meta := p.metadata[archive.path]
+	if meta == nil {
+		return nil, nil
+	}
+
+	var mismatches []PatchBaseMismatch
+	if meta.PatchMD5 != ([16]byte{}) {
+		sum, err := archive.patchMD5()
+		if err != nil {
+			return nil, fmt.Errorf("hash %s: %w", archive.path, err)
+		}
+		if sum != meta.PatchMD5 {
+			mismatches = append(mismatches, PatchBaseMismatch{
+				Patch:  archive.path,
+				Reason: "archive does not match its PatchMD5",
+			})
+		}
+	}
+
+	if i == 0 {
+		return append(mismatches, PatchBaseMismatch{
+			Patch:  archive.path,
+			Reason: "patch has no base archive in the chain",
+		}), nil
+	}
+
+	base := p.archives[i-1].path
+	actual, err := fileMetadata(base)
+	if err != nil {
+		return nil, err
+	}
+	if actual.BaseFileSize != meta.BaseFileSize {
+		mismatches = append(mismatches, PatchBaseMismatch{
+			Patch:  archive.path,
+			Base:   base,
+			Reason: fmt.Sprintf("base size is %d bytes, patch expects %d", actual.BaseFileSize, meta.BaseFileSize),
+		})
+	} else if actual.BaseMD5 != meta.BaseMD5 {
+		mismatches = append(mismatches, PatchBaseMismatch{
+			Patch:  archive.path,
+			Base:   base,
+			Reason: fmt.Sprintf("base MD5 is %x, patch expects %x", actual.BaseMD5, meta.BaseMD5),
+		})
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Insert opens the archive at path and adds it to the chain at priority:
+// 0 places it below every archive and GetArchiveCount() above all of them.
+// Its path prefix follows the options the chain was opened with.
+//
+// Only the new archive's (listfile) is read; the file map is updated in
+// place. The archive is opened before the chain is locked, so reads continue
+// until the change is applied. Reads that start afterwards see the new
+// archive. The new archive and the one above it are checked against their
+// bases as described under PatchBaseMismatches.
+func (p *PatchChain) Insert(path string, priority int) error {
+	archive, err := Open(path)
+	if err != nil {
+		return fmt.Errorf("open archive %s: %w", path, err)
+	}
+	prefix := p.opts.archivePrefix(path, archive)
+	files, err := listPrefixed(archive, prefix)
+	if err != nil {
+		// Like OpenPatchChain, an archive without a listfile adds no entries
+		files = nil
+	}
+	meta, err := archive.readPatchMetadata()
+	if err != nil {
+		meta = nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if priority < 0 || priority > len(p.archives) {
+		archive.Close()
+		return fmt.Errorf("priority %d out of range 0-%d", priority, len(p.archives))
+	}
+	if p.indexOf(path) >= 0 {
+		archive.Close()
+		return fmt.Errorf("archive already in patch chain: %s", path)
+	}
+
+	p.insert(archive, prefix, meta, files, priority)
+	return nil
+}
+
+// insert adds an opened archive at index k and updates the file map; the
+// caller holds p.mu for writing.
+func (p *PatchChain) insert(archive *Archive, prefix string, meta *PatchMetadata, files []string, k int) {
+	p.archives = slices.Insert(p.archives, k, archive)
+	p.prefixes = slices.Insert(p.prefixes, k, prefix)
+	if meta != nil {
+		p.metadata[archive.path] = meta
+	}
+	p.recheckPatchBase(k)
+	p.recheckPatchBase(k + 1)
+
+	for key, idx := range p.fileMap {
+		if idx >= k {
+			p.fileMap[key] = idx + 1
+		}
+	}
+	for _, file := range files {
+		key := normalizeMpqPath(file)
+		if idx, ok := p.fileMap[key]; !ok || idx < k {
+			p.fileMap[key] = k
+		}
+	}
+}
+
+// Remove closes the archive at path and removes it from the chain. Files it
+// supplied fall back to the next archive below that has them.
+//
+// Remove waits for reads in progress to finish, so none of them sees the
+// archive closed; reads that start afterwards resolve without it.
+func (p *PatchChain) Remove(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := p.indexOf(path)
+	if k < 0 {
+		return fmt.Errorf("archive not in patch chain: %s", path)
+	}
+	archive := p.archives[k]
+
+	for key, idx := range p.fileMap {
+		switch {
+		case idx > k:
+			p.fileMap[key] = idx - 1
+		case idx == k:
+			delete(p.fileMap, key)
+			for i := k - 1; i >= 0; i-- {
+				if _, err := p.findFile(i, key); err == nil {
+					p.fileMap[key] = i
+					break
+				}
+			}
+		}
+	}
+
+	p.archives = slices.Delete(p.archives, k, k+1)
+	p.prefixes = slices.Delete(p.prefixes, k, k+1)
+	delete(p.metadata, path)
+	delete(p.baseMismatches, path)
+	p.recheckPatchBase(k)
+	return archive.Close()
+}
+
+// Reorder sets the priority of the archives in the chain. Paths must list
+// every archive in the chain exactly once, lowest priority first.
+//
+// No listfiles are read: each file is only checked against the archives that
+// now rank above its previous owner. Like Remove, Reorder waits for reads in
+// progress and applies the new order at once.
+func (p *PatchChain) Reorder(paths []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(paths) != len(p.archives) {
+		return fmt.Errorf("reorder lists %d archives, chain has %d", len(paths), len(p.archives))
+	}
+	position := make([]int, len(p.archives)) // old index -> new index
+	moved := make([]bool, len(p.archives))
+	for n, path := range paths {
+		k := p.indexOf(path)
+		if k < 0 {
+			return fmt.Errorf("archive not in patch chain: %s", path)
+		}
+		if moved[k] {
+			return fmt.Errorf("archive listed twice: %s", path)
+		}
+		moved[k] = true
+		position[k] = n
+	}
+
+	archives := make([]*Archive, len(p.archives))
+	prefixes := make([]string, len(p.prefixes))
+	for k, n := range position {
+		archives[n] = p.archives[k]
+		prefixes[n] = p.prefixes[k]
+	}
+	p.archives = archives
+	p.prefixes = prefixes
+
+	// The previous owner still has the file, so only archives above its new
+	// position can take over
+	for key, idx := range p.fileMap {
+		owner := position[idx]
+		for i := len(p.archives) - 1; i > owner; i-- {
+			if _, err := p.findFile(i, key); err == nil {
+				owner = i
+				break
+			}
+		}
+		p.fileMap[key] = owner
+	}
+
+	for i := range p.archives {
+		p.recheckPatchBase(i)
+	}
+	return nil
+}
+
+// indexOf returns the index of the archive opened from path, or -1.
+func (p *PatchChain) indexOf(path string) int {
+	for i, archive := range p.archives {
+		if archive.path == path {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestPatchChainInsertRemoveReorder(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_order_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	basePath := writeTestArchive(t, tmpDir, "base.mpq", map[string]string{"a.txt": "base a", "b.txt": "base b", "c.txt": "base c"})
+	modA := writeTestArchive(t, tmpDir, "mod-a.mpq", map[string]string{"a.txt": "mod-a a", "d.txt": "mod-a d"})
+	modB := writeTestArchive(t, tmpDir, "mod-b.mpq", map[string]string{"a.txt": "mod-b a"}, "b.txt")
+
+	chain, err := OpenPatchChain([]string{basePath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+
+	// check compares the chain with its expected contents and the
+	// incrementally maintained file map with a full rebuild
+	check := func(stage string, want map[string]string) {
+		t.Helper()
+		for name, content := range want {
+			data, err := chain.ReadFile(name)
+			if content == "" {
+				if err == nil || chain.HasFile(name) {
+					t.Errorf("%s: %s should not exist", stage, name)
+				}
+				continue
+			}
+			if err != nil || string(data) != content {
+				t.Errorf("%s: %s = %q, %v; want %q", stage, name, data, err, content)
+			}
+		}
+
+		incremental := chain.fileMap
+		chain.rebuildFileMap()
+		if !reflect.DeepEqual(incremental, chain.fileMap) {
+			t.Errorf("%s: file map %v, rebuilt %v", stage, incremental, chain.fileMap)
+		}
+	}
+
+	if err := chain.Insert(modB, 1); err != nil {
+		t.Fatalf("insert mod-b: %v", err)
+	}
+	if err := chain.Insert(modA, 1); err != nil {
+		t.Fatalf("insert mod-a: %v", err)
+	}
+	check("inserted", map[string]string{"a.txt": "mod-b a", "b.txt": "", "c.txt": "base c", "d.txt": "mod-a d"})
+
+	if err := chain.Insert(modA, 0); err == nil {
+		t.Error("expected error inserting an archive twice")
+	}
+	if err := chain.Insert(filepath.Join(tmpDir, "base.mpq"), 5); err == nil {
+		t.Error("expected error for priority out of range")
+	}
+
+	if err := chain.Reorder([]string{modB, basePath, modA}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	check("reordered", map[string]string{"a.txt": "mod-a a", "b.txt": "base b", "c.txt": "base c", "d.txt": "mod-a d"})
+
+	if err := chain.Reorder([]string{modB, modB, modA}); err == nil {
+		t.Error("expected error for an archive listed twice")
+	}
+	if err := chain.Reorder([]string{modB, basePath}); err == nil {
+		t.Error("expected error for a missing archive")
+	}
+
+	if err := chain.Remove(modA); err != nil {
+		t.Fatalf("remove mod-a: %v", err)
+	}
+	check("removed", map[string]string{"a.txt": "base a", "b.txt": "base b", "d.txt": ""})
+	if chain.GetArchiveCount() != 2 {
+		t.Errorf("chain has %d archives, want 2", chain.GetArchiveCount())
+	}
+	if err := chain.Remove(modA); err == nil {
+		t.Error("expected error removing an archive twice")
+	}
+}
+
+// Run with -race to check that readers never see a half-updated chain.
+func TestPatchChainToggleWhileReading(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_order_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	paths := []string{
+		writeTestArchive(t, tmpDir, "base.mpq", map[string]string{"shared.txt": "base", "base.txt": "base only"}),
+		writeTestArchive(t, tmpDir, "mod.mpq", map[string]string{"shared.txt": "mod"}),
+	}
+
+	chain, err := OpenPatchChain(paths[:1])
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				data, err := chain.ReadFile("shared.txt")
+				if err != nil || (string(data) != "base" && string(data) != "mod") {
+					t.Errorf("read shared.txt = %q, %v", data, err)
+					return
+				}
+				if !chain.HasFile("base.txt") {
+					t.Error("base.txt missing")
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := chain.Insert(paths[1], 1); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		if err := chain.Remove(paths[1]); err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"strings"
+)
+
+// PatchChainOptions controls OpenPatchChainWithOptions.
+//
+// WoW 3.x patch archives can store files below a prefix such as "base\" or
+// "enUS\" that the client strips when overlaying them onto the main data.
+// An archive with a prefix only contributes the files below it, under their
+// path without the prefix.
+type PatchChainOptions struct {
+	// Prefixes maps archive paths (as passed to OpenPatchChainWithOptions)
+	// to their prefix, e.g. "base" or "enUS\". An empty prefix disables
+	// detection for that archive.
+	Prefixes map[string]string
+
+	// DetectPrefixes detects the prefix of archives not listed in Prefixes:
+	// if every file is below "base\" or a locale directory such as "enUS\",
+	// that directory is used.
+	DetectPrefixes bool
+}
+
+// patchPrefixLocales are the locale directories used by WoW patch archives.
+var patchPrefixLocales = []string{
+	"enUS", "enGB", "enCN", "enTW", "deDE", "esES", "esMX", "frFR",
+	"itIT", "koKR", "ptBR", "ptPT", "ruRU", "zhCN", "zhTW",
+}
+
+// Prefix returns the path prefix used for an archive in the chain, or "" if
+// it has none.
+func (p *PatchChain) Prefix(archivePath string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if i := p.indexOf(archivePath); i >= 0 {
+		return p.prefixes[i]
+	}
+	return ""
+}
+
+// archivePath returns the path of a chain file within archive i.
+func (p *PatchChain) archivePath(i int, mpqPath string) string {
+	return p.prefixes[i] + strings.ReplaceAll(mpqPath, "/", "\\")
+}
+
+// findFile looks up a chain file in archive i.
+func (p *PatchChain) findFile(i int, mpqPath string) (*blockTableEntryEx, error) {
+	return p.archives[i].findFile(p.archivePath(i, mpqPath))
+}
+
+// listArchive returns the chain paths of the files in archive i: files
+// outside the archive's prefix are skipped and the prefix is removed.
+func (p *PatchChain) listArchive(i int) ([]string, error) {
+	return listPrefixed(p.archives[i], p.prefixes[i])
+}
+
+// listPrefixed lists the files of an archive below prefix, without the prefix.
+func listPrefixed(archive *Archive, prefix string) ([]string, error) {
+	files, err := archive.ListFiles()
+	if err != nil || prefix == "" {
+		return files, err
+	}
+
+	var result []string
+	for _, file := range files {
+		if rest, ok := cutPatchPrefix(file, prefix); ok {
+			result = append(result, rest)
+		}
+	}
+	return result, nil
+}
+
+// archivePrefix returns the normalized prefix opts give the archive at path.
+func (opts PatchChainOptions) archivePrefix(path string, archive *Archive) string {
+	prefix, explicit := opts.Prefixes[path]
+	if !explicit && opts.DetectPrefixes {
+		prefix = detectPatchPrefix(archive)
+	}
+	return normalizePatchPrefix(prefix)
+}
+
+// cutPatchPrefix removes prefix from name, comparing case-insensitively.
+func cutPatchPrefix(name, prefix string) (string, bool) {
+	name = strings.ReplaceAll(name, "/", "\\")
+	if len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+		return "", false
+	}
+	return name[len(prefix):], true
+}
+
+// normalizePatchPrefix converts a prefix to backslashes with a single
+// trailing separator.
+func normalizePatchPrefix(prefix string) string {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "/", "\\"), "\\")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "\\"
+}
+
+// detectPatchPrefix returns "base" or a locale name if every file in the
+// archive is stored below that directory, or "" otherwise.
+func detectPatchPrefix(a *Archive) string {
+	files, err := a.ListFiles()
+	if err != nil || len(files) == 0 {
+		return ""
+	}
+
+	first, _, _ := strings.Cut(strings.ReplaceAll(files[0], "/", "\\"), "\\")
+	if !isPatchPrefix(first) {
+		return ""
+	}
+	for _, file := range files {
+		if _, ok := cutPatchPrefix(file, first+"\\"); !ok {
+			return ""
+		}
+	}
+	return first
+}
+
+// isPatchPrefix reports whether dir is a directory WoW uses as a patch prefix.
+func isPatchPrefix(dir string) bool {
+	if strings.EqualFold(dir, "base") {
+		return true
+	}
+	for _, locale := range patchPrefixLocales {
+		if strings.EqualFold(dir, locale) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTestArchive creates the archive name in dir holding files, keyed by
+// archive path, and deletion markers for deleted.
+func writeTestArchive(t *testing.T, dir, name string, files map[string]string, deleted ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	archive, err := Create(path, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for mpqPath, content := range files {
+		if err := archive.AddFileData([]byte(content), mpqPath, FileOptions{}); err != nil {
+			t.Fatalf("add %s: %v", mpqPath, err)
+		}
+	}
+	for _, mpqPath := range deleted {
+		if err := archive.AddDeleteMarker(mpqPath); err != nil {
+			t.Fatalf("add delete marker %s: %v", mpqPath, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	return path
+}
+
+func TestPatchChainPrefixes(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_prefix_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	basePath := writeTestArchive(t, tmpDir, "common.mpq", map[string]string{
+		"DBFilesClient\\Spell.dbc": "base spells",
+		"Interface\\Old.xml":       "old",
+		"Sound\\Music.mp3":         "music",
+	})
+	localePath := writeTestArchive(t, tmpDir, "patch-enUS.mpq", map[string]string{
+		"enUS\\DBFilesClient\\Spell.dbc": "enUS spells",
+		"enUS\\Interface\\New.xml":       "new",
+	}, "enUS\\Interface\\Old.xml")
+	patchPath := writeTestArchive(t, tmpDir, "patch.mpq", map[string]string{
+		"base\\Sound\\Music.mp3": "patched music",
+	})
+	paths := []string{basePath, localePath, patchPath}
+
+	// Without prefixes the patches do not override anything
+	chain, err := OpenPatchChain(paths)
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	if data, _ := chain.ReadFile("DBFilesClient\\Spell.dbc"); string(data) != "base spells" {
+		t.Errorf("literal chain read %q", data)
+	}
+	chain.Close()
+
+	tests := []struct {
+		name string
+		opts PatchChainOptions
+	}{
+		{"detected", PatchChainOptions{DetectPrefixes: true}},
+		{"explicit", PatchChainOptions{Prefixes: map[string]string{localePath: "enUS", patchPath: "base/"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := OpenPatchChainWithOptions(paths, tt.opts)
+			if err != nil {
+				t.Fatalf("open chain: %v", err)
+			}
+			defer chain.Close()
+
+			if got := chain.Prefix(localePath); got != "enUS\\" {
+				t.Errorf("Prefix(locale) = %q", got)
+			}
+			if got := chain.Prefix(basePath); got != "" {
+				t.Errorf("Prefix(base) = %q", got)
+			}
+
+			files, err := chain.ListFiles()
+			if err != nil {
+				t.Fatalf("list files: %v", err)
+			}
+			globbed, _ := chain.Glob("**")
+			want := []string{"DBFilesClient\\Spell.dbc", "Interface\\New.xml", "Sound\\Music.mp3"}
+			if !reflect.DeepEqual(globbed, want) {
+				t.Errorf("Glob = %v, want %v (listed %v)", globbed, want, files)
+			}
+
+			for name, content := range map[string]string{
+				"DBFilesClient\\Spell.dbc": "enUS spells",
+				"Interface/New.xml":        "new",
+				"Sound\\Music.mp3":         "patched music",
+			} {
+				dest := filepath.Join(tmpDir, tt.name, filepath.Base(name))
+				if err := chain.ExtractFile(name, dest); err != nil {
+					t.Fatalf("extract %s: %v", name, err)
+				}
+				if data, _ := os.ReadFile(dest); string(data) != content {
+					t.Errorf("%s = %q, want %q", name, data, content)
+				}
+			}
+
+			if chain.HasFile("Interface\\Old.xml") {
+				t.Error("file deleted in the prefixed patch is still present")
+			}
+			if chain.HasFile("enUS\\Interface\\New.xml") {
+				t.Error("prefixed path is visible in the chain")
+			}
+
+			info, err := chain.Stat("DBFilesClient\\Spell.dbc")
+			if err != nil {
+				t.Fatalf("stat: %v", err)
+			}
+			if info.Path != "DBFilesClient\\Spell.dbc" || info.ArchivePath != localePath {
+				t.Errorf("stat = %s from %s", info.Path, info.ArchivePath)
+			}
+		})
+	}
+}
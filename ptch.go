@@ -0,0 +1,380 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Incremental patch files (FILE_PATCH_FILE entries in WoW patch archives)
+// start with a PTCH header followed by an MD5_ block and an XFRM block. The
+// XFRM block holds either a full copy of the new file (COPY) or a Blizzard
+// flavoured bsdiff delta (BSD0), optionally RLE compressed.
+const (
+	patchSignature     = 0x48435450 // "PTCH"
+	patchMD5Signature  = 0x5F35444D // "MD5_"
+	patchXFRMSignature = 0x4D524658 // "XFRM"
+	patchTypeBSD0      = 0x30445342 // "BSD0"
+	patchTypeCOPY      = 0x59504F43 // "COPY"
+
+	patchHeaderSize   = 0x44 // PTCH, MD5_ and XFRM headers
+	patchMD5BlockSize = 0x28
+	patchXFRMHeader   = 0x0C
+
+	bsdiffSignature  = "BSDIFF40"
+	bsdiffHeaderSize = 32
+
+	// TPatchInfo precedes the data of patch files stored in an archive
+	patchInfoSize     = 0x1C
+	patchInfoFlagsMD5 = 0x80000000
+)
+
+// PatchHeader is the header of an incremental patch file.
+type PatchHeader struct {
+	PatchDataSize uint32   // Size of the whole patch with an uncompressed XFRM block
+	SizeBefore    uint32   // Size of the file the patch applies to
+	SizeAfter     uint32   // Size of the patched file
+	MD5Before     [16]byte // MD5 of the file the patch applies to
+	MD5After      [16]byte // MD5 of the patched file
+	Type          string   // "BSD0" or "COPY"
+	XFRMSize      uint32   // Size of the XFRM block, including its 12-byte header
+}
+
+// IsPatchData reports whether data starts with a PTCH header.
+func IsPatchData(data []byte) bool {
+	return len(data) >= 4 && binary.LittleEndian.Uint32(data) == patchSignature
+}
+
+// ParsePatchHeader parses the header of an incremental patch file.
+func ParsePatchHeader(data []byte) (*PatchHeader, error) {
+	if len(data) < patchHeaderSize {
+		return nil, fmt.Errorf("patch too small: %d bytes", len(data))
+	}
+	if !IsPatchData(data) {
+		return nil, fmt.Errorf("missing PTCH signature")
+	}
+	if binary.LittleEndian.Uint32(data[16:20]) != patchMD5Signature {
+		return nil, fmt.Errorf("missing MD5_ block")
+	}
+	if binary.LittleEndian.Uint32(data[56:60]) != patchXFRMSignature {
+		return nil, fmt.Errorf("missing XFRM block")
+	}
+
+	h := &PatchHeader{
+		PatchDataSize: binary.LittleEndian.Uint32(data[4:8]),
+		SizeBefore:    binary.LittleEndian.Uint32(data[8:12]),
+		SizeAfter:     binary.LittleEndian.Uint32(data[12:16]),
+		XFRMSize:      binary.LittleEndian.Uint32(data[60:64]),
+		Type:          string(data[64:68]),
+	}
+	copy(h.MD5Before[:], data[24:40])
+	copy(h.MD5After[:], data[40:56])
+
+	if h.XFRMSize < patchXFRMHeader || uint64(h.XFRMSize)-patchXFRMHeader > uint64(len(data)-patchHeaderSize) {
+		return nil, fmt.Errorf("invalid XFRM block size: %d", h.XFRMSize)
+	}
+	if patchType := binary.LittleEndian.Uint32(data[64:68]); patchType != patchTypeBSD0 && patchType != patchTypeCOPY {
+		return nil, fmt.Errorf("unsupported patch type %q", h.Type)
+	}
+
+	return h, nil
+}
+
+// ApplyPatch applies an incremental patch file to base and returns the
+// patched data. The MD5 of base and of the result are checked against the
+// patch header (an all-zero hash is not checked).
+func ApplyPatch(base, patch []byte) ([]byte, error) {
+	h, err := ParsePatchHeader(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.SizeBefore != uint32(len(base)) {
+		return nil, fmt.Errorf("patch expects a %d byte file, got %d bytes", h.SizeBefore, len(base))
+	}
+	if h.MD5Before != ([16]byte{}) && md5.Sum(base) != h.MD5Before {
+		return nil, fmt.Errorf("patch does not apply: base file MD5 mismatch")
+	}
+
+	payload := patch[patchHeaderSize : patchHeaderSize+h.XFRMSize-patchXFRMHeader]
+
+	var result []byte
+	switch h.Type {
+	case "COPY":
+		result = append([]byte(nil), payload...)
+	case "BSD0":
+		// The delta is RLE compressed if that made it smaller
+		if h.PatchDataSize < patchHeaderSize {
+			return nil, fmt.Errorf("invalid patch data size: %d", h.PatchDataSize)
+		}
+		deltaSize := h.PatchDataSize - patchHeaderSize
+		delta := payload
+		if uint32(len(payload)) < deltaSize {
+			delta = decompressPatchRLE(payload, deltaSize)
+		}
+		result, err = applyBSDIFF40(base, delta)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if uint32(len(result)) != h.SizeAfter {
+		return nil, fmt.Errorf("patched file is %d bytes, expected %d", len(result), h.SizeAfter)
+	}
+	if h.MD5After != ([16]byte{}) && md5.Sum(result) != h.MD5After {
+		return nil, fmt.Errorf("patched file MD5 mismatch")
+	}
+
+	return result, nil
+}
+
+// CreatePatch returns an incremental patch file that turns old into new.
+// The patch is a BSD0 delta (RLE compressed when that is smaller), or a COPY
+// of new if the delta would not be smaller than the file itself.
+func CreatePatch(old, new []byte) ([]byte, error) {
+	if uint64(len(old)) > math.MaxUint32 || uint64(len(new)) > math.MaxUint32-patchHeaderSize {
+		return nil, fmt.Errorf("file too large for a patch")
+	}
+
+	delta := createBSDIFF40(old, new)
+	payload := delta
+	if rle := compressPatchRLE(delta); len(rle) < len(delta) {
+		payload = rle
+	}
+
+	if len(new) <= len(payload) {
+		return buildPatch(patchTypeCOPY, old, new, new, len(new)), nil
+	}
+	return buildPatch(patchTypeBSD0, old, new, payload, len(delta)), nil
+}
+
+// buildPatch assembles a patch file from its XFRM payload. dataSize is the
+// size of the payload once expanded.
+func buildPatch(patchType uint32, old, new, payload []byte, dataSize int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(patchHeaderSize + len(payload))
+
+	md5Before := md5.Sum(old)
+	md5After := md5.Sum(new)
+	binary.Write(&buf, binary.LittleEndian, [4]uint32{
+		patchSignature, uint32(patchHeaderSize + dataSize), uint32(len(old)), uint32(len(new)),
+	})
+	binary.Write(&buf, binary.LittleEndian, [2]uint32{patchMD5Signature, patchMD5BlockSize})
+	buf.Write(md5Before[:])
+	buf.Write(md5After[:])
+	binary.Write(&buf, binary.LittleEndian, [3]uint32{
+		patchXFRMSignature, uint32(patchXFRMHeader + len(payload)), patchType,
+	})
+	buf.Write(payload)
+
+	return buf.Bytes()
+}
+
+// AddIncrementalPatch adds a patch file that turns basePath into srcPath.
+// The patch is stored BZip2 compressed with FILE_PATCH_FILE, so that clients
+// and PatchChain apply it to the version of mpqPath in a lower archive.
+func (a *Archive) AddIncrementalPatch(basePath, srcPath, mpqPath string) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return fmt.Errorf("read base file %s: %w", basePath, err)
+	}
+	data, fileTime, err := readSourceFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	patch, err := CreatePatch(base, data)
+	if err != nil {
+		return fmt.Errorf("create patch for %s: %w", mpqPath, err)
+	}
+
+	return a.addPending("", mpqPath, patch, fileTime, FileOptions{Compression: CompressionBzip2, PatchFile: true})
+}
+
+// AddIncrementalPatchData adds a patch file that turns base into data from
+// memory. opts.PatchFile is implied; CompressionBzip2 matches the patches
+// shipped by Blizzard.
+func (a *Archive) AddIncrementalPatchData(base, data []byte, mpqPath string, opts FileOptions) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	patch, err := CreatePatch(base, data)
+	if err != nil {
+		return fmt.Errorf("create patch for %s: %w", mpqPath, err)
+	}
+
+	opts.PatchFile = true
+	return a.addPending("", mpqPath, patch, 0, opts)
+}
+
+// compressPatchRLE compresses a BSD0 delta with the scheme read by
+// decompressPatchRLE. Runs of two or more zero bytes are skipped; everything
+// else is stored as literals.
+func compressPatchRLE(data []byte) []byte {
+	out := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+	for i := 0; i < len(data); {
+		zeros := 0
+		for i+zeros < len(data) && zeros < 0x80 && data[i+zeros] == 0 {
+			zeros++
+		}
+		if zeros >= 2 || (zeros == 1 && i+1 == len(data)) {
+			out = append(out, byte(zeros-1))
+			i += zeros
+			continue
+		}
+
+		j := i
+		for j < len(data) && j-i < 0x80 && !(data[j] == 0 && (j+1 == len(data) || data[j+1] == 0)) {
+			j++
+		}
+		out = append(out, 0x80|byte(j-i-1))
+		out = append(out, data[i:j]...)
+		i = j
+	}
+	return out
+}
+
+// decompressPatchRLE expands the RLE scheme used for BSD0 deltas. After an
+// initial 32-bit size, a control byte with the high bit set is followed by
+// (n & 0x7F) + 1 literal bytes; otherwise it skips n + 1 zero bytes.
+func decompressPatchRLE(data []byte, size uint32) []byte {
+	out := make([]byte, size)
+	if len(data) < 4 {
+		return out
+	}
+	data = data[4:]
+
+	pos := uint32(0)
+	for len(data) > 0 && pos < size {
+		control := data[0]
+		data = data[1:]
+
+		if control&0x80 != 0 {
+			count := int(control&0x7F) + 1
+			for i := 0; i < count && len(data) > 0 && pos < size; i++ {
+				out[pos] = data[0]
+				data = data[1:]
+				pos++
+			}
+		} else {
+			pos += uint32(control) + 1
+		}
+	}
+
+	return out
+}
+
+// applyBSDIFF40 applies a Blizzard BSDIFF40 delta: a 32-byte header with
+// little-endian 64-bit sizes, then uncompressed control, diff and extra
+// blocks. Control entries are three little-endian 32-bit values: bytes to add
+// from the diff block, bytes to copy from the extra block and a sign-magnitude
+// seek in the old file.
+func applyBSDIFF40(old, delta []byte) ([]byte, error) {
+	if len(delta) < bsdiffHeaderSize || string(delta[:8]) != bsdiffSignature {
+		return nil, fmt.Errorf("missing BSDIFF40 signature")
+	}
+
+	ctrlSize := binary.LittleEndian.Uint64(delta[8:16])
+	diffSize := binary.LittleEndian.Uint64(delta[16:24])
+	newSize := binary.LittleEndian.Uint64(delta[24:32])
+
+	body := delta[bsdiffHeaderSize:]
+	if ctrlSize > uint64(len(body)) || diffSize > uint64(len(body))-ctrlSize || newSize > 0x7FFFFFFF {
+		return nil, fmt.Errorf("BSDIFF40 blocks exceed the patch size")
+	}
+	ctrl := body[:ctrlSize]
+	diff := body[ctrlSize : ctrlSize+diffSize]
+	extra := body[ctrlSize+diffSize:]
+
+	out := make([]byte, newSize)
+	newPos := uint64(0)
+	oldPos := int64(0)
+
+	for newPos < newSize {
+		if len(ctrl) < 12 {
+			return nil, fmt.Errorf("BSDIFF40 control block truncated")
+		}
+		addLen := uint64(binary.LittleEndian.Uint32(ctrl[0:4]))
+		copyLen := uint64(binary.LittleEndian.Uint32(ctrl[4:8]))
+		seek := binary.LittleEndian.Uint32(ctrl[8:12])
+		ctrl = ctrl[12:]
+
+		if newPos+addLen > newSize || addLen > uint64(len(diff)) {
+			return nil, fmt.Errorf("BSDIFF40 diff block out of range")
+		}
+		for i := uint64(0); i < addLen; i++ {
+			b := diff[i]
+			if o := oldPos + int64(i); o >= 0 && o < int64(len(old)) {
+				b += old[o]
+			}
+			out[newPos+i] = b
+		}
+		diff = diff[addLen:]
+		newPos += addLen
+		oldPos += int64(addLen)
+
+		if newPos+copyLen > newSize || copyLen > uint64(len(extra)) {
+			return nil, fmt.Errorf("BSDIFF40 extra block out of range")
+		}
+		copy(out[newPos:], extra[:copyLen])
+		extra = extra[copyLen:]
+		newPos += copyLen
+
+		if seek&0x80000000 != 0 {
+			oldPos -= int64(seek & 0x7FFFFFFF)
+		} else {
+			oldPos += int64(seek)
+		}
+	}
+
+	return out, nil
+}
+
+// patchInfo is the TPatchInfo structure that precedes the data of patch
+// files in WoW patch archives.
+type patchInfo struct {
+	length   uint32
+	flags    uint32
+	dataSize uint32 // Size of the patch file once decoded
+	md5      [16]byte
+}
+
+// parsePatchInfo parses a TPatchInfo at the start of raw block data. A
+// sector offset table can also start with 0x1C, so the MD5 flag is required.
+func parsePatchInfo(raw []byte) (*patchInfo, bool) {
+	if len(raw) < patchInfoSize {
+		return nil, false
+	}
+	info := &patchInfo{
+		length:   binary.LittleEndian.Uint32(raw[0:4]),
+		flags:    binary.LittleEndian.Uint32(raw[4:8]),
+		dataSize: binary.LittleEndian.Uint32(raw[8:12]),
+	}
+	if info.length != patchInfoSize || info.flags&patchInfoFlagsMD5 == 0 {
+		return nil, false
+	}
+	copy(info.md5[:], raw[12:28])
+	return info, true
+}
+
+// buildPatchInfo returns the TPatchInfo stored in front of a patch file.
+func buildPatchInfo(patch []byte) []byte {
+	info := make([]byte, patchInfoSize)
+	binary.LittleEndian.PutUint32(info[0:4], patchInfoSize)
+	binary.LittleEndian.PutUint32(info[4:8], patchInfoFlagsMD5)
+	binary.LittleEndian.PutUint32(info[8:12], uint32(len(patch)))
+	sum := md5.Sum(patch)
+	copy(info[12:28], sum[:])
+	return info
+}
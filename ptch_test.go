@@ -0,0 +1,335 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildTestPatch assembles a PTCH file around an XFRM payload.
+func buildTestPatch(typ string, before, after, payload []byte, deltaSize int) []byte {
+	var buf bytes.Buffer
+	le := func(v uint32) { binary.Write(&buf, binary.LittleEndian, v) }
+
+	le(patchSignature)
+	le(uint32(patchHeaderSize + deltaSize))
+	le(uint32(len(before)))
+	le(uint32(len(after)))
+	le(patchMD5Signature)
+	le(patchMD5BlockSize)
+	beforeSum := md5.Sum(before)
+	afterSum := md5.Sum(after)
+	buf.Write(beforeSum[:])
+	buf.Write(afterSum[:])
+	le(patchXFRMSignature)
+	le(uint32(patchXFRMHeader + len(payload)))
+	buf.WriteString(typ)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// buildTestDelta builds a BSDIFF40 delta that adds the byte differences over
+// the common length and copies the rest of the new file from the extra block.
+func buildTestDelta(old, new []byte) []byte {
+	n := len(old)
+	if len(new) < n {
+		n = len(new)
+	}
+	diff := make([]byte, n)
+	for i := 0; i < n; i++ {
+		diff[i] = new[i] - old[i]
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(bsdiffSignature)
+	binary.Write(&buf, binary.LittleEndian, uint64(12))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(diff)))
+	binary.Write(&buf, binary.LittleEndian, uint64(len(new)))
+	binary.Write(&buf, binary.LittleEndian, [3]uint32{uint32(n), uint32(len(new) - n), 0})
+	buf.Write(diff)
+	buf.Write(new[n:])
+	return buf.Bytes()
+}
+
+func TestApplyPatch(t *testing.T) {
+	base := []byte("The quick brown fox jumps over the lazy dog")
+	target := []byte("The quick brown cat jumps over the lazy dog, twice")
+
+	delta := buildTestDelta(base, target)
+	tests := []struct {
+		name  string
+		patch []byte
+	}{
+		{"COPY", buildTestPatch("COPY", base, target, target, len(target))},
+		{"BSD0", buildTestPatch("BSD0", base, target, delta, len(delta))},
+		{"BSD0 RLE", buildTestPatch("BSD0", base, target, compressPatchRLE(delta), len(delta))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !IsPatchData(tt.patch) {
+				t.Fatal("IsPatchData = false")
+			}
+			h, err := ParsePatchHeader(tt.patch)
+			if err != nil {
+				t.Fatalf("parse header: %v", err)
+			}
+			if h.Type != tt.name[:4] || h.SizeAfter != uint32(len(target)) {
+				t.Errorf("header = %+v", h)
+			}
+
+			got, err := ApplyPatch(base, tt.patch)
+			if err != nil {
+				t.Fatalf("apply patch: %v", err)
+			}
+			if !bytes.Equal(got, target) {
+				t.Errorf("patched = %q, want %q", got, target)
+			}
+		})
+	}
+
+	wrongBase := []byte("The quick brown fox jumps over the lazy cat")
+	patch := buildTestPatch("BSD0", base, target, delta, len(delta))
+	if _, err := ApplyPatch(wrongBase, patch); err == nil || !strings.Contains(err.Error(), "MD5") {
+		t.Errorf("apply to wrong base: err = %v, want MD5 mismatch", err)
+	}
+}
+
+func TestPatchChainApplyPatches(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_ptch_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	v1 := []byte(strings.Repeat("base file contents\n", 20))
+	v2 := append(append([]byte(nil), v1...), "first patch\n"...)
+	v3 := bytes.Replace(v2, []byte("base"), []byte("BASE"), 1)
+
+	delta := buildTestDelta(v1, v2)
+	patch1 := buildTestPatch("BSD0", v1, v2, compressPatchRLE(delta), len(delta))
+	patch2 := buildTestPatch("COPY", v2, v3, v3, len(v3))
+
+	// The second patch is stored the way WoW patch archives store them, with
+	// a TPatchInfo in front of the patch data
+	info := binary.LittleEndian.AppendUint32(nil, patchInfoSize)
+	info = binary.LittleEndian.AppendUint32(info, patchInfoFlagsMD5)
+	info = binary.LittleEndian.AppendUint32(info, uint32(len(patch2)))
+	sum := md5.Sum(patch2)
+	info = append(info, sum[:]...)
+	patch2 = append(info, patch2...)
+
+	const name = "Data\\File.txt"
+	archives := []struct {
+		file string
+		data []byte
+		opts FileOptions
+	}{
+		{"base.mpq", v1, FileOptions{}},
+		{"patch-1.mpq", patch1, FileOptions{PatchFile: true}},
+		{"patch-2.mpq", patch2, FileOptions{PatchFile: true, Compression: CompressionNone}},
+	}
+	var paths []string
+	for _, a := range archives {
+		path := filepath.Join(tmpDir, a.file)
+		archive, err := Create(path, 10)
+		if err != nil {
+			t.Fatalf("create archive: %v", err)
+		}
+		if err := archive.AddFileData(a.data, name, a.opts); err != nil {
+			t.Fatalf("add file: %v", err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	for n, want := range [][]byte{v1, v2, v3} {
+		chain, err := OpenPatchChain(paths[:n+1])
+		if err != nil {
+			t.Fatalf("open chain: %v", err)
+		}
+		got, err := chain.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read with %d archives: %v", n+1, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("read with %d archives = %q, want %q", n+1, got, want)
+		}
+
+		dest := filepath.Join(tmpDir, "out", "File.txt")
+		if err := chain.ExtractFile(name, dest); err != nil {
+			t.Fatalf("extract: %v", err)
+		}
+		if got, _ := os.ReadFile(dest); !bytes.Equal(got, want) {
+			t.Errorf("extracted with %d archives = %q, want %q", n+1, got, want)
+		}
+		chain.Close()
+	}
+
+	// A patch without a base in the chain cannot be applied
+	chain, err := OpenPatchChain(paths[1:])
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+	if _, err := chain.ReadFile(name); err == nil {
+		t.Error("read patch without base: expected error")
+	}
+}
+
+func TestCreatePatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	old := make([]byte, 50000)
+	r.Read(old[:25000]) // Random first half, zeros after
+
+	edited := append([]byte(nil), old...)
+	copy(edited[1000:], "inserted text")
+	edited = append(edited[:30000], append([]byte("grown"), edited[30000:]...)...)
+	edited = append(edited[:5000], edited[6000:]...)
+
+	unrelated := make([]byte, 1000)
+	r.Read(unrelated)
+
+	tests := []struct {
+		name     string
+		old, new []byte
+		typ      string
+	}{
+		{"edited", old, edited, "BSD0"},
+		{"identical", old, old, "BSD0"},
+		{"from empty", nil, unrelated, "COPY"},
+		{"to empty", old, nil, "COPY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := CreatePatch(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("create patch: %v", err)
+			}
+			h, err := ParsePatchHeader(patch)
+			if err != nil {
+				t.Fatalf("parse header: %v", err)
+			}
+			if h.Type != tt.typ {
+				t.Errorf("type = %s, want %s", h.Type, tt.typ)
+			}
+			if tt.typ == "BSD0" && len(patch) > len(tt.new)/10 {
+				t.Errorf("patch is %d bytes for a %d byte file", len(patch), len(tt.new))
+			}
+
+			got, err := ApplyPatch(tt.old, patch)
+			if err != nil {
+				t.Fatalf("apply patch: %v", err)
+			}
+			if !bytes.Equal(got, tt.new) {
+				t.Error("patched data does not match")
+			}
+		})
+	}
+}
+
+func TestAddIncrementalPatch(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_ptch_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	v1 := []byte(strings.Repeat("spell record with some data\n", 1000))
+	v2 := bytes.Replace(v1, []byte("some"), []byte("more"), 3)
+	basePath := filepath.Join(tmpDir, "v1.dbc")
+	srcPath := filepath.Join(tmpDir, "v2.dbc")
+	os.WriteFile(basePath, v1, 0644)
+	os.WriteFile(srcPath, v2, 0644)
+
+	const name = "DBFilesClient\\Spell.dbc"
+	baseMPQ := filepath.Join(tmpDir, "base.mpq")
+	archive, err := Create(baseMPQ, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	archive.AddFile(basePath, name)
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	patchMPQ := filepath.Join(tmpDir, "patch.mpq")
+	archive, err = Create(patchMPQ, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddIncrementalPatch(basePath, srcPath, name); err != nil {
+		t.Fatalf("add patch: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	// The stored block starts with a TPatchInfo and the patch data is
+	// compressed with BZip2
+	archive, err = Open(patchMPQ)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	block, err := archive.findFile(name)
+	if err != nil {
+		t.Fatalf("find file: %v", err)
+	}
+	raw, err := archive.readBlockData(block)
+	if err != nil {
+		t.Fatalf("read block: %v", err)
+	}
+	if _, ok := parsePatchInfo(raw); !ok {
+		t.Error("patch file has no TPatchInfo")
+	}
+	if block.Flags&filePatchFile == 0 {
+		t.Error("patch file is not flagged as FILE_PATCH_FILE")
+	}
+	if raw[patchInfoSize] != compressionBzip2 && block.Flags&fileSingleUnit != 0 {
+		t.Errorf("compression = 0x%02X, want BZip2", raw[patchInfoSize])
+	}
+	patch, err := archive.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read patch: %v", err)
+	}
+	if !IsPatchData(patch) || len(patch) > len(v2)/4 {
+		t.Errorf("stored patch is %d bytes, want a small PTCH file", len(patch))
+	}
+	if report, err := archive.Verify(VerifyOptions{}); err != nil || !report.OK() {
+		t.Errorf("verify patch archive: %v %+v", err, report)
+	}
+	archive.Close()
+
+	// Modifying the archive keeps the patch intact
+	archive, err = OpenForModify(patchMPQ)
+	if err != nil {
+		t.Fatalf("open for modify: %v", err)
+	}
+	archive.AddFileData([]byte("other"), "Other.txt", FileOptions{})
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	chain, err := OpenPatchChain([]string{baseMPQ, patchMPQ})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+	got, err := chain.ReadFile(name)
+	if err != nil {
+		t.Fatalf("read from chain: %v", err)
+	}
+	if !bytes.Equal(got, v2) {
+		t.Error("chain did not return the patched file")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Override describes a file supplied by more than one layer of a chain.
+type Override struct {
+	Path     string   // Path in the chain
+	Winner   string   // Archive whose entry takes priority, "" for a pending change
+	Shadowed []string // Lower-priority archives containing the file, highest priority first
+}
+
+// Resolve returns every entry for mpqPath in the chain, highest priority
+// first: a pending change (with an empty ArchivePath) followed by each
+// archive containing the path. Deletion markers and patch files are included
+// and can be told apart with Flags.DeleteMarker and Flags.PatchFile. The
+// first entry is the one lookups use, unless it is a deletion marker.
+// A path found nowhere returns an empty slice.
+func (p *PatchChain) Resolve(mpqPath string) ([]*FileInfo, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
+
+	var stack []*FileInfo
+	if entry, ok := p.overlayEntry(mpqPath); ok {
+		info := statOverlay(entry)
+		info.Path = mpqPath
+		stack = append(stack, info)
+	}
+
+	for i := len(p.archives) - 1; i >= 0; i-- {
+		if _, err := p.findFile(i, mpqPath); err != nil {
+			continue
+		}
+		info, err := p.archives[i].Stat(p.archivePath(i, mpqPath))
+		if err != nil {
+			return nil, err
+		}
+		info.Path = mpqPath
+		stack = append(stack, info)
+	}
+
+	return stack, nil
+}
+
+// Overrides returns the files found in more than one layer of the chain,
+// sorted by path, with the archive that wins and the archives it shadows.
+// Files are found through each archive's (listfile); use Resolve for the
+// flags and sizes of each entry.
+func (p *PatchChain) Overrides() ([]Override, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	overrides := make(map[string]*Override)
+	var keys []string
+	add := func(name, archivePath string) {
+		key := normalizeMpqPath(name)
+		override, ok := overrides[key]
+		if !ok {
+			overrides[key] = &Override{Path: strings.ReplaceAll(name, "/", "\\"), Winner: archivePath}
+			keys = append(keys, key)
+			return
+		}
+		if override.Winner != archivePath && !slices.Contains(override.Shadowed, archivePath) {
+			override.Shadowed = append(override.Shadowed, archivePath)
+		}
+	}
+
+	// Highest priority first, so the first layer seen is the winner
+	for _, path := range p.pending() {
+		add(path, "")
+	}
+	for i := len(p.archives) - 1; i >= 0; i-- {
+		files, err := p.listArchive(i)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			add(file, p.archives[i].path)
+		}
+	}
+
+	var result []Override
+	for _, key := range keys {
+		if override := overrides[key]; len(override.Shadowed) > 0 {
+			result = append(result, *override)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.ToLower(result[i].Path) < strings.ToLower(result[j].Path)
+	})
+	return result, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatchChainResolve(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_resolve_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	basePath := filepath.Join(tmpDir, "base.mpq")
+	base, err := Create(basePath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	base.AddFileData([]byte("base spells"), "DBFilesClient\\Spell.dbc", FileOptions{})
+	base.AddFileData([]byte("old frame"), "Interface\\frame.xml", FileOptions{})
+	base.AddFileData([]byte("unique"), "Interface\\unique.xml", FileOptions{})
+	if err := base.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	patchPath := filepath.Join(tmpDir, "patch.mpq")
+	patch, err := Create(patchPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	patch.AddFileData([]byte("patched spells"), "DBFilesClient\\Spell.dbc", FileOptions{PatchFile: true})
+	patch.AddDeleteMarker("Interface\\frame.xml")
+	if err := patch.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	chain, err := OpenPatchChain([]string{basePath, patchPath})
+	if err != nil {
+		t.Fatalf("open chain: %v", err)
+	}
+	defer chain.Close()
+	if err := chain.WriteFile("dbfilesclient/spell.dbc", []byte("edited"), FileOptions{}); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	stack, err := chain.Resolve("DBFilesClient\\Spell.dbc")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(stack) != 3 {
+		t.Fatalf("resolved %d entries, want 3", len(stack))
+	}
+	if stack[0].ArchivePath != "" || stack[0].FileSize != 6 {
+		t.Errorf("pending entry = %+v", stack[0])
+	}
+	if stack[1].ArchivePath != patchPath || !stack[1].Flags.PatchFile() || stack[1].FileSize != 14 {
+		t.Errorf("patch entry = %+v", stack[1])
+	}
+	if stack[2].ArchivePath != basePath || stack[2].Flags.PatchFile() || stack[2].FileSize != 11 {
+		t.Errorf("base entry = %+v", stack[2])
+	}
+	for _, info := range stack {
+		if info.Path != "DBFilesClient\\Spell.dbc" {
+			t.Errorf("entry path = %q", info.Path)
+		}
+	}
+
+	stack, err = chain.Resolve("Interface\\frame.xml")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(stack) != 2 || !stack[0].Flags.DeleteMarker() || stack[1].Flags.DeleteMarker() {
+		t.Errorf("deleted file stack = %+v", stack)
+	}
+
+	if stack, err := chain.Resolve("missing.txt"); err != nil || len(stack) != 0 {
+		t.Errorf("missing file resolved to %v, %v", stack, err)
+	}
+
+	overrides, err := chain.Overrides()
+	if err != nil {
+		t.Fatalf("overrides: %v", err)
+	}
+	want := []Override{
+		{Path: "dbfilesclient\\spell.dbc", Winner: "", Shadowed: []string{patchPath, basePath}},
+		{Path: "Interface\\frame.xml", Winner: patchPath, Shadowed: []string{basePath}},
+	}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("Overrides = %+v, want %+v", overrides, want)
+	}
+}
@@ -4,14 +4,49 @@
 package mpq
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
 )
 
+const (
+	signatureVersionWeak   = 0
+	signatureVersionStrong = 1
+
+	// Weak signatures are a 64-byte RSA-512 block after an 8-byte header
+	weakSignatureSize     = 64
+	weakSignatureFileSize = 8 + weakSignatureSize
+
+	// Strong signatures are "NGIS" and a 256-byte RSA-2048 block after the archive
+	strongSignatureMagic = "NGIS"
+	strongSignatureSize  = 256
+)
+
+// BlizzardWeakPublicKey is the well-known RSA-512 public key that Blizzard
+// used to create weak (signature) files.
+var BlizzardWeakPublicKey = &rsa.PublicKey{
+	N: mustParseHexInt("92627704bfb882cc0523b90cb1ac0459272175968d025eda47dd7c49371bf8fa" +
+		"eb0e0a92167557ad51b78ccb68c5426290ee9fb14bc118e430349ea4ed6ad837"),
+	E: 65537,
+}
+
+// md5DigestInfo is the DER prefix of an MD5 DigestInfo used by PKCS #1 v1.5 signatures.
+var md5DigestInfo = []byte{0x30, 0x20, 0x30, 0x0c, 0x06, 0x08, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x02, 0x05, 0x05, 0x00, 0x04, 0x10}
+
 // SignatureInfo contains parsed signature data from (signature) file.
 type SignatureInfo struct {
 	Version   uint32
-	Signature []byte
+	Signature []byte // Signature bytes as stored in the archive (little-endian)
+
+	blockPos    uint64 // Offset of the (signature) block, zeroed when hashing
+	blockSize   uint64 // Size of the (signature) block
+	archiveSize uint64 // Size of the signed archive data
 }
 
 // ReadSignature reads and parses the (signature) special file if present.
@@ -30,12 +65,8 @@ func (a *Archive) ReadSignature() (*SignatureInfo, error) {
 	// Read signature file data
 	blockPos := block.getFilePos64()
 	filePos := blockPos + a.header.ArchiveOffset
-	if _, err := a.file.Seek(int64(filePos), 0); err != nil {
-		return nil, fmt.Errorf("seek to signature data: %w", err)
-	}
-
 	compressedData := make([]byte, block.CompressedSize)
-	if n, err := a.file.Read(compressedData); err != nil || n != int(block.CompressedSize) {
+	if _, err := a.file.ReadAt(compressedData, int64(filePos)); err != nil {
 		return nil, fmt.Errorf("read signature data: %w", err)
 	}
 
@@ -60,6 +91,11 @@ func (a *Archive) ReadSignature() (*SignatureInfo, error) {
 	version := binary.LittleEndian.Uint32(signatureData[0:4])
 	sigLength := binary.LittleEndian.Uint32(signatureData[4:8])
 
+	// Weak signatures leave the header zeroed and store the signature after it
+	if version == signatureVersionWeak && sigLength == 0 && len(signatureData) >= weakSignatureFileSize {
+		sigLength = weakSignatureSize
+	}
+
 	if len(signatureData) < int(8+sigLength) {
 		return nil, fmt.Errorf("signature data truncated: expected %d bytes, got %d", 8+sigLength, len(signatureData))
 	}
@@ -68,16 +104,31 @@ func (a *Archive) ReadSignature() (*SignatureInfo, error) {
 	copy(signature, signatureData[8:8+sigLength])
 
 	return &SignatureInfo{
-		Version:   version,
-		Signature: signature,
+		Version:     version,
+		Signature:   signature,
+		blockPos:    a.header.ArchiveOffset + blockPos - a.signedDataStart(),
+		blockSize:   uint64(block.CompressedSize),
+		archiveSize: a.header.ArchiveOffset + a.archiveDataSize() - a.signedDataStart(),
 	}, nil
 }
 
-// VerifySignature performs basic signature validation.
-// Note: This is a placeholder for full cryptographic verification.
-// In practice, you would verify the signature against the archive data using
-// the appropriate public key and signature algorithm (typically RSA or similar).
+// VerifySignature verifies a weak signature against BlizzardWeakPublicKey.
+// The archiveData is the archive contents starting at its user data header or,
+// if there is none, its MPQ header (for a plain archive, the whole file);
+// bytes past the end of the archive are ignored.
 func (s *SignatureInfo) VerifySignature(archiveData []byte) error {
+	return s.VerifySignatureWithKey(archiveData, BlizzardWeakPublicKey)
+}
+
+// VerifySignatureWithKey verifies a weak signature against the given RSA-512 public key.
+// Weak signatures are RSA signatures over an MD5 of the archive data with the
+// (signature) file zeroed.
+func (s *SignatureInfo) VerifySignatureWithKey(archiveData []byte, key *rsa.PublicKey) error {
+	return s.verify(io.NewSectionReader(bytes.NewReader(archiveData), 0, int64(len(archiveData))), key)
+}
+
+// verify checks a weak signature against the archive data read from r.
+func (s *SignatureInfo) verify(r *io.SectionReader, key *rsa.PublicKey) error {
 	if s == nil {
 		return fmt.Errorf("no signature available")
 	}
@@ -86,29 +137,321 @@ func (s *SignatureInfo) VerifySignature(archiveData []byte) error {
 		return fmt.Errorf("empty signature")
 	}
 
-	// Basic validation - check signature is present and has reasonable size
-	// Real implementation would:
-	// 1. Extract public key (from signature version/type)
-	// 2. Compute hash of archive data (excluding signature itself)
-	// 3. Verify RSA/DSA signature using public key
-	//
-	// This is left as a stub since full crypto verification requires
-	// knowledge of Blizzard's specific signature format and public keys.
-
 	switch s.Version {
-	case 0: // Weak signature (deprecated)
-		if len(s.Signature) < 64 {
-			return fmt.Errorf("weak signature too short: %d bytes", len(s.Signature))
-		}
-	case 1: // Strong signature
-		if len(s.Signature) < 256 {
-			return fmt.Errorf("strong signature too short: %d bytes", len(s.Signature))
+	case signatureVersionWeak:
+		if len(s.Signature) != weakSignatureSize {
+			return fmt.Errorf("weak signature has wrong size: %d bytes", len(s.Signature))
 		}
+	case signatureVersionStrong:
+		return fmt.Errorf("strong signatures are stored after the archive; use ReadStrongSignature")
 	default:
-		return fmt.Errorf("unknown signature version: %d", s.Version)
+		return fmt.Errorf("unsupported signature version: %d", s.Version)
+	}
+
+	archiveSize := s.archiveSize
+	if archiveSize == 0 {
+		archiveSize = uint64(r.Size())
+	}
+	if uint64(r.Size()) < archiveSize {
+		return fmt.Errorf("archive data truncated: expected %d bytes, got %d", archiveSize, r.Size())
+	}
+
+	digest, err := weakSignatureDigest(io.NewSectionReader(r, 0, int64(archiveSize)), s.blockPos, s.blockSize)
+	if err != nil {
+		return err
+	}
+	return verifyPKCS1v15MD5(key, digest, reverseBytes(s.Signature))
+}
+
+// VerifyWeakSignature verifies the archive's (signature) file.
+// If key is nil, BlizzardWeakPublicKey is used.
+func (a *Archive) VerifyWeakSignature(key *rsa.PublicKey) error {
+	if key == nil {
+		key = BlizzardWeakPublicKey
+	}
+
+	sig, err := a.ReadSignature()
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		return fmt.Errorf("archive has no (signature) file")
+	}
+
+	return sig.verify(a.signedData(), key)
+}
+
+// SetWeakSigningKey makes Close sign the archive with a weak signature using
+// the given RSA-512 private key. A (signature) file is reserved while the
+// archive is written and filled in once everything else is in place.
+func (a *Archive) SetWeakSigningKey(key *rsa.PrivateKey) error {
+	if a.mode != "w" && a.mode != "m" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+	if key != nil && key.Size() != weakSignatureSize {
+		return fmt.Errorf("weak signature key must be 512 bits, got %d", key.N.BitLen())
 	}
 
-	// Placeholder: return success for now
-	// Real implementation would return error if signature verification fails
+	a.weakSigningKey = key
 	return nil
 }
+
+// signWeak fills in the reserved (signature) block of a freshly written archive.
+// The archiveStart and archiveSize locate the archive within the file, and
+// signaturePos is the offset of the (signature) block relative to archiveStart.
+func signWeak(file *os.File, key *rsa.PrivateKey, archiveStart, archiveSize, signaturePos uint64) error {
+	digest, err := weakSignatureDigest(io.NewSectionReader(file, int64(archiveStart), int64(archiveSize)), signaturePos, weakSignatureFileSize)
+	if err != nil {
+		return err
+	}
+	signature := rsaPrivate(key, pkcs1v15MD5Block(key.Size(), digest))
+
+	if _, err := file.WriteAt(reverseBytes(signature), int64(archiveStart+signaturePos+8)); err != nil {
+		return fmt.Errorf("write signature: %w", err)
+	}
+	return nil
+}
+
+// StrongSignature is a strong digital signature appended after the archive.
+// It is an RSA-2048 signature over a SHA-1 of the archive data, optionally
+// followed by a tail such as the archive file name.
+type StrongSignature struct {
+	Signature []byte // Signature bytes as stored in the archive (little-endian)
+
+	archiveSize uint64 // Size of the signed archive data
+}
+
+// ReadStrongSignature reads the strong signature that follows the archive data.
+// Returns nil if the archive has no strong signature.
+func (a *Archive) ReadStrongSignature() (*StrongSignature, error) {
+	if a.mode != "r" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	archiveEnd := a.header.ArchiveOffset + a.archiveDataSize()
+	data := make([]byte, len(strongSignatureMagic)+strongSignatureSize)
+	n, err := a.file.ReadAt(data, int64(archiveEnd))
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("read strong signature: %w", err)
+	}
+	if n < len(data) || string(data[:len(strongSignatureMagic)]) != strongSignatureMagic {
+		return nil, nil // Signature is optional
+	}
+
+	return &StrongSignature{
+		Signature:   data[len(strongSignatureMagic):],
+		archiveSize: archiveEnd - a.signedDataStart(),
+	}, nil
+}
+
+// Verify checks the signature against the archive data and tail, succeeding if
+// any of the given RSA-2048 public keys matches. The archiveData is the archive
+// contents starting at its user data header or, if there is none, its MPQ
+// header; bytes past the end of the archive are ignored.
+func (s *StrongSignature) Verify(archiveData, tail []byte, keys ...*rsa.PublicKey) error {
+	return s.verify(io.NewSectionReader(bytes.NewReader(archiveData), 0, int64(len(archiveData))), tail, keys...)
+}
+
+// verify checks the signature against the archive data read from r and tail.
+func (s *StrongSignature) verify(r *io.SectionReader, tail []byte, keys ...*rsa.PublicKey) error {
+	if s == nil {
+		return fmt.Errorf("no signature available")
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no public keys given")
+	}
+
+	archiveSize := s.archiveSize
+	if archiveSize == 0 {
+		archiveSize = uint64(r.Size())
+	}
+	if uint64(r.Size()) < archiveSize {
+		return fmt.Errorf("archive data truncated: expected %d bytes, got %d", archiveSize, r.Size())
+	}
+
+	digest, err := strongSignatureDigest(io.NewSectionReader(r, 0, int64(archiveSize)), tail)
+	if err != nil {
+		return err
+	}
+	expected := strongSignatureBlock(digest)
+	signature := reverseBytes(s.Signature)
+	for _, key := range keys {
+		if key.Size() != strongSignatureSize {
+			continue
+		}
+		if bytes.Equal(rsaPublic(key, signature), expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("signature verification failed")
+}
+
+// VerifyStrongSignature verifies the strong signature that follows the archive.
+// The tail is hashed after the archive data and may be nil.
+func (a *Archive) VerifyStrongSignature(tail []byte, keys ...*rsa.PublicKey) error {
+	sig, err := a.ReadStrongSignature()
+	if err != nil {
+		return err
+	}
+	if sig == nil {
+		return fmt.Errorf("archive has no strong signature")
+	}
+
+	return sig.verify(a.signedData(), tail, keys...)
+}
+
+// SetStrongSigningKey makes Close append a strong signature created with the
+// given RSA-2048 private key. The tail is hashed after the archive data and
+// must be supplied again when verifying.
+func (a *Archive) SetStrongSigningKey(key *rsa.PrivateKey, tail []byte) error {
+	if a.mode != "w" && a.mode != "m" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+	if key != nil && key.Size() != strongSignatureSize {
+		return fmt.Errorf("strong signature key must be 2048 bits, got %d", key.N.BitLen())
+	}
+
+	a.strongSigningKey = key
+	a.strongSignatureTail = append([]byte(nil), tail...)
+	return nil
+}
+
+// signStrong appends a strong signature after a freshly written archive.
+func signStrong(file *os.File, key *rsa.PrivateKey, tail []byte, archiveStart, archiveSize uint64) error {
+	digest, err := strongSignatureDigest(io.NewSectionReader(file, int64(archiveStart), int64(archiveSize)), tail)
+	if err != nil {
+		return err
+	}
+
+	signature := rsaPrivate(key, strongSignatureBlock(digest))
+
+	out := append([]byte(strongSignatureMagic), reverseBytes(signature)...)
+	if _, err := file.WriteAt(out, int64(archiveStart+archiveSize)); err != nil {
+		return fmt.Errorf("write strong signature: %w", err)
+	}
+	return nil
+}
+
+// strongSignatureDigest computes the SHA-1 of the archive data in r followed
+// by the tail.
+func strongSignatureDigest(r *io.SectionReader, tail []byte) ([]byte, error) {
+	h := sha1.New()
+	if _, err := io.CopyN(h, r, r.Size()); err != nil {
+		return nil, fmt.Errorf("read archive data: %w", err)
+	}
+	h.Write(tail)
+	return h.Sum(nil), nil
+}
+
+// strongSignatureBlock builds the big-endian block a strong signature decrypts to:
+// 0x0B, 0xBB padding, then the digest in reversed byte order.
+func strongSignatureBlock(digest []byte) []byte {
+	block := bytes.Repeat([]byte{0xBB}, strongSignatureSize)
+	block[0] = 0x0B
+	copy(block[strongSignatureSize-len(digest):], reverseBytes(digest))
+	return block
+}
+
+// weakSignatureDigest computes the MD5 of the archive data in r with the
+// (signature) block zeroed.
+func weakSignatureDigest(r *io.SectionReader, blockPos, blockSize uint64) ([]byte, error) {
+	size := uint64(r.Size())
+	blockPos = min(blockPos, size)
+	end := min(blockPos+blockSize, size)
+
+	h := md5.New()
+	if _, err := io.CopyN(h, r, int64(blockPos)); err != nil {
+		return nil, fmt.Errorf("read archive data: %w", err)
+	}
+	if _, err := r.Seek(int64(end), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("read archive data: %w", err)
+	}
+	h.Write(make([]byte, end-blockPos))
+	if _, err := io.CopyN(h, r, int64(size-end)); err != nil {
+		return nil, fmt.Errorf("read archive data: %w", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// verifyPKCS1v15MD5 checks a big-endian PKCS #1 v1.5 signature of an MD5 digest.
+// It is implemented directly on math/big because crypto/rsa refuses keys
+// smaller than 1024 bits in recent Go releases.
+func verifyPKCS1v15MD5(key *rsa.PublicKey, digest, signature []byte) error {
+	if len(signature) != key.Size() {
+		return fmt.Errorf("signature size %d does not match key size %d", len(signature), key.Size())
+	}
+	if !bytes.Equal(rsaPublic(key, signature), pkcs1v15MD5Block(key.Size(), digest)) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// pkcs1v15MD5Block builds the padded PKCS #1 v1.5 block for an MD5 digest.
+func pkcs1v15MD5Block(size int, digest []byte) []byte {
+	block := make([]byte, size)
+	block[1] = 0x01
+	tail := size - len(md5DigestInfo) - len(digest)
+	for i := 2; i < tail-1; i++ {
+		block[i] = 0xFF
+	}
+	copy(block[tail:], md5DigestInfo)
+	copy(block[tail+len(md5DigestInfo):], digest)
+	return block
+}
+
+// rsaPublic applies the raw RSA public operation to a big-endian block.
+func rsaPublic(key *rsa.PublicKey, data []byte) []byte {
+	m := new(big.Int).SetBytes(data)
+	m.Exp(m, big.NewInt(int64(key.E)), key.N)
+	return m.FillBytes(make([]byte, key.Size()))
+}
+
+// rsaPrivate applies the raw RSA private operation to a big-endian block.
+func rsaPrivate(key *rsa.PrivateKey, data []byte) []byte {
+	m := new(big.Int).SetBytes(data)
+	m.Exp(m, key.D, key.N)
+	return m.FillBytes(make([]byte, key.Size()))
+}
+
+// reverseBytes returns a reversed copy of b. MPQ signatures store RSA
+// values little-endian.
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, v := range b {
+		out[len(b)-1-i] = v
+	}
+	return out
+}
+
+// archiveDataSize returns the size of the archive measured from its MPQ header
+// to the end of the last table, which is the range covered by signatures.
+func (a *Archive) archiveDataSize() uint64 {
+	end := a.header.getHashTableOffset64() + uint64(a.header.HashTableSize)*16
+	if blockEnd := a.header.getBlockTableOffset64() + uint64(a.header.BlockTableSize)*16; blockEnd > end {
+		end = blockEnd
+	}
+	if a.header.FormatVersion >= formatVersion2 && a.header.HiBlockTableOffset64 != 0 {
+		if hiEnd := a.header.HiBlockTableOffset64 + uint64(a.header.BlockTableSize)*2; hiEnd > end {
+			end = hiEnd
+		}
+	}
+	return end
+}
+
+// signedData returns a reader over the signed part of the archive: from its
+// user data header (or MPQ header if there is none) to the end of the last
+// table.
+func (a *Archive) signedData() *io.SectionReader {
+	start := a.signedDataStart()
+	return io.NewSectionReader(a.file, int64(start), int64(a.header.ArchiveOffset+a.archiveDataSize()-start))
+}
+
+// mustParseHexInt parses a hexadecimal constant.
+func mustParseHexInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("mpq: invalid hex constant")
+	}
+	return n
+}
@@ -0,0 +1,389 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testWeakKey is a fixed RSA-512 key for signing test archives. crypto/rsa
+// refuses to generate keys this small in recent Go releases.
+var testWeakKey = &rsa.PrivateKey{
+	PublicKey: rsa.PublicKey{
+		N: mustParseHexInt("c65abcf07ba5ddc8ff3cfa546670296ef646db090d482471775603bbfd2bcf46" +
+			"ea9bdb626927c9b66adc305aeb19d5b447a51e7f9a760c24a050b57667dfd047"),
+		E: 65537,
+	},
+	D: mustParseHexInt("5a92f88fbf867ffdd63f1bf80a46d144b004aee435426a11bdf27306169738b0" +
+		"54b675aa2013e6995d3110c54c0b1ba86536f1dcdcae57bd9e82ad427ec977f1"),
+}
+
+// weakSignedArchive is an archive holding signed.txt, signed with
+// testWeakKey. Its (signature) block is at 74 and weakSignedArchiveSignature
+// is the signature it stores: an RSA signature of the MD5 of the archive with
+// the block zeroed, PKCS #1 v1.5 padded and stored little-endian.
+var (
+	weakSignedArchive = mustDecodeHex("4d50511a20000000b20100000000030092000000920100001000000004000000" +
+		"7369676e65647369676e65642e7478740d0a6400000001000000c3d8bb1e2543" +
+		"0cda0000000000000000000000000000000054e97463bea42a31801be395d9f8" +
+		"48f2e349b6817ddc8aa6893e7b49b426cbe482bfbe20ae1b37d220ab5a121e55" +
+		"593bf38317f85f2040e0c736fe480aee0c9b3330c37928d93298bc736f9fb288" +
+		"4ee9b9886ea3c619f16e7a4dfcb591c15f9faaee047d1cdd1949c183b264ae57" +
+		"29c18db3285c766065b7d7516eace9a5af652e660114bb87545a3ae5b91ac3c7" +
+		"1c48c4a212547614de015ba6fd3588cdd8bba7e4c6acd0b4c91b71315d9dc378" +
+		"7a74489426fc15791f47d401e3a09d776993de4df508d0221653f57f37ae62da" +
+		"4d3b2e0a471841802bfecdebf10c5d4cb87f262b9b81b3eb267b32c8d855bb09" +
+		"18e7bc2376d26eb4b14c534545db804b140a467b4702bdb8e1a9816a635f90a1" +
+		"5920732fcfcca079db2cbf131f3ee8c627d8bd4e06c91c2c0115d88c3a7e2ecc" +
+		"657f4f14b50978d97d1619eb95ee6b67caecab67483da7d308cadfba35f89572" +
+		"33e90aada2b3c26f9b0e853012c733db03b259e6d84ee76da1a37215d8ecbedf" +
+		"fdff279ec2c49d05c2e6dd655cf97fd2941e")
+	weakSignedArchiveSignature = mustDecodeHex("54e97463bea42a31801be395d9f848f2e349b6817ddc8aa6893e7b49b426cbe4" +
+		"82bfbe20ae1b37d220ab5a121e55593bf38317f85f2040e0c736fe480aee0c9b")
+)
+
+// testStrongKey is a fixed RSA-2048 key for strong signature tests.
+var testStrongKey = &rsa.PrivateKey{
+	PublicKey: rsa.PublicKey{
+		N: mustParseHexInt("9f1af31a2d49c3ab91b0d47d2cf526eafe53c8892bafb2781ba0c6b7889de842" +
+			"d1b93ea707a1dae1f80d093f995aaa62ed442e82ed8421d9cbbc398091f19970" +
+			"a53d003df678d22c40dea89c6a85c928a9739bd65565962b1dfa983d8c3a568d" +
+			"892f01fed29f5fd855f4c8d8b24de9aaa0d21ed1f17196d7be01201a1d1663fe" +
+			"db8874885caafc683535908db1446ea753ec4b7ab5abc5657b981e83497029eb" +
+			"77984a893e7dea34bb15aa3199f624d0914516cda800c62462ad0fff9fb5c9cb" +
+			"4aefb63d5adb480dd42c12d8a34b9446c563bbf84d811a1ae909be9ea9b6f12b" +
+			"b231b7a23837f759583e0341b6513654750e0cb47a457f9c81e3c31dceaca4af"),
+		E: 65537,
+	},
+	D: mustParseHexInt("12ab9c6c6d7512ff8e9ca40abe5c54414e2ff1bfdaff069fde8a1ad78db20dff" +
+		"cd51821f229fa52a502be37271a1f88d9c4f1c7023c4161ed33016c5561af649" +
+		"0832e4d4e097e3fdea6cd677686ea3a0e0659f1b63310512b13567690d8c08fd" +
+		"19e488c4e8dd67e7608ad588cc3fa5546f03c93714b0a22555f816d6c9a4077e" +
+		"c0b176c6e51cc9b9803630dca2f4e72e51126fc96f85a456589d156c27a59c71" +
+		"918cfc67749e2fd6f9d23e5ce74161b725a8b683202b3434dbec93a6d00a0c2f" +
+		"38ceb6fc0bdca769d86fca72fc5000c0e2adff4ae2f5321b4a37b1b23b4f8c27" +
+		"c0c90430d86bba324fd0c3453b295696a3658f537bce1d205d492e5bdf2505f9"),
+}
+
+// strongSignedArchive is an archive holding signed.txt, strongly signed with
+// testStrongKey and the tail "ARCHIVE". The archive data ends at 374, where
+// the "NGIS" header and strongSignedArchiveSignature follow: an RSA signature
+// of a 0x0B, 0xBB... block ending in the SHA-1 of the archive and tail, stored
+// little-endian.
+var (
+	strongSignedArchive = mustDecodeHex("4d50511a20000000560100000000030046000000460100001000000003000000" +
+		"7369676e65647369676e65642e7478740d0a6400000001000000c3d8bb1e2543" +
+		"0cda000000003330c37928d93298bc736f9fb2884ee917a20484c440bfca63bf" +
+		"7b980ce7197e2dabb349ff29a0ab046d0218516976de90f91723d9663d5c9a24" +
+		"47ec0cd1a2a0b1f559ad9e07bf1e7d61746c66cc26d1c73b5dfed9cd7bf51e8c" +
+		"529dab6bca0d2a47ec3cb3679bb0b44065cc667084844b806f0d78e5858197fa" +
+		"1628c0881c0161830a2db308d2f93822702c05c59a802b4d5d0b2461e6aa0ae0" +
+		"7bba38c880dea933c3499604504875fd24c85ee7eaa2bfb5a408d186b2481664" +
+		"6057a3429309fba7fa719864db8c3ea22021edd0bd197614e5a603ffad498245" +
+		"42f50b31b17338fd4fdee1a28d6895311e698b08bec6524c55d7db112598dc2f" +
+		"24a58e442175ab67483da7d308cadfba35f8957233e90aada2b3c26f9b0e8530" +
+		"12c733db03b259e6d84eeb6da1a37215d8ec36dffdff4e4749539cbd2e32b2ec" +
+		"db6691f5204472cb9fd642ded2f2b480217521bec3eaa7417db34a81b6941383" +
+		"a64ff17ab55500915204222d615cbbeca6e8c4355d991a57a0b77260464547bc" +
+		"eaeae1ce2362ef18b7422372b01d7c40d98dd6cf2fb66650a9c8683ae2eda909" +
+		"20775f5acef798b3156863e04dcd76bfe2d1c62c643a12ef04537313218808e7" +
+		"df97421b4249c664b9a17a7f8aed2de0b35e5e3feb21b58bbb9ad7f0cb0eef28" +
+		"61fb927d813880fd75631e67690c8c5d1ff63d8cc4643dd0910ef1a692520baf" +
+		"1b2b8780eba1b9d79de65d8500959d3e19b908678e419ef6b34c9dd9acf2e85f" +
+		"f516306f5f37b43c1aad4f9fc36f99c2c7e0b7cf943c49c8ef69")
+	strongSignedArchiveSignature = mustDecodeHex("9cbd2e32b2ecdb6691f5204472cb9fd642ded2f2b480217521bec3eaa7417db3" +
+		"4a81b6941383a64ff17ab55500915204222d615cbbeca6e8c4355d991a57a0b7" +
+		"7260464547bceaeae1ce2362ef18b7422372b01d7c40d98dd6cf2fb66650a9c8" +
+		"683ae2eda90920775f5acef798b3156863e04dcd76bfe2d1c62c643a12ef0453" +
+		"7313218808e7df97421b4249c664b9a17a7f8aed2de0b35e5e3feb21b58bbb9a" +
+		"d7f0cb0eef2861fb927d813880fd75631e67690c8c5d1ff63d8cc4643dd0910e" +
+		"f1a692520baf1b2b8780eba1b9d79de65d8500959d3e19b908678e419ef6b34c" +
+		"9dd9acf2e85ff516306f5f37b43c1aad4f9fc36f99c2c7e0b7cf943c49c8ef69")
+)
+
+// mustDecodeHex decodes a hexadecimal test vector.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestWeakSignatureRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_sign_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	key := testWeakKey
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Signed content for the weak signature test"), 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	mpqPath := filepath.Join(tmpDir, "signed.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetWeakSigningKey(key); err != nil {
+		t.Fatalf("set signing key: %v", err)
+	}
+	if err := archive.AddFile(testFile, "Data\\Test.txt"); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+
+	sig, err := readArchive.ReadSignature()
+	if err != nil {
+		t.Fatalf("read signature: %v", err)
+	}
+	if sig == nil || sig.Version != 0 || len(sig.Signature) != 64 {
+		t.Fatalf("unexpected signature: %+v", sig)
+	}
+
+	if err := readArchive.VerifyWeakSignature(&key.PublicKey); err != nil {
+		t.Errorf("verify with signing key: %v", err)
+	}
+	if err := readArchive.VerifyWeakSignature(nil); err == nil {
+		t.Errorf("verify with Blizzard key succeeded for our own signature")
+	}
+
+	// Signature data must not break regular integrity checks
+	report, err := readArchive.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify archive: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("signed archive failed verification: %+v", report)
+	}
+
+	block, err := readArchive.findFile("Data\\Test.txt")
+	if err != nil {
+		t.Fatalf("find file: %v", err)
+	}
+	tamperPos := int64(block.getFilePos64())
+	readArchive.Close()
+
+	f, err := os.OpenFile(mpqPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open for tampering: %v", err)
+	}
+	b := make([]byte, 1)
+	f.ReadAt(b, tamperPos)
+	b[0] ^= 0x01
+	f.WriteAt(b, tamperPos)
+	f.Close()
+
+	tampered, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open tampered archive: %v", err)
+	}
+	defer tampered.Close()
+
+	if err := tampered.VerifyWeakSignature(&key.PublicKey); err == nil {
+		t.Errorf("verify succeeded on tampered archive")
+	}
+}
+
+func TestWeakSignatureVector(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_sign_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mpqPath := filepath.Join(tmpDir, "signed.mpq")
+	if err := os.WriteFile(mpqPath, weakSignedArchive, 0644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	archive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer archive.Close()
+
+	sig, err := archive.ReadSignature()
+	if err != nil {
+		t.Fatalf("read signature: %v", err)
+	}
+	if sig == nil || !bytes.Equal(sig.Signature, weakSignedArchiveSignature) {
+		t.Fatalf("signature = %+v, want %x", sig, weakSignedArchiveSignature)
+	}
+	if err := archive.VerifyWeakSignature(&testWeakKey.PublicKey); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	// Signing the archive with its signature cleared gives the same bytes
+	const signaturePos = 74
+	unsigned := append([]byte(nil), weakSignedArchive...)
+	copy(unsigned[signaturePos+8:signaturePos+weakSignatureFileSize], make([]byte, weakSignatureSize))
+	unsignedPath := filepath.Join(tmpDir, "unsigned.mpq")
+	if err := os.WriteFile(unsignedPath, unsigned, 0644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	f, err := os.OpenFile(unsignedPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	if err := signWeak(f, testWeakKey, 0, uint64(len(unsigned)), signaturePos); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signed, err := os.ReadFile(unsignedPath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if !bytes.Equal(signed, weakSignedArchive) {
+		t.Errorf("signature = %x, want %x", signed[signaturePos+8:signaturePos+weakSignatureFileSize], weakSignedArchiveSignature)
+	}
+}
+
+func TestBlizzardWeakPublicKey(t *testing.T) {
+	if BlizzardWeakPublicKey.N.BitLen() != 512 {
+		t.Errorf("Blizzard weak key is %d bits, want 512", BlizzardWeakPublicKey.N.BitLen())
+	}
+	if BlizzardWeakPublicKey.E != 65537 {
+		t.Errorf("Blizzard weak key exponent is %d, want 65537", BlizzardWeakPublicKey.E)
+	}
+}
+
+func TestStrongSignatureRoundTrip(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_strong_sign_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	strongKey := testStrongKey
+	weakKey := testWeakKey
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate other key: %v", err)
+	}
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("Strongly signed content"), 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	tail := []byte("STRONG.MPQ")
+	mpqPath := filepath.Join(tmpDir, "strong.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetWeakSigningKey(weakKey); err != nil {
+		t.Fatalf("set weak signing key: %v", err)
+	}
+	if err := archive.SetStrongSigningKey(strongKey, tail); err != nil {
+		t.Fatalf("set strong signing key: %v", err)
+	}
+	if err := archive.AddFile(testFile, "Data\\Test.txt"); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	sig, err := readArchive.ReadStrongSignature()
+	if err != nil {
+		t.Fatalf("read strong signature: %v", err)
+	}
+	if sig == nil || len(sig.Signature) != 256 {
+		t.Fatalf("unexpected strong signature: %+v", sig)
+	}
+
+	if err := readArchive.VerifyStrongSignature(tail, &otherKey.PublicKey, &strongKey.PublicKey); err != nil {
+		t.Errorf("verify strong signature: %v", err)
+	}
+	if err := readArchive.VerifyStrongSignature(nil, &strongKey.PublicKey); err == nil {
+		t.Errorf("verify succeeded with the wrong tail")
+	}
+	if err := readArchive.VerifyStrongSignature(tail, &otherKey.PublicKey); err == nil {
+		t.Errorf("verify succeeded with the wrong key")
+	}
+
+	// The weak signature is unaffected by the appended strong signature
+	if err := readArchive.VerifyWeakSignature(&weakKey.PublicKey); err != nil {
+		t.Errorf("verify weak signature: %v", err)
+	}
+	if !readArchive.HasFile("Data\\Test.txt") {
+		t.Errorf("file not found in signed archive")
+	}
+}
+
+func TestStrongSignatureVector(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_strong_sign_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tail := []byte("ARCHIVE")
+	mpqPath := filepath.Join(tmpDir, "signed.mpq")
+	if err := os.WriteFile(mpqPath, strongSignedArchive, 0644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	archive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer archive.Close()
+
+	sig, err := archive.ReadStrongSignature()
+	if err != nil {
+		t.Fatalf("read strong signature: %v", err)
+	}
+	if sig == nil || !bytes.Equal(sig.Signature, strongSignedArchiveSignature) {
+		t.Fatalf("strong signature = %+v, want %x", sig, strongSignedArchiveSignature)
+	}
+	if err := archive.VerifyStrongSignature(tail, &testStrongKey.PublicKey); err != nil {
+		t.Errorf("verify strong signature: %v", err)
+	}
+
+	// Signing the archive without its signature gives the same bytes
+	const archiveSize = 374
+	unsignedPath := filepath.Join(tmpDir, "unsigned.mpq")
+	if err := os.WriteFile(unsignedPath, strongSignedArchive[:archiveSize], 0644); err != nil {
+		t.Fatalf("write archive: %v", err)
+	}
+	f, err := os.OpenFile(unsignedPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	if err := signStrong(f, testStrongKey, tail, 0, archiveSize); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signed, err := os.ReadFile(unsignedPath)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if !bytes.Equal(signed, strongSignedArchive) {
+		t.Errorf("strong signature = %x, want %x", signed[archiveSize:], strongSignedArchive[archiveSize:])
+	}
+}
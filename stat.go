@@ -0,0 +1,141 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// FileInfo describes a file stored in an archive. It implements fs.FileInfo,
+// where Size is the uncompressed size and ModTime comes from (attributes).
+type FileInfo struct {
+	Path           string // Path within the archive
+	ArchivePath    string // Path of the archive that supplied the entry
+	BlockIndex     int
+	FileSize       uint32 // Uncompressed size
+	CompressedSize uint32 // Size stored in the archive
+	Flags          FileFlags
+	Locale         uint16
+	Platform       uint16
+
+	// Values from (attributes), if the archive stores them
+	HasCRC32 bool
+	CRC32    uint32
+	HasMD5   bool
+	MD5      [16]byte
+	Time     time.Time // Zero if not stored
+}
+
+// Name returns the base name of the file (the part after the last backslash).
+func (fi *FileInfo) Name() string {
+	return fi.Path[lastIndexOfSlash(fi.Path)+1:]
+}
+
+// Size returns the uncompressed size of the file.
+func (fi *FileInfo) Size() int64 {
+	return int64(fi.FileSize)
+}
+
+// Mode returns read-only permissions; archive entries are never directories.
+func (fi *FileInfo) Mode() fs.FileMode {
+	return 0444
+}
+
+// ModTime returns the file time stored in (attributes), or the zero time.
+func (fi *FileInfo) ModTime() time.Time {
+	return fi.Time
+}
+
+// IsDir always returns false.
+func (fi *FileInfo) IsDir() bool {
+	return false
+}
+
+// Sys returns nil.
+func (fi *FileInfo) Sys() any {
+	return nil
+}
+
+// Stat returns information about a file without extracting it.
+// Deletion markers are reported (with Flags.DeleteMarker set) rather than
+// treated as missing.
+func (a *Archive) Stat(mpqPath string) (*FileInfo, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	attrs, err := a.readAttributes()
+	if err != nil {
+		// Attributes are optional; a damaged file just means no extra values
+		attrs = nil
+	}
+
+	return a.stat(mpqPath, attrs)
+}
+
+// stat builds the FileInfo for mpqPath using already loaded attributes.
+func (a *Archive) stat(mpqPath string, attrs *fileAttributes) (*FileInfo, error) {
+	mpqPath = strings.ReplaceAll(mpqPath, "/", "\\")
+
+	entry, err := a.findHashEntry(mpqPath)
+	if err != nil {
+		return nil, err
+	}
+	block := &a.blockTable[entry.BlockIndex]
+
+	info := &FileInfo{
+		Path:           mpqPath,
+		ArchivePath:    a.path,
+		BlockIndex:     int(entry.BlockIndex),
+		FileSize:       block.FileSize,
+		CompressedSize: block.CompressedSize,
+		Flags:          FileFlags(block.Flags),
+		Locale:         entry.Locale,
+		Platform:       entry.Platform,
+	}
+
+	if attrs != nil {
+		index := int(entry.BlockIndex)
+		if index < len(attrs.crc32) {
+			info.HasCRC32 = true
+			info.CRC32 = attrs.crc32[index]
+		}
+		if index < len(attrs.md5) {
+			info.HasMD5 = true
+			info.MD5 = attrs.md5[index]
+		}
+		if index < len(attrs.fileTime) {
+			info.Time = filetimeToTime(attrs.fileTime[index])
+		}
+	}
+
+	return info, nil
+}
+
+// Stat returns information about the highest-priority version of a file.
+// The ArchivePath of the result identifies the archive that supplied it;
+// Path is the path in the chain, without any archive prefix.
+// Files removed by a deletion marker are reported as not found. Pending
+// writes have an empty ArchivePath and a BlockIndex of -1.
+func (p *PatchChain) Stat(mpqPath string) (*FileInfo, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if entry, ok := p.overlayEntry(mpqPath); ok && !entry.deleted {
+		return statOverlay(entry), nil
+	}
+	archiveIdx, err := p.locateFile(mpqPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := p.archives[archiveIdx].Stat(p.archivePath(archiveIdx, mpqPath))
+	if err != nil {
+		return nil, err
+	}
+	info.Path = strings.ReplaceAll(mpqPath, "/", "\\")
+	return info, nil
+}
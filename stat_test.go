@@ -0,0 +1,141 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_stat_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testContent := make([]byte, 10000)
+	for i := range testContent {
+		testContent[i] = byte(i % 10)
+	}
+	testFile := filepath.Join(tmpDir, "test.bin")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	mpqPath := filepath.Join(tmpDir, "stat.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFileWithCRC(testFile, "Data\\SubDir\\Test.bin"); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.AddDeleteMarker("Data\\Deleted.txt"); err != nil {
+		t.Fatalf("add delete marker: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	info, err := readArchive.Stat("Data/SubDir/Test.bin")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	var _ fs.FileInfo = info
+	if info.Name() != "Test.bin" {
+		t.Errorf("name = %q, want %q", info.Name(), "Test.bin")
+	}
+	if info.Path != "Data\\SubDir\\Test.bin" || info.ArchivePath != mpqPath {
+		t.Errorf("path = %q in %q", info.Path, info.ArchivePath)
+	}
+	if info.Size() != int64(len(testContent)) {
+		t.Errorf("size = %d, want %d", info.Size(), len(testContent))
+	}
+	if info.CompressedSize == 0 || info.CompressedSize >= info.FileSize {
+		t.Errorf("compressed size = %d for %d bytes", info.CompressedSize, info.FileSize)
+	}
+	if !info.Flags.Compressed() || !info.Flags.SectorCRC() || info.Flags.SingleUnit() || info.Flags.Encrypted() {
+		t.Errorf("unexpected flags: %v", info.Flags)
+	}
+	if info.IsDir() || info.Mode() != 0444 {
+		t.Errorf("unexpected mode %v", info.Mode())
+	}
+	if !info.HasCRC32 || info.CRC32 != crc32(testContent) {
+		t.Errorf("attributes CRC32 = 0x%08X (present %v), want 0x%08X", info.CRC32, info.HasCRC32, crc32(testContent))
+	}
+
+	deleted, err := readArchive.Stat("Data\\Deleted.txt")
+	if err != nil {
+		t.Fatalf("stat deletion marker: %v", err)
+	}
+	if !deleted.Flags.DeleteMarker() {
+		t.Errorf("deletion marker flags = %v", deleted.Flags)
+	}
+
+	if _, err := readArchive.Stat("Data\\Missing.txt"); err == nil {
+		t.Errorf("stat of missing file succeeded")
+	}
+}
+
+func TestPatchChainStat(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_chain_stat_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	baseFile := filepath.Join(tmpDir, "base.txt")
+	os.WriteFile(baseFile, []byte("Base content"), 0644)
+	patchFile := filepath.Join(tmpDir, "patch.txt")
+	os.WriteFile(patchFile, []byte("Patched content, longer"), 0644)
+
+	baseMPQ := filepath.Join(tmpDir, "base.mpq")
+	base, _ := Create(baseMPQ, 10)
+	base.AddFile(baseFile, "Data\\File.txt")
+	base.AddFile(baseFile, "Data\\BaseOnly.txt")
+	base.AddFile(baseFile, "Data\\Removed.txt")
+	base.Close()
+
+	patchMPQ := filepath.Join(tmpDir, "patch.mpq")
+	patch, _ := Create(patchMPQ, 10)
+	patch.AddFile(patchFile, "Data\\File.txt")
+	patch.AddDeleteMarker("Data\\Removed.txt")
+	patch.Close()
+
+	chain, err := OpenPatchChain([]string{baseMPQ, patchMPQ})
+	if err != nil {
+		t.Fatalf("open patch chain: %v", err)
+	}
+	defer chain.Close()
+
+	info, err := chain.Stat("Data\\File.txt")
+	if err != nil {
+		t.Fatalf("stat patched file: %v", err)
+	}
+	if info.ArchivePath != patchMPQ || info.Size() != int64(len("Patched content, longer")) {
+		t.Errorf("patched file from %q with size %d", info.ArchivePath, info.Size())
+	}
+
+	info, err = chain.Stat("Data\\BaseOnly.txt")
+	if err != nil {
+		t.Fatalf("stat base file: %v", err)
+	}
+	if info.ArchivePath != baseMPQ {
+		t.Errorf("base file reported from %q", info.ArchivePath)
+	}
+
+	if _, err := chain.Stat("Data\\Removed.txt"); err == nil {
+		t.Errorf("stat of deleted file succeeded")
+	}
+}
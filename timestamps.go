@@ -0,0 +1,74 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// TimestampMode selects the file times written to (attributes).
+type TimestampMode int
+
+const (
+	// TimestampsNone writes no file times. This is the default for new
+	// archives and keeps the output independent of when files were created.
+	TimestampsNone TimestampMode = iota
+
+	// TimestampsSource writes the modification time of each source file.
+	// Files added from memory and the special files get a zero time, and
+	// files kept by OpenForModify keep their stored time. This is the default
+	// when modifying an archive that already stores file times.
+	TimestampsSource
+
+	// TimestampsFixed writes the same time for every file. Pass the zero
+	// time.Time to write zero file times.
+	TimestampsFixed
+)
+
+// SetTimestamps selects the file times written to (attributes) on Close.
+// The fixed time is only used with TimestampsFixed.
+func (a *Archive) SetTimestamps(mode TimestampMode, fixed time.Time) error {
+	if a.mode != "w" && a.mode != "m" && a.mode != "a" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+	if mode < TimestampsNone || mode > TimestampsFixed {
+		return fmt.Errorf("unknown timestamp mode: %d", mode)
+	}
+
+	a.timestamps = mode
+	a.fixedTime = fixed
+	return nil
+}
+
+// fileTimeFor returns the FILETIME to store for a pending file, or for a
+// special file if pf is nil.
+func (a *Archive) fileTimeFor(pf *pendingFile) uint64 {
+	switch a.timestamps {
+	case TimestampsFixed:
+		return timeToFiletime(a.fixedTime)
+	case TimestampsSource:
+		if pf != nil {
+			return pf.fileTime
+		}
+	}
+	return 0
+}
+
+// readSourceFile reads a file to be added to the archive and returns its
+// contents and modification time as a FILETIME.
+func readSourceFile(srcPath string) ([]byte, uint64, error) {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read file %s: %w", srcPath, err)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("stat file %s: %w", srcPath, err)
+	}
+
+	return data, timeToFiletime(info.ModTime()), nil
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeterministicBuild(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_deterministic_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, "src")
+	for i := 0; i < 40; i++ {
+		path := filepath.Join(root, fmt.Sprintf("dir%d", i%4), fmt.Sprintf("file%02d.txt", i))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, bytes.Repeat([]byte(fmt.Sprintf("content %d ", i)), i*50+1), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	fixed := time.Date(2008, 11, 13, 0, 0, 0, 0, time.UTC)
+	build := func(name string, mode TimestampMode) []byte {
+		mpqPath := filepath.Join(tmpDir, name)
+		archive, err := CreateFromDir(mpqPath, root, BuildOptions{Version: FormatV2})
+		if err != nil {
+			t.Fatalf("create from dir: %v", err)
+		}
+		if err := archive.SetTimestamps(mode, fixed); err != nil {
+			t.Fatalf("set timestamps: %v", err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+		data, err := os.ReadFile(mpqPath)
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		return data
+	}
+	touch := func(mtime time.Time) {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				os.Chtimes(path, mtime, mtime)
+			}
+			return err
+		})
+	}
+
+	touch(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	first := build("first.mpq", TimestampsFixed)
+	firstSource := build("first_source.mpq", TimestampsSource)
+
+	touch(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+	second := build("second.mpq", TimestampsFixed)
+	secondSource := build("second_source.mpq", TimestampsSource)
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("builds with fixed timestamps differ")
+	}
+	if bytes.Equal(firstSource, secondSource) {
+		t.Errorf("builds with source timestamps do not reflect file times")
+	}
+
+	readArchive, err := Open(filepath.Join(tmpDir, "first.mpq"))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	info, err := readArchive.Stat("dir1\\file05.txt")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if !info.ModTime().Equal(fixed) {
+		t.Errorf("file time = %v, want %v", info.ModTime(), fixed)
+	}
+
+	sourceArchive, err := Open(filepath.Join(tmpDir, "second_source.mpq"))
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer sourceArchive.Close()
+
+	info, err = sourceArchive.Stat("dir1\\file05.txt")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if want := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("source file time = %v, want %v", info.ModTime(), want)
+	}
+}
+
+func TestDeterministicModify(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_deterministic_modify_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	basePath := filepath.Join(tmpDir, "base.mpq")
+	base, err := Create(basePath, 100)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		base.AddFileData([]byte(fmt.Sprintf("base file %d", i)), fmt.Sprintf("Base\\File%d.txt", i), FileOptions{})
+	}
+	if err := base.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+	baseData, _ := os.ReadFile(basePath)
+
+	modify := func(name string) []byte {
+		mpqPath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(mpqPath, baseData, 0644); err != nil {
+			t.Fatalf("copy archive: %v", err)
+		}
+
+		archive, err := OpenForModify(mpqPath)
+		if err != nil {
+			t.Fatalf("open for modify: %v", err)
+		}
+		for i := 0; i < 30; i++ {
+			archive.AddFileData([]byte(fmt.Sprintf("new file %d", i)), fmt.Sprintf("New\\File%d.txt", i), FileOptions{})
+		}
+		archive.AddFileData([]byte("replaced"), "Base\\File3.txt", FileOptions{})
+		if err := archive.RemoveFile("Base\\File7.txt"); err != nil {
+			t.Fatalf("remove file: %v", err)
+		}
+		if err := archive.Close(); err != nil {
+			t.Fatalf("close archive: %v", err)
+		}
+
+		data, err := os.ReadFile(mpqPath)
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		return data
+	}
+
+	first := modify("first.mpq")
+	for i := 0; i < 3; i++ {
+		if !bytes.Equal(first, modify(fmt.Sprintf("again%d.mpq", i))) {
+			t.Fatalf("modified archives differ")
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"fmt"
+	"io"
+)
+
+// SetUserData places an MPQ\x1B user data header followed by data in front of
+// the archive, as used by StarCraft II maps and replays. Passing nil removes
+// the user data header.
+func (a *Archive) SetUserData(data []byte) error {
+	if a.mode != "w" && a.mode != "m" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	if data != nil {
+		data = append([]byte{}, data...)
+	}
+	a.userData = data
+	a.leadingData = buildLeadingData(a.prefixData, a.userData)
+	return nil
+}
+
+// SetPrefixData places raw data in front of the archive, such as the HM3W
+// header of Warcraft III maps or an executable stub. The archive (or user
+// data header) starts at the next 512-byte boundary after the prefix.
+func (a *Archive) SetPrefixData(data []byte) error {
+	if a.mode != "w" && a.mode != "m" {
+		return fmt.Errorf("archive not opened for writing or modification")
+	}
+
+	a.prefixData = append([]byte(nil), data...)
+	a.leadingData = buildLeadingData(a.prefixData, a.userData)
+	return nil
+}
+
+// UserData returns the contents of the MPQ\x1B user data block.
+// Returns nil if the archive has no user data header.
+func (a *Archive) UserData() ([]byte, error) {
+	if a.mode == "w" || a.mode == "m" {
+		return a.userData, nil
+	}
+
+	_, userData, _, err := readLeadingData(a.file, a.header)
+	return userData, err
+}
+
+// readLeadingData reads everything in front of the archive header. It returns
+// the prefix data before any user data header, the user data contents, and the
+// raw bytes so they can be written back unchanged.
+func readLeadingData(r io.ReaderAt, header *archiveHeader) (prefix, userData, leading []byte, err error) {
+	if header.ArchiveOffset == 0 {
+		return nil, nil, nil, nil
+	}
+
+	leading = make([]byte, header.ArchiveOffset)
+	if _, err := r.ReadAt(leading, 0); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if header.UserData == nil {
+		return leading, nil, leading, nil
+	}
+
+	userDataPos := header.ArchiveOffset - uint64(header.UserData.HeaderOffset)
+	start := userDataPos + 16
+	end := start + uint64(header.UserData.UserDataSize)
+	if end > header.ArchiveOffset {
+		end = header.ArchiveOffset
+	}
+	if start > end {
+		start = end
+	}
+
+	return leading[:userDataPos], leading[start:end], leading, nil
+}
+
+// signedDataStart returns the file offset at which signed data begins: the
+// user data header if there is one, otherwise the archive header.
+func (a *Archive) signedDataStart() uint64 {
+	if a.header.UserData != nil {
+		return a.header.ArchiveOffset - uint64(a.header.UserData.HeaderOffset)
+	}
+	return a.header.ArchiveOffset
+}
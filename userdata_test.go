@@ -0,0 +1,167 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserDataHeader(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_userdata_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	testContent := []byte("File stored behind a user data header")
+	if err := os.WriteFile(testFile, testContent, 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	key := testWeakKey
+
+	userData := []byte("replay header: build 12345")
+	mpqPath := filepath.Join(tmpDir, "replay.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetUserData(userData); err != nil {
+		t.Fatalf("set user data: %v", err)
+	}
+	if err := archive.SetWeakSigningKey(key); err != nil {
+		t.Fatalf("set signing key: %v", err)
+	}
+	if err := archive.AddFile(testFile, "Data\\Test.txt"); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	raw, _ := os.ReadFile(mpqPath)
+	if !bytes.HasPrefix(raw, []byte("MPQ\x1B")) {
+		t.Fatalf("archive does not start with a user data header")
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+
+	if readArchive.header.ArchiveOffset != headerAlignment {
+		t.Errorf("archive offset = 0x%X, want 0x%X", readArchive.header.ArchiveOffset, headerAlignment)
+	}
+	got, err := readArchive.UserData()
+	if err != nil {
+		t.Fatalf("read user data: %v", err)
+	}
+	if !bytes.Equal(got, userData) {
+		t.Errorf("user data = %q, want %q", got, userData)
+	}
+
+	extractPath := filepath.Join(tmpDir, "extracted.txt")
+	if err := readArchive.ExtractFile("Data\\Test.txt", extractPath); err != nil {
+		t.Fatalf("extract file: %v", err)
+	}
+	extracted, _ := os.ReadFile(extractPath)
+	if !bytes.Equal(extracted, testContent) {
+		t.Errorf("content mismatch: got %q, want %q", extracted, testContent)
+	}
+
+	if err := readArchive.VerifyWeakSignature(&key.PublicKey); err != nil {
+		t.Errorf("verify signature with user data: %v", err)
+	}
+	readArchive.Close()
+
+	// User data survives modification
+	modArchive, err := OpenForModify(mpqPath)
+	if err != nil {
+		t.Fatalf("open for modify: %v", err)
+	}
+	if err := modArchive.AddFile(testFile, "Data\\Second.txt"); err != nil {
+		t.Fatalf("add second file: %v", err)
+	}
+	if err := modArchive.Close(); err != nil {
+		t.Fatalf("close modified archive: %v", err)
+	}
+
+	readArchive, err = Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open modified archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	got, err = readArchive.UserData()
+	if err != nil {
+		t.Fatalf("read user data after modify: %v", err)
+	}
+	if !bytes.Equal(got, userData) {
+		t.Errorf("user data after modify = %q, want %q", got, userData)
+	}
+	if !readArchive.HasFile("Data\\Test.txt") || !readArchive.HasFile("Data\\Second.txt") {
+		t.Errorf("files missing after modifying archive with user data")
+	}
+}
+
+func TestPrefixData(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_prefix_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testFile := filepath.Join(tmpDir, "war3map.j")
+	if err := os.WriteFile(testFile, []byte("function main takes nothing returns nothing"), 0644); err != nil {
+		t.Fatalf("write test file: %v", err)
+	}
+
+	// Warcraft III maps start with a 512-byte HM3W header
+	prefix := make([]byte, 512)
+	copy(prefix, "HM3W")
+
+	mpqPath := filepath.Join(tmpDir, "map.w3x")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.SetPrefixData(prefix); err != nil {
+		t.Fatalf("set prefix data: %v", err)
+	}
+	if err := archive.AddFile(testFile, "war3map.j"); err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	raw, _ := os.ReadFile(mpqPath)
+	if !bytes.Equal(raw[:512], prefix) || !bytes.HasPrefix(raw[512:], []byte("MPQ\x1A")) {
+		t.Fatalf("unexpected layout: prefix not followed by MPQ header at 0x200")
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	if !readArchive.HasFile("war3map.j") {
+		t.Errorf("file not found in prefixed archive")
+	}
+	if userData, _ := readArchive.UserData(); userData != nil {
+		t.Errorf("unexpected user data: %q", userData)
+	}
+	report, err := readArchive.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("prefixed archive failed verification: %+v", report)
+	}
+}
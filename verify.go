@@ -0,0 +1,219 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"crypto/md5"
+	"fmt"
+	"sort"
+)
+
+// VerifyOptions controls the checks performed by Archive.Verify.
+type VerifyOptions struct {
+	// SkipDecompression limits verification to structural checks (table and
+	// block bounds, overlaps, hash table consistency) without reading file data.
+	SkipDecompression bool
+
+	// SkipAttributes disables comparing file contents against the CRC32 and
+	// MD5 values stored in (attributes).
+	SkipAttributes bool
+}
+
+// FileVerifyResult is the verification outcome for a single block.
+type FileVerifyResult struct {
+	Name       string   // Path within the archive, empty if not listed in (listfile)
+	BlockIndex int      // Index into the block table
+	Checked    bool     // Whether the file data was decoded and checked
+	Errors     []string // Problems found, empty if the file is valid
+}
+
+// OK reports whether no problems were found for the file.
+func (r *FileVerifyResult) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// VerifyReport is the result of Archive.Verify.
+type VerifyReport struct {
+	Files    []FileVerifyResult // One entry per used block, in block table order
+	Problems []string           // Archive-level problems (tables, orphaned hash entries)
+}
+
+// OK reports whether the archive and all of its files passed verification.
+func (r *VerifyReport) OK() bool {
+	if len(r.Problems) > 0 {
+		return false
+	}
+	for i := range r.Files {
+		if !r.Files[i].OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Verify checks the integrity of the archive without extracting anything to disk.
+// It validates table and block bounds against the archive size, looks for
+// overlapping blocks and orphaned hash entries, and (unless disabled) decodes
+// every block, checking sector CRCs and the CRC32/MD5 values from (attributes).
+// Encrypted files can only be decoded if their name is known from (listfile).
+func (a *Archive) Verify(opts VerifyOptions) (*VerifyReport, error) {
+	if a.mode != "r" && a.mode != "m" && a.mode != "a" {
+		return nil, fmt.Errorf("archive not opened for reading")
+	}
+
+	stat, err := a.file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat archive: %w", err)
+	}
+	archiveEnd := uint64(stat.Size()) - a.header.ArchiveOffset
+
+	report := &VerifyReport{}
+
+	// Table bounds
+	hashTableEnd := a.header.getHashTableOffset64() + uint64(a.header.HashTableSize)*16
+	if hashTableEnd > archiveEnd {
+		report.Problems = append(report.Problems, fmt.Sprintf("hash table ends at 0x%X, past end of archive 0x%X", hashTableEnd, archiveEnd))
+	}
+	blockTableEnd := a.header.getBlockTableOffset64() + uint64(a.header.BlockTableSize)*16
+	if blockTableEnd > archiveEnd {
+		report.Problems = append(report.Problems, fmt.Sprintf("block table ends at 0x%X, past end of archive 0x%X", blockTableEnd, archiveEnd))
+	}
+
+	// Hash table consistency
+	referenced := make([]bool, len(a.blockTable))
+	for i, entry := range a.hashTable {
+		if entry.BlockIndex == hashTableEmpty || entry.BlockIndex == hashTableDeleted {
+			continue
+		}
+		if entry.BlockIndex >= uint32(len(a.blockTable)) {
+			report.Problems = append(report.Problems, fmt.Sprintf("hash entry %d points past block table: block %d of %d", i, entry.BlockIndex, len(a.blockTable)))
+			continue
+		}
+		if a.blockTable[entry.BlockIndex].Flags&fileExists == 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("hash entry %d references unused block %d", i, entry.BlockIndex))
+			continue
+		}
+		referenced[entry.BlockIndex] = true
+	}
+
+	names := a.blockNames()
+
+	var attrs *fileAttributes
+	if !opts.SkipDecompression && !opts.SkipAttributes {
+		attrs, err = a.readAttributes()
+		if err != nil {
+			report.Problems = append(report.Problems, err.Error())
+		}
+	}
+
+	resultIndex := make(map[int]int)
+	for i := range a.blockTable {
+		block := &a.blockTable[i]
+		if block.Flags&fileExists == 0 {
+			continue
+		}
+
+		result := FileVerifyResult{Name: names[i], BlockIndex: i}
+		if !referenced[i] {
+			result.Errors = append(result.Errors, "block not referenced by any hash table entry")
+		}
+
+		blockEnd := block.getFilePos64() + uint64(block.CompressedSize)
+		inBounds := blockEnd <= archiveEnd
+		if !inBounds {
+			result.Errors = append(result.Errors, fmt.Sprintf("block data ends at 0x%X, past end of archive 0x%X", blockEnd, archiveEnd))
+		}
+
+		if inBounds && !opts.SkipDecompression && block.Flags&fileDeleteMarker == 0 {
+			a.verifyBlockData(&result, block, attrs)
+		}
+
+		resultIndex[i] = len(report.Files)
+		report.Files = append(report.Files, result)
+	}
+
+	// Overlapping blocks
+	spans := make([]int, 0, len(report.Files))
+	for _, result := range report.Files {
+		if a.blockTable[result.BlockIndex].CompressedSize > 0 {
+			spans = append(spans, result.BlockIndex)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return a.blockTable[spans[i]].getFilePos64() < a.blockTable[spans[j]].getFilePos64()
+	})
+	// Compare each block with the one reaching furthest so far, so a block
+	// spanning several others is caught against each of them
+	furthest, furthestEnd := -1, uint64(0)
+	for _, index := range spans {
+		block := &a.blockTable[index]
+		if furthest >= 0 && furthestEnd > block.getFilePos64() {
+			result := &report.Files[resultIndex[index]]
+			result.Errors = append(result.Errors, fmt.Sprintf("block overlaps block %d", furthest))
+		}
+		if end := block.getFilePos64() + uint64(block.CompressedSize); furthest < 0 || end > furthestEnd {
+			furthest, furthestEnd = index, end
+		}
+	}
+
+	return report, nil
+}
+
+// verifyBlockData decodes a block and checks it against its declared size and attributes.
+func (a *Archive) verifyBlockData(result *FileVerifyResult, block *blockTableEntryEx, attrs *fileAttributes) {
+	if block.Flags&fileEncrypted != 0 && result.Name == "" {
+		// The decryption key is derived from the file name
+		return
+	}
+
+	raw, err := a.readBlockData(block)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	data, err := a.decodeBlock(result.Name, block, raw)
+	result.Checked = true
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	if uint32(len(data)) != block.FileSize {
+		result.Errors = append(result.Errors, fmt.Sprintf("decoded size %d does not match file size %d", len(data), block.FileSize))
+	}
+
+	if attrs == nil || result.Name == "(attributes)" {
+		return
+	}
+	if result.BlockIndex < len(attrs.crc32) && attrs.crc32[result.BlockIndex] != 0 {
+		if actual := crc32(data); actual != attrs.crc32[result.BlockIndex] {
+			result.Errors = append(result.Errors, fmt.Sprintf("attributes CRC32 mismatch: expected 0x%08X got 0x%08X", attrs.crc32[result.BlockIndex], actual))
+		}
+	}
+	if result.BlockIndex < len(attrs.md5) && attrs.md5[result.BlockIndex] != ([16]byte{}) {
+		if actual := md5.Sum(data); actual != attrs.md5[result.BlockIndex] {
+			result.Errors = append(result.Errors, fmt.Sprintf("attributes MD5 mismatch: expected %x got %x", attrs.md5[result.BlockIndex], actual))
+		}
+	}
+}
+
+// blockNames maps block indices to file names using (listfile) and the
+// well-known special files. Blocks whose name is unknown are absent.
+func (a *Archive) blockNames() map[int]string {
+	candidates := []string{"(listfile)", "(attributes)", "(signature)", "(patch_metadata)"}
+	if files, err := a.ListFiles(); err == nil {
+		candidates = append(candidates, files...)
+	}
+
+	names := make(map[int]string)
+	for _, name := range candidates {
+		if index, err := a.findBlockIndex(name); err == nil {
+			if _, exists := names[int(index)]; !exists {
+				names[int(index)] = name
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_verify_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	smallFile := filepath.Join(tmpDir, "small.txt")
+	if err := os.WriteFile(smallFile, []byte("small file content"), 0644); err != nil {
+		t.Fatalf("write small file: %v", err)
+	}
+
+	// Large enough to be stored in sectors
+	largeContent := make([]byte, 20000)
+	for i := range largeContent {
+		largeContent[i] = byte(i * 7)
+	}
+	largeFile := filepath.Join(tmpDir, "large.bin")
+	if err := os.WriteFile(largeFile, largeContent, 0644); err != nil {
+		t.Fatalf("write large file: %v", err)
+	}
+
+	mpqPath := filepath.Join(tmpDir, "verify.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	if err := archive.AddFile(smallFile, "Data\\Small.txt"); err != nil {
+		t.Fatalf("add small file: %v", err)
+	}
+	if err := archive.AddFileWithCRC(largeFile, "Data\\Large.bin"); err != nil {
+		t.Fatalf("add large file: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	report, err := readArchive.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		t.Fatalf("verify reported problems on a valid archive: %+v", report)
+	}
+	if len(report.Files) != 4 {
+		t.Errorf("got %d file results, want 4", len(report.Files))
+	}
+	for _, result := range report.Files {
+		if !result.Checked {
+			t.Errorf("file %q was not checked", result.Name)
+		}
+	}
+
+	// Corrupt a byte in the middle of the sectored file's data
+	block, err := readArchive.findFile("Data\\Large.bin")
+	if err != nil {
+		t.Fatalf("find large file: %v", err)
+	}
+	corruptPos := int64(block.getFilePos64() + uint64(block.CompressedSize)/2)
+	readArchive.Close()
+
+	f, err := os.OpenFile(mpqPath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open for corruption: %v", err)
+	}
+	b := make([]byte, 1)
+	f.ReadAt(b, corruptPos)
+	b[0] ^= 0xFF
+	f.WriteAt(b, corruptPos)
+	f.Close()
+
+	corrupted, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open corrupted archive: %v", err)
+	}
+	defer corrupted.Close()
+
+	report, err = corrupted.Verify(VerifyOptions{})
+	if err != nil {
+		t.Fatalf("verify corrupted: %v", err)
+	}
+	if report.OK() {
+		t.Fatalf("verify did not detect corruption")
+	}
+	for _, result := range report.Files {
+		if result.Name == "Data\\Large.bin" && result.OK() {
+			t.Errorf("corrupted file reported as valid")
+		}
+		if result.Name == "Data\\Small.txt" && !result.OK() {
+			t.Errorf("intact file reported as invalid: %v", result.Errors)
+		}
+	}
+
+	// Structural checks alone do not read file data
+	report, err = corrupted.Verify(VerifyOptions{SkipDecompression: true})
+	if err != nil {
+		t.Fatalf("structural verify: %v", err)
+	}
+	if !report.OK() {
+		t.Errorf("structural verify reported problems: %+v", report)
+	}
+}
+
+func TestVerifySpanningBlock(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_verify_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mpqPath := filepath.Join(tmpDir, "verify.mpq")
+	archive, err := Create(mpqPath, 10)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	names := []string{"Data\\A.txt", "Data\\B.txt", "Data\\C.txt"}
+	for _, name := range names {
+		if err := archive.AddFileData([]byte("content of "+name), name, FileOptions{}); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	// Stretch the first block over the other two
+	blocks := make([]*blockTableEntryEx, len(names))
+	for i, name := range names {
+		if blocks[i], err = readArchive.findFile(name); err != nil {
+			t.Fatalf("find %s: %v", name, err)
+		}
+	}
+	if blocks[0].getFilePos64() >= blocks[1].getFilePos64() || blocks[1].getFilePos64() >= blocks[2].getFilePos64() {
+		t.Fatalf("blocks are not stored in the order they were added")
+	}
+	blocks[0].CompressedSize = uint32(blocks[2].getFilePos64() + uint64(blocks[2].CompressedSize) - blocks[0].getFilePos64())
+
+	report, err := readArchive.Verify(VerifyOptions{SkipDecompression: true})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	overlapping := 0
+	for _, result := range report.Files {
+		if result.Name == names[1] || result.Name == names[2] {
+			if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0], "block overlaps block ") {
+				t.Errorf("%s: errors = %v, want one overlap", result.Name, result.Errors)
+			}
+			overlapping++
+		} else if !result.OK() {
+			t.Errorf("%s: unexpected errors %v", result.Name, result.Errors)
+		}
+	}
+	if overlapping != 2 {
+		t.Errorf("got %d overlapping blocks, want 2", overlapping)
+	}
+}
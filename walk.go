@@ -0,0 +1,189 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"sort"
+	"strings"
+)
+
+// Glob returns the files in the archive whose paths match pattern, sorted.
+//
+// Patterns are case-insensitive and accept / or \ as separators. Within a
+// path element, * matches any sequence of characters and ? any single
+// character (see path.Match); * and ? never match a separator. An element of
+// ** matches any number of directories, so "DBFilesClient\*.dbc" matches the
+// top-level tables and "Interface\**\*.xml" matches XML files at any depth.
+// Deletion markers are not returned. File names come from (listfile).
+func (a *Archive) Glob(pattern string) ([]string, error) {
+	if err := validateGlob(pattern); err != nil {
+		return nil, err
+	}
+
+	files, err := a.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return globNames(files, pattern, a.HasFile), nil
+}
+
+// Glob returns the files in the chain whose paths match pattern, sorted.
+// Files removed by a deletion marker are not returned. See Archive.Glob for
+// the pattern syntax.
+func (p *PatchChain) Glob(pattern string) ([]string, error) {
+	if err := validateGlob(pattern); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	files, err := p.listFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return globNames(files, pattern, p.hasFile), nil
+}
+
+// globNames filters names by pattern and existence, removing duplicates
+// (listfiles may repeat a name once per locale).
+func globNames(files []string, pattern string, exists func(string) bool) []string {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, name := range files {
+		key := normalizeMpqPath(name)
+		if seen[key] || !matchArchivePath(pattern, name) || !exists(name) {
+			continue
+		}
+		seen[key] = true
+		matches = append(matches, strings.ReplaceAll(name, "/", "\\"))
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// Walk returns an iterator over the entries matching pattern, in sorted
+// order, with their metadata. An empty pattern matches every file. Deletion
+// markers are included and can be recognized by Flags.DeleteMarker.
+//
+// The iterator is called with a function that receives each entry and
+// returns false to stop:
+//
+//	archive.Walk("DBFilesClient\\*.dbc")(func(info *FileInfo, err error) bool {
+//		if err != nil {
+//			log.Print(err)
+//			return false
+//		}
+//		fmt.Println(info.Path, info.Size())
+//		return true
+//	})
+//
+// It has the signature of iter.Seq2[*FileInfo, error], so code built with
+// Go 1.23 or later can also range over it. An error ends the iteration.
+func (a *Archive) Walk(pattern string) func(yield func(*FileInfo, error) bool) {
+	return func(yield func(*FileInfo, error) bool) {
+		names, err := a.walkNames(pattern)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		attrs, err := a.readAttributes()
+		if err != nil {
+			attrs = nil
+		}
+
+		for _, name := range names {
+			info, err := a.stat(name, attrs)
+			if err != nil {
+				continue // Listed in (listfile) but not present
+			}
+			if !yield(info, nil) {
+				return
+			}
+		}
+	}
+}
+
+// walkNames returns the sorted, unique names matching pattern, including
+// deletion markers.
+func (a *Archive) walkNames(pattern string) ([]string, error) {
+	if pattern == "" {
+		pattern = "**"
+	}
+	if err := validateGlob(pattern); err != nil {
+		return nil, err
+	}
+
+	files, err := a.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+	return globNames(files, pattern, func(string) bool { return true }), nil
+}
+
+// Walk returns an iterator over the files in the chain matching pattern, in
+// sorted order. Each entry describes the highest-priority version of the file
+// and its ArchivePath identifies the archive that supplied it; files removed
+// by a deletion marker are skipped. See Archive.Walk for usage.
+func (p *PatchChain) Walk(pattern string) func(yield func(*FileInfo, error) bool) {
+	return func(yield func(*FileInfo, error) bool) {
+		if pattern == "" {
+			pattern = "**"
+		}
+		names, err := p.Glob(pattern)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// Attributes are loaded once per archive as they are needed
+		attrs := make(map[*Archive]*fileAttributes)
+		for _, name := range names {
+			info := p.walkStat(name, attrs)
+			if info == nil {
+				continue
+			}
+			if !yield(info, nil) {
+				return
+			}
+		}
+	}
+}
+
+// walkStat returns the entry Walk yields for name, or nil if the file is
+// gone. The lock is only held while the entry is looked up, so the caller of
+// Walk can use the chain between entries.
+func (p *PatchChain) walkStat(name string, attrs map[*Archive]*fileAttributes) *FileInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if entry, ok := p.overlayEntry(name); ok && !entry.deleted {
+		return statOverlay(entry)
+	}
+
+	archiveIdx, err := p.locateFile(name)
+	if err != nil {
+		return nil
+	}
+	archive := p.archives[archiveIdx]
+
+	archiveAttrs, loaded := attrs[archive]
+	if !loaded {
+		archiveAttrs, err = archive.readAttributes()
+		if err != nil {
+			archiveAttrs = nil
+		}
+		attrs[archive] = archiveAttrs
+	}
+
+	info, err := archive.stat(p.archivePath(archiveIdx, name), archiveAttrs)
+	if err != nil {
+		return nil
+	}
+	info.Path = name
+	return info
+}
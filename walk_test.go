@@ -0,0 +1,150 @@
+// Copyright (c) 2025 suprsokr
+// SPDX-License-Identifier: MIT
+
+package mpq
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_glob_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	mpqPath := filepath.Join(tmpDir, "glob.mpq")
+	archive, err := Create(mpqPath, 20)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	for _, name := range []string{
+		"DBFilesClient\\Spell.dbc",
+		"DBFilesClient\\Item.dbc",
+		"DBFilesClient\\Cache\\Old.dbc",
+		"Interface\\FrameXML\\UI.xml",
+		"Interface\\AddOns\\Test\\Test.xml",
+		"Interface\\AddOns\\Test\\Test.lua",
+	} {
+		if err := archive.AddFileData([]byte(name), name, FileOptions{}); err != nil {
+			t.Fatalf("add %s: %v", name, err)
+		}
+	}
+	archive.AddDeleteMarker("DBFilesClient\\Removed.dbc")
+	if err := archive.Close(); err != nil {
+		t.Fatalf("close archive: %v", err)
+	}
+
+	readArchive, err := Open(mpqPath)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer readArchive.Close()
+
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"DBFilesClient\\*.dbc", "DBFilesClient\\Item.dbc,DBFilesClient\\Spell.dbc"},
+		{"dbfilesclient/*.DBC", "DBFilesClient\\Item.dbc,DBFilesClient\\Spell.dbc"},
+		{"DBFilesClient\\**\\*.dbc", "DBFilesClient\\Cache\\Old.dbc,DBFilesClient\\Item.dbc,DBFilesClient\\Spell.dbc"},
+		{"Interface\\**\\*.xml", "Interface\\AddOns\\Test\\Test.xml,Interface\\FrameXML\\UI.xml"},
+		{"Interface\\AddOns\\Test\\Test.???", "Interface\\AddOns\\Test\\Test.lua,Interface\\AddOns\\Test\\Test.xml"},
+		{"*.dbc", ""},
+	}
+	for _, test := range tests {
+		got, err := readArchive.Glob(test.pattern)
+		if err != nil {
+			t.Fatalf("glob %q: %v", test.pattern, err)
+		}
+		if strings.Join(got, ",") != test.want {
+			t.Errorf("Glob(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+
+	if _, err := readArchive.Glob("DBFilesClient\\[.dbc"); err == nil {
+		t.Errorf("malformed pattern accepted")
+	}
+
+	var walked []string
+	var deleted []string
+	readArchive.Walk("DBFilesClient\\*")(func(info *FileInfo, err error) bool {
+		if err != nil {
+			t.Fatalf("walk: %v", err)
+		}
+		if info.Flags.DeleteMarker() {
+			deleted = append(deleted, info.Path)
+		} else {
+			walked = append(walked, info.Path)
+		}
+		return true
+	})
+	if strings.Join(walked, ",") != "DBFilesClient\\Item.dbc,DBFilesClient\\Spell.dbc" {
+		t.Errorf("walk = %q", walked)
+	}
+	if strings.Join(deleted, ",") != "DBFilesClient\\Removed.dbc" {
+		t.Errorf("walk deletion markers = %q", deleted)
+	}
+
+	count := 0
+	readArchive.Walk("")(func(info *FileInfo, err error) bool {
+		count++
+		return count < 2
+	})
+	if count != 2 {
+		t.Errorf("walk did not stop when yield returned false: %d entries", count)
+	}
+}
+
+func TestPatchChainGlob(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "mpq_chain_glob_test_")
+	if err != nil {
+		t.Fatalf("create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	baseMPQ := filepath.Join(tmpDir, "base.mpq")
+	base, _ := Create(baseMPQ, 10)
+	base.AddFileData([]byte("base spell"), "DBFilesClient\\Spell.dbc", FileOptions{})
+	base.AddFileData([]byte("base item"), "DBFilesClient\\Item.dbc", FileOptions{})
+	base.AddFileData([]byte("base map"), "DBFilesClient\\Map.dbc", FileOptions{})
+	base.Close()
+
+	patchMPQ := filepath.Join(tmpDir, "patch.mpq")
+	patch, _ := Create(patchMPQ, 10)
+	patch.AddFileData([]byte("patched spell"), "DBFilesClient\\Spell.dbc", FileOptions{})
+	patch.AddFileData([]byte("new talent"), "DBFilesClient\\Talent.dbc", FileOptions{})
+	patch.AddDeleteMarker("DBFilesClient\\Map.dbc")
+	patch.Close()
+
+	chain, err := OpenPatchChain([]string{baseMPQ, patchMPQ})
+	if err != nil {
+		t.Fatalf("open patch chain: %v", err)
+	}
+	defer chain.Close()
+
+	files, err := chain.Glob("dbfilesclient\\*.dbc")
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	want := "DBFilesClient\\Item.dbc,DBFilesClient\\Spell.dbc,DBFilesClient\\Talent.dbc"
+	if strings.Join(files, ",") != want {
+		t.Errorf("glob = %q, want %q", files, want)
+	}
+
+	sources := make(map[string]string)
+	chain.Walk("DBFilesClient\\*.dbc")(func(info *FileInfo, err error) bool {
+		if err != nil {
+			t.Fatalf("walk: %v", err)
+		}
+		sources[info.Path] = info.ArchivePath
+		return true
+	})
+	if len(sources) != 3 || sources["DBFilesClient\\Spell.dbc"] != patchMPQ || sources["DBFilesClient\\Item.dbc"] != baseMPQ {
+		t.Errorf("walk sources = %v", sources)
+	}
+}
@@ -4,7 +4,10 @@
 package mpq
 
 import (
+	"crypto/md5"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -27,9 +30,15 @@ func (a *Archive) writeArchive() error {
 		}
 	}
 
+	// Write anything that precedes the archive (prefix data, user data header)
+	if _, err := file.Write(a.leadingData); err != nil {
+		return fmt.Errorf("write user data: %w", err)
+	}
+	archiveStart := int64(len(a.leadingData))
+
 	// Reserve space for header
 	headerSize := a.header.HeaderSize
-	if _, err := file.Seek(int64(headerSize), 0); err != nil {
+	if _, err := file.Seek(archiveStart+int64(headerSize), io.SeekStart); err != nil {
 		return fmt.Errorf("seek past header: %w", err)
 	}
 
@@ -43,19 +52,33 @@ func (a *Archive) writeArchive() error {
 	// Calculate total block count including special files
 	// We'll add: (listfile) and (attributes) if they exist
 	totalBlockCount := actualFileCount
+	if a.patchMetadata != nil {
+		totalBlockCount++ // (patch_metadata)
+	}
 	if actualFileCount > 0 {
 		totalBlockCount++ // (listfile)
 		totalBlockCount++ // (attributes)
+	} else if a.patchMetadata != nil || a.weakSigningKey != nil {
+		totalBlockCount++ // (attributes)
+	}
+	if a.weakSigningKey != nil {
+		totalBlockCount++ // (signature)
 	}
 
 	a.blockTable = make([]blockTableEntryEx, 0, totalBlockCount)
 	listFileContent := ""
 	// Attributes file must include entries for ALL files in block table
 	attributes := newAttributesWriter(totalBlockCount)
+	if a.timestamps != TimestampsNone {
+		attributes.enableFileTime()
+		for i := 0; i < totalBlockCount; i++ {
+			attributes.setFileTime(i, a.fileTimeFor(nil))
+		}
+	}
 	needsHiBlockTable := false
 
 	for i, pf := range a.pendingFiles {
-		filePos, err := file.Seek(0, 1)
+		filePos, err := archivePos(file, archiveStart)
 		if err != nil {
 			return fmt.Errorf("get file position: %w", err)
 		}
@@ -84,65 +107,29 @@ func (a *Archive) writeArchive() error {
 			}
 			a.blockTable = append(a.blockTable, blockEntry)
 
-			if err := a.addToHashTable(pf.mpqPath, uint32(len(a.blockTable)-1)); err != nil {
+			if err := a.addToHashTable(pf.mpqPath, pf.locale, uint32(len(a.blockTable)-1)); err != nil {
 				return fmt.Errorf("add to hash table: %w", err)
 			}
 			listFileContent += pf.mpqPath + "\r\n"
 			continue
 		}
 
-		// Determine if we should use sectors or single-unit
-		useSectors := len(pf.data) > int(a.sectorSize)*2 // Use sectors for larger files
-		useSectorCRC := pf.generateCRC
-
-		if useSectors {
-			// Sector-based file with optional CRC
-			dataToWrite, compressedSize, err = a.writeSectoredFile(pf.data, useSectorCRC)
-			if err != nil {
-				return fmt.Errorf("write sectored file %s: %w", pf.mpqPath, err)
-			}
-			flags |= fileCompress
-			if useSectorCRC {
-				flags |= fileSectorCRC
+		fileSize := uint32(len(pf.data))
+		if pf.raw != nil {
+			flags, fileSize, compressedSize = pf.raw.flags, pf.raw.fileSize, pf.raw.size
+			if err := a.writeRaw(file, pf.mpqPath, pf.raw, uint64(filePos)); err != nil {
+				return fmt.Errorf("copy %s: %w", pf.mpqPath, err)
 			}
 		} else {
-			// Single-unit file
-			compressedData, err := compressData(pf.data)
+			dataToWrite, flags, err = a.encodeFile(&pf, filePos)
 			if err != nil {
-				return fmt.Errorf("compress file %s: %w", pf.mpqPath, err)
-			}
-
-			flags |= fileSingleUnit
-
-			if len(compressedData) < len(pf.data) {
-				dataToWrite = compressedData
-				flags |= fileCompress
-			} else {
-				dataToWrite = pf.data
+				return err
 			}
-
-			// Add single-unit CRC if requested
-			if useSectorCRC {
-				crc := adler32(dataToWrite)
-				crcBytes := make([]byte, 4)
-				crcBytes[0] = byte(crc)
-				crcBytes[1] = byte(crc >> 8)
-				crcBytes[2] = byte(crc >> 16)
-				crcBytes[3] = byte(crc >> 24)
-				dataToWrite = append(dataToWrite, crcBytes...)
-				flags |= fileSectorCRC
-			}
-
 			compressedSize = uint32(len(dataToWrite))
-		}
 
-		// Mark as patch file if requested
-		if pf.isPatchFile {
-			flags |= filePatchFile
-		}
-
-		if _, err := file.Write(dataToWrite); err != nil {
-			return fmt.Errorf("write file data: %w", err)
+			if _, err := file.Write(dataToWrite); err != nil {
+				return fmt.Errorf("write file data: %w", err)
+			}
 		}
 
 		// Add to block table
@@ -150,26 +137,65 @@ func (a *Archive) writeArchive() error {
 			blockTableEntry: blockTableEntry{
 				FilePos:        uint32(filePos),
 				CompressedSize: compressedSize,
-				FileSize:       uint32(len(pf.data)),
+				FileSize:       fileSize,
 				Flags:          flags,
 			},
 			FilePosHi: uint16(filePos >> 32),
 		}
 		a.blockTable = append(a.blockTable, blockEntry)
-		attributes.setEntry(i, pf.data)
+		if pf.raw != nil {
+			attributes.setCRC32(i, pf.raw.crc32)
+		} else {
+			attributes.setEntry(i, pf.data)
+		}
+		attributes.setFileTime(i, a.fileTimeFor(&pf))
 
 		// Add to hash table
-		if err := a.addToHashTable(pf.mpqPath, uint32(len(a.blockTable)-1)); err != nil {
+		if err := a.addToHashTable(pf.mpqPath, pf.locale, uint32(len(a.blockTable)-1)); err != nil {
 			return fmt.Errorf("add to hash table: %w", err)
 		}
 
 		listFileContent += pf.mpqPath + "\r\n"
 	}
 
+	// Add (patch_metadata). PatchMD5 covers the finished archive, so the
+	// file is stored uncompressed and the field is filled in at the end;
+	// its attributes entry is left empty like that of (attributes)
+	patchMD5Pos := int64(-1)
+	if a.patchMetadata != nil {
+		metaPos, _ := archivePos(file, archiveStart)
+		if metaPos > 0xFFFFFFFF {
+			needsHiBlockTable = true
+		}
+
+		meta := *a.patchMetadata
+		meta.PatchMD5 = [16]byte{}
+		if _, err := file.Write(meta.encode()); err != nil {
+			return fmt.Errorf("write patch metadata: %w", err)
+		}
+
+		blockEntry := blockTableEntryEx{
+			blockTableEntry: blockTableEntry{
+				FilePos:        uint32(metaPos),
+				CompressedSize: patchMetadataSize,
+				FileSize:       patchMetadataSize,
+				Flags:          fileExists | fileSingleUnit,
+			},
+			FilePosHi: uint16(metaPos >> 32),
+		}
+		attributes.setEntry(len(a.blockTable), nil)
+		a.blockTable = append(a.blockTable, blockEntry)
+
+		if err := a.addToHashTable("(patch_metadata)", localeNeutral, uint32(len(a.blockTable)-1)); err != nil {
+			return fmt.Errorf("add patch metadata to hash table: %w", err)
+		}
+		patchMD5Pos = metaPos + 16
+	}
+
 	// Add (listfile)
 	if listFileContent != "" {
 		listFileData := []byte(listFileContent)
-		listFilePos, _ := file.Seek(0, 1)
+		listFilePos, _ := archivePos(file, archiveStart)
 
 		if listFilePos > 0xFFFFFFFF {
 			needsHiBlockTable = true
@@ -203,25 +229,19 @@ func (a *Archive) writeArchive() error {
 			},
 			FilePosHi: uint16(listFilePos >> 32),
 		}
-		a.blockTable = append(a.blockTable, blockEntry)
-
 		// Add attributes entry for (listfile) - use index after user files
-		listFileIndex := len(a.pendingFiles)
-		attributes.setEntry(listFileIndex, listFileData)
+		attributes.setEntry(len(a.blockTable), listFileData)
+		a.blockTable = append(a.blockTable, blockEntry)
 
-		if err := a.addToHashTable("(listfile)", uint32(len(a.blockTable)-1)); err != nil {
+		if err := a.addToHashTable("(listfile)", localeNeutral, uint32(len(a.blockTable)-1)); err != nil {
 			return fmt.Errorf("add listfile to hash table: %w", err)
 		}
 	}
 
 	// Add (attributes)
-	// Calculate attributes index for the (attributes) file itself
-	attributesIndex := len(a.pendingFiles)
-	if listFileContent != "" {
-		attributesIndex++ // Account for (listfile)
-	}
+	// The (attributes) file takes the next block
 	// Set CRC32 to 0 for the (attributes) file entry (standard practice)
-	attributes.setEntry(attributesIndex, nil)
+	attributes.setEntry(len(a.blockTable), nil)
 
 	// Build attributes with all entries (including (attributes) file with CRC32=0)
 	attributesData, err := attributes.build()
@@ -229,7 +249,7 @@ func (a *Archive) writeArchive() error {
 		return fmt.Errorf("build attributes: %w", err)
 	}
 	if len(attributesData) > 0 {
-		attrPos, _ := file.Seek(0, 1)
+		attrPos, _ := archivePos(file, archiveStart)
 		if attrPos > 0xFFFFFFFF {
 			needsHiBlockTable = true
 		}
@@ -263,47 +283,57 @@ func (a *Archive) writeArchive() error {
 		}
 		a.blockTable = append(a.blockTable, blockEntry)
 
-		if err := a.addToHashTable("(attributes)", uint32(len(a.blockTable)-1)); err != nil {
+		if err := a.addToHashTable("(attributes)", localeNeutral, uint32(len(a.blockTable)-1)); err != nil {
 			return fmt.Errorf("add attributes to hash table: %w", err)
 		}
 	}
 
-	// Write hash table
-	hashTableOffset, _ := file.Seek(0, 1)
+	// Reserve (signature); it is filled in once the rest of the archive is written
+	signaturePos := int64(-1)
+	if a.weakSigningKey != nil {
+		signaturePos, _ = archivePos(file, archiveStart)
+		if signaturePos > 0xFFFFFFFF {
+			needsHiBlockTable = true
+		}
+
+		if _, err := file.Write(make([]byte, weakSignatureFileSize)); err != nil {
+			return fmt.Errorf("write signature: %w", err)
+		}
 
-	hashTableData := make([]uint32, len(a.hashTable)*4)
-	for i, entry := range a.hashTable {
-		hashTableData[i*4] = entry.HashA
-		hashTableData[i*4+1] = entry.HashB
-		hashTableData[i*4+2] = uint32(entry.Locale) | (uint32(entry.Platform) << 16)
-		hashTableData[i*4+3] = entry.BlockIndex
+		blockEntry := blockTableEntryEx{
+			blockTableEntry: blockTableEntry{
+				FilePos:        uint32(signaturePos),
+				CompressedSize: weakSignatureFileSize,
+				FileSize:       weakSignatureFileSize,
+				Flags:          fileExists,
+			},
+			FilePosHi: uint16(signaturePos >> 32),
+		}
+		a.blockTable = append(a.blockTable, blockEntry)
+
+		if err := a.addToHashTable("(signature)", localeNeutral, uint32(len(a.blockTable)-1)); err != nil {
+			return fmt.Errorf("add signature to hash table: %w", err)
+		}
 	}
-	encryptBlock(hashTableData, hashString("(hash table)", hashTypeFileKey))
 
-	if err := writeUint32Array(file, hashTableData); err != nil {
+	// Write hash table
+	hashTableOffset, _ := archivePos(file, archiveStart)
+
+	if err := writeUint32Array(file, encryptHashTable(a.hashTable)); err != nil {
 		return fmt.Errorf("write hash table: %w", err)
 	}
 
 	// Write block table
-	blockTableOffset, _ := file.Seek(0, 1)
-
-	blockTableData := make([]uint32, len(a.blockTable)*4)
-	for i, entry := range a.blockTable {
-		blockTableData[i*4] = entry.FilePos
-		blockTableData[i*4+1] = entry.CompressedSize
-		blockTableData[i*4+2] = entry.FileSize
-		blockTableData[i*4+3] = entry.Flags
-	}
-	encryptBlock(blockTableData, hashString("(block table)", hashTypeFileKey))
+	blockTableOffset, _ := archivePos(file, archiveStart)
 
-	if err := writeUint32Array(file, blockTableData); err != nil {
+	if err := writeUint32Array(file, encryptBlockTable(a.blockTable)); err != nil {
 		return fmt.Errorf("write block table: %w", err)
 	}
 
 	// Write hi-block table if V2 and needed
 	var hiBlockTableOffset int64
 	if a.formatVersion == FormatV2 && needsHiBlockTable {
-		hiBlockTableOffset, _ = file.Seek(0, 1)
+		hiBlockTableOffset, _ = archivePos(file, archiveStart)
 
 		hiBlockTable := make([]uint16, len(a.blockTable))
 		for i, entry := range a.blockTable {
@@ -316,7 +346,7 @@ func (a *Archive) writeArchive() error {
 	}
 
 	// Get archive size (total file size from start of header)
-	totalFileSize, _ := file.Seek(0, 1)
+	totalFileSize, _ := archivePos(file, archiveStart)
 
 	// Archive size in header should be the size of the archive data section
 	// (everything after the header), not the total file size.
@@ -340,7 +370,7 @@ func (a *Archive) writeArchive() error {
 	}
 
 	// Write header
-	if _, err := file.Seek(0, 0); err != nil {
+	if _, err := file.Seek(archiveStart, io.SeekStart); err != nil {
 		return fmt.Errorf("seek to header: %w", err)
 	}
 
@@ -348,12 +378,212 @@ func (a *Archive) writeArchive() error {
 		return fmt.Errorf("write header: %w", err)
 	}
 
+	if patchMD5Pos >= 0 {
+		sum, err := sectionMD5(file, archiveStart, totalFileSize)
+		if err != nil {
+			return fmt.Errorf("hash archive: %w", err)
+		}
+		if _, err := file.WriteAt(sum[:], archiveStart+patchMD5Pos); err != nil {
+			return fmt.Errorf("write patch metadata: %w", err)
+		}
+	}
+
+	// Signatures cover the archive and its user data header, but not prefix data
+	signedStart := archiveStart
+	if a.userData != nil {
+		signedStart = int64(alignUp(len(a.prefixData), headerAlignment))
+	}
+	signedSize := uint64(archiveStart - signedStart + totalFileSize)
+
+	if signaturePos >= 0 {
+		if err := signWeak(file, a.weakSigningKey, uint64(signedStart), signedSize, uint64(archiveStart-signedStart+signaturePos)); err != nil {
+			return fmt.Errorf("sign archive: %w", err)
+		}
+	}
+
+	// The strong signature covers the archive including any weak signature
+	if a.strongSigningKey != nil {
+		if err := signStrong(file, a.strongSigningKey, a.strongSignatureTail, uint64(signedStart), signedSize); err != nil {
+			return fmt.Errorf("sign archive: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// encryptHashTable returns a hash table as it is stored in an archive.
+func encryptHashTable(table []hashTableEntry) []uint32 {
+	data := make([]uint32, len(table)*4)
+	for i, entry := range table {
+		data[i*4] = entry.HashA
+		data[i*4+1] = entry.HashB
+		data[i*4+2] = uint32(entry.Locale) | (uint32(entry.Platform) << 16)
+		data[i*4+3] = entry.BlockIndex
+	}
+	encryptBlock(data, hashString("(hash table)", hashTypeFileKey))
+	return data
+}
+
+// encryptBlockTable returns a block table as it is stored in an archive.
+func encryptBlockTable(table []blockTableEntryEx) []uint32 {
+	data := make([]uint32, len(table)*4)
+	for i, entry := range table {
+		data[i*4] = entry.FilePos
+		data[i*4+1] = entry.CompressedSize
+		data[i*4+2] = entry.FileSize
+		data[i*4+3] = entry.Flags
+	}
+	encryptBlock(data, hashString("(block table)", hashTypeFileKey))
+	return data
+}
+
+// sectionMD5 returns the MD5 of size bytes of r starting at offset.
+func sectionMD5(r io.ReaderAt, offset, size int64) ([16]byte, error) {
+	var sum [16]byte
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, offset, size)); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// archivePos returns the current write position relative to the start of the archive.
+func archivePos(file *os.File, archiveStart int64) (int64, error) {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	return pos - archiveStart, err
+}
+
+// buildLeadingData lays out the bytes that precede the archive header: the
+// prefix data, then an optional MPQ\x1B user data header and its data. Each
+// part is padded so that the headers that follow stay 512-byte aligned.
+func buildLeadingData(prefix, userData []byte) []byte {
+	leading := make([]byte, alignUp(len(prefix), headerAlignment))
+	copy(leading, prefix)
+
+	if userData != nil {
+		headerOffset := alignUp(16+len(userData), headerAlignment)
+		region := make([]byte, headerOffset)
+		binary.LittleEndian.PutUint32(region[0:4], mpqUserDataMagic)
+		binary.LittleEndian.PutUint32(region[4:8], uint32(len(userData)))
+		binary.LittleEndian.PutUint32(region[8:12], uint32(headerOffset))
+		binary.LittleEndian.PutUint32(region[12:16], uint32(len(userData)))
+		copy(region[16:], userData)
+		leading = append(leading, region...)
+	}
+
+	return leading
+}
+
+// alignUp rounds n up to a multiple of alignment.
+func alignUp(n, alignment int) int {
+	return (n + alignment - 1) / alignment * alignment
+}
+
+// encodeFile compresses, checksums and encrypts a pending file for storage
+// at filePos (relative to the archive start). Returns the stored bytes and
+// the block flags.
+func (a *Archive) encodeFile(pf *pendingFile, filePos int64) ([]byte, uint32, error) {
+	var flags uint32 = fileExists
+	var key uint32
+	if pf.encrypt {
+		flags |= fileEncrypted
+		if pf.fixKey {
+			flags |= fileFixKey
+		}
+		key = getFileKey(pf.mpqPath, uint64(filePos), uint32(len(pf.data)), flags)
+	}
+
+	compress := pf.compression != CompressionNone
+	var dataToWrite []byte
+
+	// Use sectors for larger compressed files
+	if compress && len(pf.data) > int(a.sectorSize)*2 {
+		sectored, _, err := a.writeSectoredFile(pf.data, pf.compression, pf.generateCRC, pf.encrypt, key)
+		if err != nil {
+			return nil, 0, fmt.Errorf("write sectored file %s: %w", pf.mpqPath, err)
+		}
+		dataToWrite = sectored
+		flags |= fileCompress
+		if pf.generateCRC {
+			flags |= fileSectorCRC
+		}
+	} else {
+		// Single-unit file
+		flags |= fileSingleUnit
+		dataToWrite = pf.data
+
+		if compress {
+			compressedData, err := compressDataWith(pf.data, pf.compression)
+			if err != nil {
+				return nil, 0, fmt.Errorf("compress file %s: %w", pf.mpqPath, err)
+			}
+			if len(compressedData) < len(pf.data) {
+				dataToWrite = compressedData
+				flags |= fileCompress
+			}
+		}
+
+		// Add single-unit CRC of the uncompressed data if requested
+		if pf.generateCRC {
+			crcBytes := make([]byte, 4)
+			binary.LittleEndian.PutUint32(crcBytes, adler32(pf.data))
+			dataToWrite = append(dataToWrite[:len(dataToWrite):len(dataToWrite)], crcBytes...)
+			flags |= fileSectorCRC
+		}
+
+		if pf.encrypt {
+			dataToWrite = append([]byte(nil), dataToWrite...)
+			encryptBytes(dataToWrite, key)
+		}
+	}
+
+	// Mark as patch file if requested. Incremental patches are preceded by
+	// a TPatchInfo, as in Blizzard's patch archives
+	if pf.isPatchFile {
+		flags |= filePatchFile
+		if IsPatchData(pf.data) {
+			dataToWrite = append(buildPatchInfo(pf.data), dataToWrite...)
+		}
+	}
+
+	return dataToWrite, flags, nil
+}
+
+// writeRaw copies the stored bytes of a raw block to w. A FILE_FIX_KEY block
+// is re-encrypted for filePos if it moved; a TPatchInfo in front of patch
+// data is not encrypted and is kept as is.
+func (a *Archive) writeRaw(w io.Writer, mpqPath string, raw *rawBlock, filePos uint64) error {
+	r := io.NewSectionReader(raw.src, raw.offset, int64(raw.size))
+	if raw.flags&fileFixKey == 0 || raw.flags&fileEncrypted == 0 || filePos == raw.filePos {
+		_, err := io.Copy(w, r)
+		return err
+	}
+
+	fileSize := raw.fileSize
+	if raw.flags&filePatchFile != 0 {
+		head := make([]byte, min(int64(patchInfoSize), r.Size()))
+		if _, err := r.ReadAt(head, 0); err != nil {
+			return err
+		}
+		if info, ok := parsePatchInfo(head); ok && int64(info.length) <= r.Size() {
+			if _, err := io.CopyN(w, r, int64(info.length)); err != nil {
+				return err
+			}
+			fileSize = info.dataSize
+			r = io.NewSectionReader(raw.src, raw.offset+int64(info.length), int64(raw.size-info.length))
+		}
+	}
+
+	oldKey := getFileKey(mpqPath, raw.filePos, fileSize, raw.flags)
+	newKey := getFileKey(mpqPath, filePos, fileSize, raw.flags)
+	return rekeyStream(w, r, raw.flags, fileSize, a.sectorSize, oldKey, newKey)
+}
+
 // writeSectoredFile writes file data in sectors with optional CRC table.
+// If encrypt is set, the sectors and tables are encrypted with key.
 // Returns the complete data buffer, its size, and any error.
-func (a *Archive) writeSectoredFile(data []byte, useCRC bool) ([]byte, uint32, error) {
+func (a *Archive) writeSectoredFile(data []byte, method Compression, useCRC, encrypt bool, key uint32) ([]byte, uint32, error) {
 	numSectors := (uint32(len(data)) + a.sectorSize - 1) / a.sectorSize
 
 	// Build sector offset table
@@ -380,7 +610,7 @@ func (a *Archive) writeSectoredFile(data []byte, useCRC bool) ([]byte, uint32, e
 		}
 
 		sectorData := data[start:end]
-		compressed, err := compressData(sectorData)
+		compressed, err := compressDataWith(sectorData, method)
 		if err != nil {
 			return nil, 0, fmt.Errorf("compress sector %d: %w", i, err)
 		}
@@ -392,6 +622,11 @@ func (a *Archive) writeSectoredFile(data []byte, useCRC bool) ([]byte, uint32, e
 			sectors[i] = sectorData
 		}
 
+		if encrypt {
+			sectors[i] = append([]byte(nil), sectors[i]...)
+			encryptBytes(sectors[i], key+i)
+		}
+
 		offsetTable[i] = currentOffset
 		currentOffset += uint32(len(sectors[i]))
 
@@ -403,6 +638,14 @@ func (a *Archive) writeSectoredFile(data []byte, useCRC bool) ([]byte, uint32, e
 
 	offsetTable[numSectors] = currentOffset
 
+	// Encrypted files also encrypt their tables, using the keys the reader expects
+	if encrypt {
+		encryptBlock(offsetTable, key-1)
+		if useCRC {
+			encryptBlock(sectorCRCs, key-1+numSectors)
+		}
+	}
+
 	// Build final data buffer
 	totalSize := currentOffset
 	result := make([]byte, totalSize)
@@ -438,7 +681,7 @@ func (a *Archive) writeSectoredFile(data []byte, useCRC bool) ([]byte, uint32, e
 }
 
 // addToHashTable adds a file to the hash table
-func (a *Archive) addToHashTable(mpqPath string, blockIndex uint32) error {
+func (a *Archive) addToHashTable(mpqPath string, locale uint16, blockIndex uint32) error {
 	hashA := hashString(mpqPath, hashTypeNameA)
 	hashB := hashString(mpqPath, hashTypeNameB)
 	startIndex := hashString(mpqPath, hashTypeTableOffset) % a.header.HashTableSize
@@ -450,7 +693,7 @@ func (a *Archive) addToHashTable(mpqPath string, blockIndex uint32) error {
 		if entry.BlockIndex == hashTableEmpty || entry.BlockIndex == hashTableDeleted {
 			entry.HashA = hashA
 			entry.HashB = hashB
-			entry.Locale = localeNeutral
+			entry.Locale = locale
 			entry.Platform = 0
 			entry.BlockIndex = blockIndex
 			return nil